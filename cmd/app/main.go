@@ -38,8 +38,34 @@ func main() {
 
 	// 2. Инициализация слоев
 	repo := postgres.NewSubscriptionRepository(dbPool)
-	svc := service.NewSubscriptionService(repo)
-	handler := rest.NewHandler(svc)
+	overlapPolicy, ok := service.ParseOverlapPolicy(cfg.OverlapPolicy)
+	if !ok {
+		logger.Error("invalid OVERLAP_POLICY, expected reject, warn or allow", "value", cfg.OverlapPolicy)
+		os.Exit(1)
+	}
+	webhookSvc := service.NewWebhookService(postgres.NewWebhookRepository(dbPool), repo, service.WebhookDeliveryConfig{
+		Timeout:        cfg.Webhook.Timeout,
+		MaxAttempts:    cfg.Webhook.MaxAttempts,
+		RetryBase:      cfg.Webhook.RetryBase,
+		AllowPrivate:   cfg.Webhook.AllowPrivate,
+		EventRetention: cfg.Webhook.Retention,
+	})
+	svc := service.NewSubscriptionService(repo, overlapPolicy)
+	idempotencySvc := service.NewIdempotencyService(postgres.NewIdempotencyRepository(dbPool), cfg.IdempotencyTTL)
+	budgetSvc := service.NewBudgetService(postgres.NewBudgetRepository(dbPool), svc)
+	anomalySvc := service.NewAnomalyService(repo, postgres.NewAnomalyRepository(dbPool), service.AnomalyRules{
+		JumpPercent: cfg.Anomaly.JumpPercent,
+		ZScore:      cfg.Anomaly.ZScore,
+		Window:      cfg.Anomaly.Window,
+	})
+	handler := rest.NewHandler(svc, idempotencySvc, budgetSvc, anomalySvc, webhookSvc)
+
+	go cleanupIdempotencyKeys(ctx, logger, idempotencySvc)
+	go pruneWebhookEvents(ctx, logger, webhookSvc)
+	go evaluateBudgets(ctx, logger, budgetSvc, cfg.BudgetInterval)
+	go detectAnomalies(ctx, logger, anomalySvc, cfg.Anomaly.Interval)
+	go deliverWebhooks(ctx, logger, webhookSvc, cfg.Webhook.PollInterval)
+	go publishEndedSubscriptions(ctx, logger, webhookSvc)
 
 	// 3. Запуск HTTP сервера
 	srv := &http.Server{
@@ -69,3 +95,139 @@ func main() {
 
 	logger.Info("Server exited properly")
 }
+
+// cleanupIdempotencyKeys раз в час удаляет истекшие ключи идемпотентности
+func cleanupIdempotencyKeys(ctx context.Context, logger *slog.Logger, svc *service.IdempotencyService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := svc.Cleanup(ctx)
+			if err != nil {
+				logger.Error("failed to clean up idempotency keys", "error", err)
+				continue
+			}
+			if n > 0 {
+				logger.Info("expired idempotency keys removed", "count", n)
+			}
+		}
+	}
+}
+
+// pruneWebhookEvents раз в час удаляет доставленные события webhook старше срока хранения
+func pruneWebhookEvents(ctx context.Context, logger *slog.Logger, svc *service.WebhookService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := svc.PruneEvents(ctx, time.Now().UTC())
+			if err != nil {
+				logger.Error("failed to prune webhook events", "error", err)
+				continue
+			}
+			if n > 0 {
+				logger.Info("delivered webhook events removed", "count", n)
+			}
+		}
+	}
+}
+
+// evaluateBudgets раз в interval проверяет бюджеты на текущий месяц и сохраняет сработавшие пороги
+func evaluateBudgets(ctx context.Context, logger *slog.Logger, svc *service.BudgetService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			alerts, err := svc.Evaluate(ctx, time.Now().UTC())
+			if err != nil {
+				logger.Error("failed to evaluate budgets", "error", err)
+				continue
+			}
+			for _, a := range alerts {
+				logger.Warn("budget threshold reached",
+					"budget_id", a.BudgetID, "user_id", a.UserID, "threshold", a.Threshold,
+					"spend", a.Spend, "monthly_limit", a.MonthlyLimit)
+			}
+		}
+	}
+}
+
+// detectAnomalies ищет аномалии расходов при старте и затем раз в interval:
+// интервал обычно сутки, и без первого запуска после рестарта можно долго ничего не найти
+func detectAnomalies(ctx context.Context, logger *slog.Logger, svc *service.AnomalyService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		anomalies, err := svc.Detect(ctx, time.Now().UTC())
+		if err != nil {
+			logger.Error("failed to detect spending anomalies", "error", err)
+		}
+		for _, a := range anomalies {
+			logger.Warn("spending anomaly detected",
+				"user_id", a.UserID, "rule", a.Rule, "spend", a.Spend, "baseline", a.Baseline, "score", a.Score)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverWebhooks раз в interval ставит в доставку новые события подписок из outbox
+// и отправляет события, время доставки которых пришло
+func deliverWebhooks(ctx context.Context, logger *slog.Logger, svc *service.WebhookService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := svc.DispatchEvents(ctx); err != nil {
+				logger.Error("failed to dispatch subscription events", "error", err)
+			}
+			delivered, failed, err := svc.Deliver(ctx)
+			if err != nil {
+				logger.Error("failed to deliver webhooks", "error", err)
+			}
+			if delivered+failed > 0 {
+				logger.Info("webhook deliveries attempted", "delivered", delivered, "failed", failed)
+			}
+		}
+	}
+}
+
+// publishEndedSubscriptions публикует subscription.ended для подписок, закончившихся после последнего
+// опубликованного месяца и до текущего, при старте и затем раз в час: если процесс перезапускается
+// чаще раза в час, без первого запуска события не публиковались бы никогда. Повторный запуск
+// событие не дублирует (dedup_key)
+func publishEndedSubscriptions(ctx context.Context, logger *slog.Logger, svc *service.WebhookService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := svc.PublishEnded(ctx, time.Now().UTC())
+		if err != nil {
+			logger.Error("failed to publish ended subscriptions", "error", err)
+		}
+		if n > 0 {
+			logger.Info("subscription.ended events queued", "deliveries", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// webhook-receiver - локальный получатель webhook для проверки доставки:
+// проверяет подпись, пишет события в лог и по флагу -fail отвечает 500 на первые N запросов
+package main
+
+import (
+	"crypto/hmac"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	secret := flag.String("secret", "", "webhook secret; empty - signature is not checked")
+	fail := flag.Int64("fail", 0, "answer 500 to the first N requests")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	var received atomic.Int64
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		event := r.Header.Get(service.WebhookEventHeader)
+		delivery := r.Header.Get(service.WebhookDeliveryHeader)
+
+		if *secret != "" {
+			ts, err := strconv.ParseInt(r.Header.Get(service.WebhookTimestampHeader), 10, 64)
+			want := service.SignWebhookPayload(*secret, ts, body)
+			if err != nil || !hmac.Equal([]byte(want), []byte(r.Header.Get(service.WebhookSignatureHeader))) {
+				logger.Warn("invalid signature", "event", event, "delivery", delivery)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if n := received.Add(1); n <= *fail {
+			logger.Info("simulated failure", "event", event, "delivery", delivery, "request", n)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("webhook received", "event", event, "delivery", delivery, "body", string(body))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	logger.Info("webhook receiver started", "addr", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		logger.Error("receiver stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -1,14 +1,40 @@
 package config
 
 import (
+	"fmt"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	HTTPPort string
-	DB       DBConfig
+	HTTPPort       string
+	DB             DBConfig
+	IdempotencyTTL time.Duration // сколько хранится ответ на запрос с Idempotency-Key
+	OverlapPolicy  string        // reject | warn | allow - пересекающиеся подписки одного сервиса
+	BudgetInterval time.Duration // как часто проверять бюджеты на пересечение порогов
+	Anomaly        AnomalyConfig
+	Webhook        WebhookConfig
+}
+
+// WebhookConfig - доставка событий подписок на webhook
+type WebhookConfig struct {
+	PollInterval time.Duration // как часто искать доставки, время которых пришло
+	Timeout      time.Duration // таймаут запроса к получателю
+	MaxAttempts  int           // после стольких неудач доставка попадает в dead letters
+	RetryBase    time.Duration // задержка перед первым повтором, дальше удваивается (не больше часа)
+	AllowPrivate bool          // разрешить адреса loopback и частных сетей, только для локальной разработки
+	Retention    time.Duration // сколько хранятся полностью доставленные события
+}
+
+// AnomalyConfig - поиск необычного роста расходов пользователей, 0 в пороге выключает правило
+type AnomalyConfig struct {
+	Interval    time.Duration // как часто запускать поиск
+	JumpPercent float64       // рост к прошлому месяцу в процентах
+	ZScore      float64       // z-оценка к предыдущим месяцам
+	Window      int           // сколько предыдущих месяцев учитывать
 }
 
 type DBConfig struct {
@@ -25,7 +51,8 @@ func Load() (*Config, error) {
 	}
 
 	cfg := &Config{
-		HTTPPort: getEnv("HTTP_PORT", "8080"), // вторым аргументом дефолтные значения
+		HTTPPort:      getEnv("HTTP_PORT", "8080"), // вторым аргументом дефолтные значения
+		OverlapPolicy: getEnv("OVERLAP_POLICY", "warn"),
 		DB: DBConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -34,6 +61,66 @@ func Load() (*Config, error) {
 			Name:     getEnv("DB_NAME", "subscriptions_db"),
 		},
 	}
+
+	ttl, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: must be a positive duration like 24h")
+	}
+	cfg.IdempotencyTTL = ttl
+
+	budgetInterval, err := time.ParseDuration(getEnv("BUDGET_CHECK_INTERVAL", "1h"))
+	if err != nil || budgetInterval <= 0 {
+		return nil, fmt.Errorf("invalid BUDGET_CHECK_INTERVAL: must be a positive duration like 1h")
+	}
+	cfg.BudgetInterval = budgetInterval
+
+	anomalyInterval, err := time.ParseDuration(getEnv("ANOMALY_CHECK_INTERVAL", "24h"))
+	if err != nil || anomalyInterval <= 0 {
+		return nil, fmt.Errorf("invalid ANOMALY_CHECK_INTERVAL: must be a positive duration like 24h")
+	}
+	jump, err := strconv.ParseFloat(getEnv("ANOMALY_JUMP_PERCENT", "50"), 64)
+	if err != nil || jump < 0 {
+		return nil, fmt.Errorf("invalid ANOMALY_JUMP_PERCENT: must be a non-negative number")
+	}
+	zscore, err := strconv.ParseFloat(getEnv("ANOMALY_ZSCORE", "3"), 64)
+	if err != nil || zscore < 0 {
+		return nil, fmt.Errorf("invalid ANOMALY_ZSCORE: must be a non-negative number")
+	}
+	window, err := strconv.Atoi(getEnv("ANOMALY_WINDOW_MONTHS", "6"))
+	if err != nil || window < 1 {
+		return nil, fmt.Errorf("invalid ANOMALY_WINDOW_MONTHS: must be a positive integer")
+	}
+	cfg.Anomaly = AnomalyConfig{Interval: anomalyInterval, JumpPercent: jump, ZScore: zscore, Window: window}
+
+	poll, err := time.ParseDuration(getEnv("WEBHOOK_POLL_INTERVAL", "5s"))
+	if err != nil || poll <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_POLL_INTERVAL: must be a positive duration like 5s")
+	}
+	timeout, err := time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT: must be a positive duration like 10s")
+	}
+	retryBase, err := time.ParseDuration(getEnv("WEBHOOK_RETRY_BASE", "30s"))
+	if err != nil || retryBase <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_RETRY_BASE: must be a positive duration like 30s")
+	}
+	attempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || attempts < 1 {
+		return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: must be a positive integer")
+	}
+	allowPrivate, err := strconv.ParseBool(getEnv("WEBHOOK_ALLOW_PRIVATE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_ALLOW_PRIVATE: must be true or false")
+	}
+	retention, err := time.ParseDuration(getEnv("WEBHOOK_EVENT_RETENTION", "720h"))
+	if err != nil || retention <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_EVENT_RETENTION: must be a positive duration like 720h")
+	}
+	cfg.Webhook = WebhookConfig{
+		PollInterval: poll, Timeout: timeout, MaxAttempts: attempts, RetryBase: retryBase,
+		AllowPrivate: allowPrivate, Retention: retention,
+	}
+
 	return cfg, nil
 }
 
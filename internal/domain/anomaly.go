@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Anomaly - необычный рост месячных расходов пользователя, найденный правилом Rule
+type Anomaly struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Month     time.Time `json:"month" db:"month"`
+	Rule      string    `json:"rule" db:"rule"`
+	Spend     int       `json:"spend" db:"spend"`
+	Baseline  float64   `json:"baseline" db:"baseline"` // расходы прошлого месяца или среднее за окно
+	Score     float64   `json:"score" db:"score"`       // рост в процентах или z-оценка
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
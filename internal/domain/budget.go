@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Budget - месячный лимит расходов пользователя: общий или на один сервис
+type Budget struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	ServiceName  *string   `json:"service_name,omitempty" db:"service_name"` // nil - все подписки пользователя
+	MonthlyLimit int       `json:"monthly_limit" db:"monthly_limit"`
+	Thresholds   []int     `json:"thresholds" db:"thresholds"` // пороги в процентах от лимита, по возрастанию
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// BudgetAlert - расходы месяца дошли до порога бюджета
+type BudgetAlert struct {
+	ID           int64     `json:"id" db:"id"`
+	BudgetID     uuid.UUID `json:"budget_id" db:"budget_id"`
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	ServiceName  *string   `json:"service_name,omitempty" db:"service_name"`
+	Month        time.Time `json:"month" db:"month"`
+	Threshold    int       `json:"threshold" db:"threshold"`
+	Spend        int       `json:"spend" db:"spend"`
+	MonthlyLimit int       `json:"monthly_limit" db:"monthly_limit"` // лимит на момент срабатывания
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
@@ -13,4 +13,20 @@ type Subscription struct {
 	Price       int        `json:"price" db:"price"`
 	StartDate   time.Time  `json:"start_date" db:"start_date"`       // в тз было непонятно, поэтому сделаю 1 число указанного месяца
 	EndDate     *time.Time `json:"end_date,omitempty" db:"end_date"` // указатель, тк конец это опционально и может быть null
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	Plan        *string    `json:"plan,omitempty" db:"plan"`               // тариф сервиса, например "Premium"
+	PreviousID  *uuid.UUID `json:"previous_id,omitempty" db:"previous_id"` // подписка, из которой эта получена сменой тарифа
+	// AutoRenew - продлится ли подписка после end_date. По умолчанию true только для бессрочных
+	AutoRenew  bool       `json:"auto_renew" db:"auto_renew"`
+	CanceledAt *time.Time `json:"canceled_at,omitempty" db:"canceled_at"` // когда пользователь отменил подписку
+}
+
+// EffectiveEnd - последний оплачиваемый месяц: end_date без автопродления, nil - списания не заканчиваются
+// (бессрочная подписка или с автопродлением, которое продлевает ее и после end_date).
+// Все расчеты расходов считают подписку действующей до этого месяца включительно
+func (s Subscription) EffectiveEnd() *time.Time {
+	if s.AutoRenew {
+		return nil
+	}
+	return s.EndDate
 }
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// типы событий жизненного цикла подписки
+const (
+	EventSubscriptionCreated = "subscription.created"
+	EventSubscriptionUpdated = "subscription.updated"
+	EventSubscriptionDeleted = "subscription.deleted"
+	EventSubscriptionEnded   = "subscription.ended" // наступил месяц после end_date, автопродления нет
+)
+
+// Webhook - получатель событий жизненного цикла подписок
+type Webhook struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	URL        string    `json:"url" db:"url"`
+	Secret     string    `json:"-" db:"secret"` // ключ подписи, наружу отдается только при создании
+	EventTypes []string  `json:"event_types" db:"event_types"`
+	Active     bool      `json:"active" db:"active"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// WebhookEvent - событие подписки; Payload - готовое тело запроса к получателям
+type WebhookEvent struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	Type           string    `json:"type" db:"type"`
+	SubscriptionID uuid.UUID `json:"subscription_id" db:"subscription_id"`
+	Payload        []byte    `json:"payload" db:"payload"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery - доставка события одному получателю
+type WebhookDelivery struct {
+	ID             int64      `json:"id" db:"id"`
+	WebhookID      uuid.UUID  `json:"webhook_id" db:"webhook_id"`
+	EventID        uuid.UUID  `json:"event_id" db:"event_id"`
+	EventType      string     `json:"event_type" db:"event_type"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" db:"subscription_id"`
+	Status         string     `json:"status" db:"status"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty" db:"last_status_code"`
+	LastError      *string    `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+}
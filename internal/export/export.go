@@ -0,0 +1,56 @@
+// Package export пишет табличные данные в CSV, NDJSON и XLSX построчно,
+// не накапливая результат в памяти
+package export
+
+import (
+	"fmt"
+	"io"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+	XLSX   Format = "xlsx"
+)
+
+// Writer пишет таблицу: сначала заголовок, затем строки. Значения - string, int или nil.
+// Close обязателен: для XLSX он дописывает архив
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []any) error
+	Close() error
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case CSV, NDJSON, XLSX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected csv, ndjson or xlsx", s)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+func NewWriter(f Format, w io.Writer) (Writer, error) {
+	switch f {
+	case CSV:
+		return newCSVWriter(w), nil
+	case NDJSON:
+		return newNDJSONWriter(w), nil
+	case XLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
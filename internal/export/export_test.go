@@ -0,0 +1,148 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"slices"
+	"testing"
+)
+
+var (
+	testColumns = []string{"service_name", "price", "end_date", "auto_renew"}
+	testRows    = [][]any{
+		{"Netflix", 399, nil, true},
+		{`Tom & "Jerry" <kids>`, 0, "12-2025", false},
+	}
+)
+
+func writeTable(t *testing.T, f Format) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(f, &buf)
+	if err != nil {
+		t.Fatalf("NewWriter(%s) error = %v", f, err)
+	}
+	if err := w.WriteHeader(testColumns); err != nil {
+		t.Fatalf("WriteHeader() error = %v", err)
+	}
+	for _, row := range testRows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{"csv", CSV, false},
+		{"ndjson", NDJSON, false},
+		{"xlsx", XLSX, false},
+		{"XLSX", "", true},
+		{"json", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFormat(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseFormat(%q) = %q, %v, want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTextWriters(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{CSV, "service_name,price,end_date,auto_renew\n" +
+			"Netflix,399,,true\n" +
+			`"Tom & ""Jerry"" <kids>",0,12-2025,false` + "\n"},
+		{NDJSON, `{"service_name":"Netflix","price":399,"end_date":null,"auto_renew":true}` + "\n" +
+			`{"service_name":"Tom \u0026 \"Jerry\" \u003ckids\u003e","price":0,"end_date":"12-2025","auto_renew":false}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			if got := string(writeTable(t, tt.format)); got != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNDJSONRowLength(t *testing.T) {
+	w := newNDJSONWriter(io.Discard)
+	w.WriteHeader(testColumns)
+	if err := w.WriteRow([]any{"Netflix"}); err == nil {
+		t.Error("WriteRow() with short row: want error")
+	}
+}
+
+// xlsxCell - ячейка листа: тип и значение (<v> или inline-строка)
+type xlsxCell struct {
+	Type  string `xml:"t,attr"`
+	Value string `xml:"v"`
+	Text  string `xml:"is>t"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestXLSXWriter(t *testing.T) {
+	data := writeTable(t, XLSX)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+
+	var names []string
+	var sheet xlsxSheet
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		// каждая часть книги - корректный XML
+		var v any = new(struct{})
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			v = &sheet
+		}
+		if err := xml.NewDecoder(rc).Decode(v); err != nil {
+			t.Errorf("%s: invalid xml: %v", f.Name, err)
+		}
+		rc.Close()
+	}
+	wantNames := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}
+	if !slices.Equal(names, wantNames) {
+		t.Errorf("parts = %v, want %v", names, wantNames)
+	}
+
+	want := [][]xlsxCell{
+		{{"inlineStr", "", "service_name"}, {"inlineStr", "", "price"}, {"inlineStr", "", "end_date"}, {"inlineStr", "", "auto_renew"}},
+		{{"inlineStr", "", "Netflix"}, {"n", "399", ""}, {}, {"b", "1", ""}},
+		{{"inlineStr", "", `Tom & "Jerry" <kids>`}, {"n", "0", ""}, {"inlineStr", "", "12-2025"}, {"b", "0", ""}},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("rows = %d, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if !slices.Equal(row.Cells, want[i]) {
+			t.Errorf("row %d = %+v, want %+v", i, row.Cells, want[i])
+		}
+	}
+}
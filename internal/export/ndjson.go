@@ -0,0 +1,58 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// ndjsonWriter пишет по одному json-объекту на строку, ключи - имена колонок в их порядке
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []json.RawMessage
+	buf     bytes.Buffer
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{w: w}
+}
+
+func (n *ndjsonWriter) WriteHeader(columns []string) error {
+	n.columns = make([]json.RawMessage, len(columns))
+	for i, c := range columns {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		n.columns[i] = b
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) WriteRow(values []any) error {
+	if len(values) != len(n.columns) {
+		return errors.New("row length does not match header")
+	}
+	n.buf.Reset()
+	n.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			n.buf.WriteByte(',')
+		}
+		n.buf.Write(n.columns[i])
+		n.buf.WriteByte(':')
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.buf.Write(b)
+	}
+	n.buf.WriteString("}\n")
+	_, err := n.w.Write(n.buf.Bytes())
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
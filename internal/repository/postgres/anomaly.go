@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const anomalyColumns = "id, user_id, month, rule, spend, baseline, score, created_at"
+
+type AnomalyRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAnomalyRepository(pool *pgxpool.Pool) *AnomalyRepository {
+	return &AnomalyRepository{pool: pool}
+}
+
+func (r *AnomalyRepository) Add(ctx context.Context, anomalies []domain.Anomaly) ([]domain.Anomaly, error) {
+	if len(anomalies) == 0 {
+		return nil, nil
+	}
+
+	userIDs := make([]uuid.UUID, len(anomalies))
+	months := make([]time.Time, len(anomalies))
+	rules := make([]string, len(anomalies))
+	spends := make([]int, len(anomalies))
+	baselines := make([]float64, len(anomalies))
+	scores := make([]float64, len(anomalies))
+	for i, a := range anomalies {
+		userIDs[i], months[i], rules[i] = a.UserID, a.Month, a.Rule
+		spends[i], baselines[i], scores[i] = a.Spend, a.Baseline, a.Score
+	}
+
+	// уже найденные за этот месяц аномалии пропускаем, RETURNING вернет только вставленные строки
+	query := `
+		INSERT INTO anomalies (user_id, month, rule, spend, baseline, score)
+		SELECT * FROM unnest($1::uuid[], $2::date[], $3::text[], $4::int[], $5::float8[], $6::float8[])
+		ON CONFLICT (user_id, month, rule) DO NOTHING
+		RETURNING ` + anomalyColumns
+	rows, err := r.pool.Query(ctx, query, userIDs, months, rules, spends, baselines, scores)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add anomalies: %w", err)
+	}
+	return collectAnomalies(rows)
+}
+
+func (r *AnomalyRepository) List(ctx context.Context, filter repository.AnomalyFilter) ([]domain.Anomaly, error) {
+	var w whereBuilder
+	if filter.UserID != nil {
+		w.add("user_id = " + w.arg(*filter.UserID))
+	}
+	if filter.Rule != nil {
+		w.add("rule = " + w.arg(*filter.Rule))
+	}
+	if filter.From != nil {
+		w.add("month >= " + w.arg(*filter.From))
+	}
+	if filter.To != nil {
+		w.add("month <= " + w.arg(*filter.To))
+	}
+
+	query := `
+		SELECT ` + anomalyColumns + ` FROM anomalies
+		WHERE ` + w.sql() + `
+		ORDER BY month DESC, id ASC
+	`
+	rows, err := r.pool.Query(ctx, query, w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list anomalies: %w", err)
+	}
+	return collectAnomalies(rows)
+}
+
+func collectAnomalies(rows pgx.Rows) ([]domain.Anomaly, error) {
+	defer rows.Close()
+
+	var result []domain.Anomaly
+	for rows.Next() {
+		var a domain.Anomaly
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Month, &a.Rule, &a.Spend, &a.Baseline, &a.Score, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		result = append(result, a)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
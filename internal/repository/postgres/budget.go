@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const budgetColumns = "id, user_id, service_name, monthly_limit, thresholds, created_at"
+
+type BudgetRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBudgetRepository(pool *pgxpool.Pool) *BudgetRepository {
+	return &BudgetRepository{pool: pool}
+}
+
+func (r *BudgetRepository) Create(ctx context.Context, b *domain.Budget) error {
+	query := `
+		INSERT INTO budgets (id, user_id, service_name, monthly_limit, thresholds)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	err := r.pool.QueryRow(ctx, query, b.ID, b.UserID, b.ServiceName, b.MonthlyLimit, b.Thresholds).Scan(&b.CreatedAt)
+	if isUniqueViolation(err) {
+		return repository.ErrBudgetExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create budget: %w", err)
+	}
+	return nil
+}
+
+func (r *BudgetRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Budget, error) {
+	query := `SELECT ` + budgetColumns + ` FROM budgets WHERE id = $1`
+	var b domain.Budget
+	err := r.pool.QueryRow(ctx, query, id).Scan(budgetDest(&b)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget: %w", err)
+	}
+	return &b, nil
+}
+
+func (r *BudgetRepository) Update(ctx context.Context, b *domain.Budget) error {
+	query := `
+		UPDATE budgets
+		SET service_name = $2, monthly_limit = $3, thresholds = $4
+		WHERE id = $1
+	`
+	ct, err := r.pool.Exec(ctx, query, b.ID, b.ServiceName, b.MonthlyLimit, b.Thresholds)
+	if isUniqueViolation(err) {
+		return repository.ErrBudgetExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update budget: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return repository.ErrBudgetNotFound
+	}
+	return nil
+}
+
+func (r *BudgetRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ct, err := r.pool.Exec(ctx, `DELETE FROM budgets WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return repository.ErrBudgetNotFound
+	}
+	return nil
+}
+
+func (r *BudgetRepository) List(ctx context.Context, userID *uuid.UUID) ([]domain.Budget, error) {
+	query := `
+		SELECT ` + budgetColumns + ` FROM budgets
+		WHERE $1::uuid IS NULL OR user_id = $1
+		ORDER BY user_id, service_name NULLS FIRST
+	`
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var result []domain.Budget
+	for rows.Next() {
+		var b domain.Budget
+		if err := rows.Scan(budgetDest(&b)...); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		result = append(result, b)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+func (r *BudgetRepository) AddAlerts(ctx context.Context, alerts []domain.BudgetAlert) ([]domain.BudgetAlert, error) {
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+
+	budgetIDs := make([]uuid.UUID, len(alerts))
+	months := make([]time.Time, len(alerts))
+	thresholds := make([]int, len(alerts))
+	spends := make([]int, len(alerts))
+	limits := make([]int, len(alerts))
+	for i, a := range alerts {
+		budgetIDs[i], months[i], thresholds[i], spends[i], limits[i] = a.BudgetID, a.Month, a.Threshold, a.Spend, a.MonthlyLimit
+	}
+
+	// уже сработавшие пороги пропускаем, RETURNING вернет только вставленные строки
+	query := `
+		INSERT INTO budget_alerts (budget_id, month, threshold, spend, monthly_limit)
+		SELECT * FROM unnest($1::uuid[], $2::date[], $3::int[], $4::int[], $5::int[])
+		ON CONFLICT (budget_id, month, threshold) DO NOTHING
+		RETURNING id, budget_id, month, threshold, created_at
+	`
+	rows, err := r.pool.Query(ctx, query, budgetIDs, months, thresholds, spends, limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add budget alerts: %w", err)
+	}
+	defer rows.Close()
+
+	type alertKey struct {
+		budgetID  uuid.UUID
+		month     time.Time
+		threshold int
+	}
+	byKey := make(map[alertKey]domain.BudgetAlert, len(alerts))
+	for _, a := range alerts {
+		byKey[alertKey{a.BudgetID, a.Month.UTC(), a.Threshold}] = a
+	}
+
+	var created []domain.BudgetAlert
+	for rows.Next() {
+		var k alertKey
+		var id int64
+		var createdAt time.Time
+		if err := rows.Scan(&id, &k.budgetID, &k.month, &k.threshold, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan budget alert: %w", err)
+		}
+		k.month = k.month.UTC()
+		a := byKey[k]
+		a.ID, a.CreatedAt = id, createdAt
+		created = append(created, a)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return created, nil
+}
+
+func (r *BudgetRepository) Alerts(ctx context.Context, filter repository.BudgetAlertFilter) ([]domain.BudgetAlert, error) {
+	var w whereBuilder
+	if filter.UserID != nil {
+		w.add("b.user_id = " + w.arg(*filter.UserID))
+	}
+	if filter.BudgetID != nil {
+		w.add("a.budget_id = " + w.arg(*filter.BudgetID))
+	}
+	if filter.From != nil {
+		w.add("a.month >= " + w.arg(*filter.From))
+	}
+	if filter.To != nil {
+		w.add("a.month <= " + w.arg(*filter.To))
+	}
+
+	query := `
+		SELECT a.id, a.budget_id, b.user_id, b.service_name, a.month, a.threshold, a.spend, a.monthly_limit, a.created_at
+		FROM budget_alerts a
+		JOIN budgets b ON b.id = a.budget_id
+		WHERE ` + w.sql() + `
+		ORDER BY a.id ASC
+	`
+	rows, err := r.pool.Query(ctx, query, w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list budget alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var result []domain.BudgetAlert
+	for rows.Next() {
+		var a domain.BudgetAlert
+		if err := rows.Scan(&a.ID, &a.BudgetID, &a.UserID, &a.ServiceName, &a.Month, &a.Threshold, &a.Spend, &a.MonthlyLimit, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan budget alert: %w", err)
+		}
+		result = append(result, a)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+// budgetDest - приемники для budgetColumns
+func budgetDest(b *domain.Budget) []any {
+	return []any{&b.ID, &b.UserID, &b.ServiceName, &b.MonthlyLimit, &b.Thresholds, &b.CreatedAt}
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// queueBulkOp кладет операцию в батч
+func queueBulkOp(batch *pgx.Batch, op repository.BulkOp) {
+	// событие пишется тем же запросом, лишних обращений к базе нет
+	switch op.Kind {
+	case repository.BulkCreate:
+		batch.Queue(withEvent(insertSubscriptionQuery, domain.EventSubscriptionCreated), insertArgs(op.Subscription)...)
+	case repository.BulkUpdate:
+		batch.Queue(withEvent(updateSubscriptionQuery, domain.EventSubscriptionUpdated), updateArgs(op.Subscription)...)
+	case repository.BulkDelete:
+		batch.Queue(withEvent(deleteSubscriptionQuery, domain.EventSubscriptionDeleted), op.ID)
+	}
+}
+
+// scanBulkResult читает результат операции в op.Subscription: созданную, обновленную или удаленную подписку
+func scanBulkResult(results pgx.BatchResults, op *repository.BulkOp) error {
+	sub, err := scanSubscription(results.QueryRow())
+	if err != nil {
+		return err
+	}
+	op.Subscription = &sub
+	return nil
+}
+
+func (r *SubscriptionRepository) BulkAtomic(ctx context.Context, ops []repository.BulkOp) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return -1, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // после Commit ничего не делает
+
+	// пары всех сохраняемых подписок блокируются сразу, как в withOverlapCheck
+	subs := make([]domain.Subscription, 0, len(ops))
+	for _, op := range ops {
+		if op.Kind != repository.BulkDelete {
+			subs = append(subs, *op.Subscription)
+		}
+	}
+	if err := lockOverlapKeys(ctx, tx, subs); err != nil {
+		return -1, err
+	}
+
+	// операции уходят на сервер батчами: перед операцией с проверкой пересечений накопленный батч
+	// выполняется, чтобы проверка видела подписки, записанные предыдущими операциями пакета
+	from := 0
+	for i := range ops {
+		op := &ops[i]
+		if op.Check == nil || op.Kind == repository.BulkDelete {
+			continue
+		}
+		if failed, err := sendBulkBatch(ctx, tx, ops, from, i); err != nil {
+			return failed, err
+		}
+		from = i
+		overlaps, err := findOverlapping(ctx, tx, *op.Subscription)
+		if err != nil {
+			return i, err
+		}
+		if err := op.Check(overlaps); err != nil {
+			return i, err
+		}
+	}
+	if failed, err := sendBulkBatch(ctx, tx, ops, from, len(ops)); err != nil {
+		return failed, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return -1, fmt.Errorf("failed to commit bulk: %w", err)
+	}
+	return -1, nil
+}
+
+// sendBulkBatch выполняет операции ops[from:to] одним батчем и возвращает индекс упавшей операции
+func sendBulkBatch(ctx context.Context, tx pgx.Tx, ops []repository.BulkOp, from, to int) (int, error) {
+	if from == to {
+		return -1, nil
+	}
+	batch := &pgx.Batch{}
+	for _, op := range ops[from:to] {
+		queueBulkOp(batch, op)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	for i := from; i < to; i++ {
+		op := &ops[i]
+		err := scanBulkResult(results, op)
+		if op.Kind == repository.BulkCreate && isUniqueViolation(err) {
+			results.Close()
+			return i, repository.ErrConflict
+		}
+		if op.Kind != repository.BulkCreate && errors.Is(err, pgx.ErrNoRows) {
+			results.Close()
+			return i, repository.ErrNotFound
+		}
+		if err != nil {
+			results.Close()
+			return i, fmt.Errorf("failed to %s subscription: %w", op.Kind, err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return -1, fmt.Errorf("failed to close batch: %w", err)
+	}
+	return -1, nil
+}
+
+func (r *SubscriptionRepository) BulkBestEffort(ctx context.Context, ops []repository.BulkOp) []error {
+	// батч pgx выполняется в неявной транзакции и обрывается на первой ошибке,
+	// поэтому в этом режиме операции идут по одной
+	errs := make([]error, len(ops))
+	for i := range ops {
+		op := &ops[i]
+		switch op.Kind {
+		case repository.BulkCreate:
+			errs[i] = r.Create(ctx, op.Subscription, op.Check)
+		case repository.BulkUpdate:
+			errs[i] = r.Update(ctx, op.Subscription, op.Check)
+		case repository.BulkDelete:
+			op.Subscription, errs[i] = r.Delete(ctx, op.ID)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,21 @@
+package postgres
+
+// withEvent дополняет query (INSERT, UPDATE или DELETE подписок без RETURNING) записью события
+// eventType в outbox subscription_events по каждой затронутой строке. Событие пишется тем же запросом,
+// поэтому сохраняется или откатывается вместе с изменением. Запрос возвращает subscriptionColumns
+// затронутых подписок: новое состояние, у удаленных - последнее
+func withEvent(query, eventType string) string {
+	return `
+		WITH s AS (` + query + ` RETURNING ` + subscriptionColumns + `)` +
+		insertEvents("'"+eventType+"'") + `
+		SELECT ` + subscriptionColumns + ` FROM s`
+}
+
+// insertEvents - продолжение WITH, которое пишет в outbox событие typeExpr (SQL-выражение над s)
+// по каждой строке s. В s должны быть колонки subscriptionColumns
+func insertEvents(typeExpr string) string {
+	return `, e AS (
+			INSERT INTO subscription_events (type, ` + subscriptionColumns + `)
+			SELECT ` + typeExpr + `, ` + subscriptionColumns + ` FROM s
+		)`
+}
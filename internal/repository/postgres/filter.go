@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// whereBuilder собирает WHERE из условий, значения всегда уходят параметрами ($n)
+type whereBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg добавляет значение в список аргументов и возвращает его плейсхолдер
+func (b *whereBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *whereBuilder) add(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *whereBuilder) sql() string {
+	if len(b.conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(b.conds, " AND ")
+}
+
+// applyFilter добавляет условия фильтра. Все условия объединяются через AND
+func (b *whereBuilder) applyFilter(f repository.SubscriptionFilter) {
+	if f.UserID != nil {
+		b.add("user_id = " + b.arg(*f.UserID))
+	}
+	if len(f.UserIDs) > 0 {
+		b.add("user_id = ANY(" + b.arg(f.UserIDs) + "::uuid[])")
+	}
+	if f.ServiceName != nil {
+		b.add("service_name = " + b.arg(*f.ServiceName))
+	}
+	if len(f.ServiceNames) > 0 {
+		b.add("service_name = ANY(" + b.arg(f.ServiceNames) + "::text[])")
+	}
+	if f.ServiceNameContains != nil {
+		b.add("service_name ILIKE '%' || " + b.arg(escapeLike(*f.ServiceNameContains)) + " || '%'")
+	}
+	if f.PriceMin != nil {
+		b.add("price >= " + b.arg(*f.PriceMin))
+	}
+	if f.PriceMax != nil {
+		b.add("price <= " + b.arg(*f.PriceMax))
+	}
+	if f.StartFrom != nil {
+		b.add("start_date >= " + b.arg(*f.StartFrom) + "::date")
+	}
+	if f.StartTo != nil {
+		b.add("start_date <= " + b.arg(*f.StartTo) + "::date")
+	}
+	if f.EndFrom != nil {
+		b.add("end_date >= " + b.arg(*f.EndFrom) + "::date")
+	}
+	if f.EndTo != nil {
+		b.add("end_date <= " + b.arg(*f.EndTo) + "::date")
+	}
+	if f.ActiveAt != nil {
+		p := b.arg(*f.ActiveAt)
+		b.add("start_date <= " + p + "::date AND " + paidSince(p))
+	}
+	if f.OpenEnded {
+		b.add("end_date IS NULL")
+	}
+	if f.AutoRenew != nil {
+		b.add("auto_renew = " + b.arg(*f.AutoRenew))
+	}
+	if f.RenewsFrom != nil {
+		b.add("auto_renew AND end_date >= " + b.arg(*f.RenewsFrom) + "::date")
+	}
+	if f.RenewsTo != nil {
+		b.add("auto_renew AND end_date <= " + b.arg(*f.RenewsTo) + "::date")
+	}
+	if f.EndsFrom != nil {
+		b.add("NOT auto_renew AND end_date >= " + b.arg(*f.EndsFrom) + "::date")
+	}
+	if f.EndsTo != nil {
+		b.add("NOT auto_renew AND end_date <= " + b.arg(*f.EndsTo) + "::date")
+	}
+	if f.NotContinued {
+		b.add("NOT EXISTS (SELECT 1 FROM subscriptions n WHERE n.previous_id = subscriptions.id)")
+	}
+}
+
+// escapeLike экранирует спецсимволы LIKE, чтобы строка искалась буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
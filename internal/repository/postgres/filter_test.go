@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestApplyFilter(t *testing.T) {
+	userID, otherID := uuid.New(), uuid.New()
+	month := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	name, contains := "Netflix", "50%_off"
+	price, yes := 100, true
+
+	tests := []struct {
+		name     string
+		filter   repository.SubscriptionFilter
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"empty", repository.SubscriptionFilter{}, "TRUE", nil},
+		{
+			name:     "single user and service",
+			filter:   repository.SubscriptionFilter{UserID: &userID, ServiceName: &name},
+			wantSQL:  "user_id = $1 AND service_name = $2",
+			wantArgs: []any{userID, "Netflix"},
+		},
+		{
+			name:     "any of several",
+			filter:   repository.SubscriptionFilter{UserIDs: []uuid.UUID{userID, otherID}, ServiceNames: []string{"Netflix", "Kion"}},
+			wantSQL:  "user_id = ANY($1::uuid[]) AND service_name = ANY($2::text[])",
+			wantArgs: []any{[]uuid.UUID{userID, otherID}, []string{"Netflix", "Kion"}},
+		},
+		{
+			name:     "substring escapes LIKE wildcards",
+			filter:   repository.SubscriptionFilter{ServiceNameContains: &contains},
+			wantSQL:  "service_name ILIKE '%' || $1 || '%'",
+			wantArgs: []any{`50\%\_off`},
+		},
+		{
+			name:     "price and dates",
+			filter:   repository.SubscriptionFilter{PriceMin: &price, PriceMax: &price, StartFrom: &month, EndTo: &month},
+			wantSQL:  "price >= $1 AND price <= $2 AND start_date >= $3::date AND end_date <= $4::date",
+			wantArgs: []any{100, 100, month, month},
+		},
+		{
+			name:     "active at month",
+			filter:   repository.SubscriptionFilter{ActiveAt: &month},
+			wantSQL:  "start_date <= $1::date AND (auto_renew OR end_date IS NULL OR end_date >= $1::date)",
+			wantArgs: []any{month},
+		},
+		{
+			name:     "open-ended with auto-renew",
+			filter:   repository.SubscriptionFilter{OpenEnded: true, AutoRenew: &yes},
+			wantSQL:  "end_date IS NULL AND auto_renew = $1",
+			wantArgs: []any{true},
+		},
+		{
+			name:     "renews window",
+			filter:   repository.SubscriptionFilter{RenewsFrom: &month, RenewsTo: &month},
+			wantSQL:  "auto_renew AND end_date >= $1::date AND auto_renew AND end_date <= $2::date",
+			wantArgs: []any{month, month},
+		},
+		{
+			name:     "ends window",
+			filter:   repository.SubscriptionFilter{EndsFrom: &month, EndsTo: &month},
+			wantSQL:  "NOT auto_renew AND end_date >= $1::date AND NOT auto_renew AND end_date <= $2::date",
+			wantArgs: []any{month, month},
+		},
+		{
+			name:    "not continued",
+			filter:  repository.SubscriptionFilter{NotContinued: true},
+			wantSQL: "NOT EXISTS (SELECT 1 FROM subscriptions n WHERE n.previous_id = subscriptions.id)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b whereBuilder
+			b.applyFilter(tt.filter)
+			if got := b.sql(); got != tt.wantSQL {
+				t.Errorf("applyFilter() sql =\n%s\nwant\n%s", got, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("applyFilter() args = %v, want %v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
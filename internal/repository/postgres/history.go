@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// queueHistory кладет запись истории в батч, снимки подписок хранятся в jsonb
+func queueHistory(batch *pgx.Batch, e repository.HistoryEntry) {
+	query := `
+		INSERT INTO subscription_history (subscription_id, action, related_ids, before, after)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	related := e.RelatedIDs
+	if related == nil {
+		related = []uuid.UUID{}
+	}
+	batch.Queue(query, e.SubscriptionID, string(e.Action), related, e.Before, e.After)
+}
+
+func (r *SubscriptionRepository) History(ctx context.Context, id uuid.UUID) ([]repository.HistoryEntry, error) {
+	query := `
+		SELECT id, subscription_id, action, related_ids, before, after, created_at
+		FROM subscription_history
+		WHERE subscription_id = $1
+		ORDER BY id ASC
+	`
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription history: %w", err)
+	}
+	defer rows.Close()
+
+	var result []repository.HistoryEntry
+	for rows.Next() {
+		var e repository.HistoryEntry
+		var action string
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.SubscriptionID, &action, &e.RelatedIDs, &before, &after, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription history: %w", err)
+		}
+		e.Action = repository.HistoryAction(action)
+		if e.Before, err = unmarshalSnapshot(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = unmarshalSnapshot(after); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+func unmarshalSnapshot(data []byte) (*domain.Subscription, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var sub domain.Subscription
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription snapshot: %w", err)
+	}
+	return &sub, nil
+}
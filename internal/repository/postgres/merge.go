@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// lockSubscriptions читает и блокирует подписки до конца транзакции.
+// Блокируем в порядке id, чтобы параллельные merge не взаимоблокировались
+func lockSubscriptions(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (map[uuid.UUID]domain.Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
+		WHERE id = ANY($1::uuid[])
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock subscriptions: %w", err)
+	}
+	subs, err := collectSubscriptions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uuid.UUID]domain.Subscription, len(subs))
+	for _, s := range subs {
+		result[s.ID] = s
+	}
+	for _, id := range ids {
+		if _, ok := result[id]; !ok {
+			return nil, repository.ErrNotFound
+		}
+	}
+	return result, nil
+}
+
+// execBatch выполняет батч в транзакции и проверяет результат каждого запроса
+func execBatch(ctx context.Context, tx pgx.Tx, batch *pgx.Batch) error {
+	results := tx.SendBatch(ctx, batch)
+	for range batch.Len() {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			return err
+		}
+	}
+	return results.Close()
+}
+
+func (r *SubscriptionRepository) Merge(ctx context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID, merge repository.MergeFunc) (*domain.Subscription, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // после Commit ничего не делает
+
+	locked, err := lockSubscriptions(ctx, tx, append([]uuid.UUID{targetID}, sourceIDs...))
+	if err != nil {
+		return nil, err
+	}
+	target := locked[targetID]
+	sources := make([]domain.Subscription, 0, len(sourceIDs))
+	for _, id := range sourceIDs {
+		sources = append(sources, locked[id])
+	}
+
+	merged, err := merge(target, sources)
+	if err != nil {
+		return nil, err
+	}
+	merged.ID, merged.CreatedAt = target.ID, target.CreatedAt
+
+	batch := &pgx.Batch{}
+	batch.Queue(withEvent(updateSubscriptionQuery, domain.EventSubscriptionUpdated), updateArgs(&merged)...)
+	for i := range sources {
+		batch.Queue(withEvent(deleteSubscriptionQuery, domain.EventSubscriptionDeleted), sources[i].ID)
+	}
+	queueHistory(batch, repository.HistoryEntry{
+		SubscriptionID: target.ID,
+		Action:         repository.HistoryMerge,
+		RelatedIDs:     sourceIDs,
+		Before:         &target,
+		After:          &merged,
+	})
+	for i := range sources {
+		queueHistory(batch, repository.HistoryEntry{
+			SubscriptionID: sources[i].ID,
+			Action:         repository.HistoryMergedInto,
+			RelatedIDs:     []uuid.UUID{target.ID},
+			Before:         &sources[i],
+		})
+	}
+	if err := execBatch(ctx, tx, batch); err != nil {
+		return nil, fmt.Errorf("failed to merge subscriptions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	return &merged, nil
+}
+
+func (r *SubscriptionRepository) Split(ctx context.Context, id uuid.UUID, action repository.HistoryAction, split repository.SplitFunc) (*domain.Subscription, *domain.Subscription, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // после Commit ничего не делает
+
+	locked, err := lockSubscriptions(ctx, tx, []uuid.UUID{id})
+	if err != nil {
+		return nil, nil, err
+	}
+	orig := locked[id]
+
+	first, second, err := split(orig)
+	if err != nil {
+		return nil, nil, err
+	}
+	first.ID, first.CreatedAt = orig.ID, orig.CreatedAt
+
+	if _, err := tx.Exec(ctx, withEvent(updateSubscriptionQuery, domain.EventSubscriptionUpdated), updateArgs(&first)...); err != nil {
+		return nil, nil, fmt.Errorf("failed to split subscription: %w", err)
+	}
+	second, err = scanSubscription(tx.QueryRow(ctx, withEvent(insertSubscriptionQuery, domain.EventSubscriptionCreated), insertArgs(&second)...))
+	if isUniqueViolation(err) {
+		return nil, nil, repository.ErrConflict
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to split subscription: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	queueHistory(batch, repository.HistoryEntry{
+		SubscriptionID: first.ID,
+		Action:         action,
+		RelatedIDs:     []uuid.UUID{second.ID},
+		Before:         &orig,
+		After:          &first,
+	})
+	queueHistory(batch, repository.HistoryEntry{
+		SubscriptionID: second.ID,
+		Action:         repository.CounterpartAction(action),
+		RelatedIDs:     []uuid.UUID{first.ID},
+		After:          &second,
+	})
+	if err := execBatch(ctx, tx, batch); err != nil {
+		return nil, nil, fmt.Errorf("failed to write subscription history: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit split: %w", err)
+	}
+	return &first, &second, nil
+}
+
+func (r *SubscriptionRepository) Change(ctx context.Context, id uuid.UUID, action repository.HistoryAction, change repository.ChangeFunc) (*domain.Subscription, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // после Commit ничего не делает
+
+	locked, err := lockSubscriptions(ctx, tx, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+	before := locked[id]
+
+	after, err := change(before)
+	if err != nil {
+		return nil, err
+	}
+	after.ID, after.CreatedAt = before.ID, before.CreatedAt
+
+	batch := &pgx.Batch{}
+	batch.Queue(updateSubscriptionQuery, updateArgs(&after)...)
+	// canceled_at не входит в обычное обновление: PUT не должен его затирать.
+	// Событие - от второго запроса, когда подписка уже в итоговом состоянии
+	batch.Queue(withEvent(`UPDATE subscriptions SET canceled_at = $2 WHERE id = $1`, domain.EventSubscriptionUpdated), after.ID, after.CanceledAt)
+	queueHistory(batch, repository.HistoryEntry{
+		SubscriptionID: after.ID,
+		Action:         action,
+		Before:         &before,
+		After:          &after,
+	})
+	if err := execBatch(ctx, tx, batch); err != nil {
+		return nil, fmt.Errorf("failed to %s subscription: %w", action, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit %s: %w", action, err)
+	}
+	return &after, nil
+}
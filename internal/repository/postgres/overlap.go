@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// интервалы [start_date, end_date] пересекаются, бессрочная подписка длится до OpenEndDate
+const overlapCondition = `
+	a.start_date <= COALESCE(b.end_date, DATE '9999-12-01')
+	AND b.start_date <= COALESCE(a.end_date, DATE '9999-12-01')
+`
+
+// querier - общее у пула и транзакции
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// withOverlapCheck выполняет write в транзакции под блокировкой пар пользователь+сервис (см. lockOverlapKeys).
+// Если задан check, перед записью ищет пересечения и вызывает check. Блокировка берется и без check:
+// иначе запись при политике allow (или из другого запроса) проходит между проверкой и вставкой
+// запроса с reject, и обе пересекающиеся подписки сохраняются
+func (r *SubscriptionRepository) withOverlapCheck(ctx context.Context, sub domain.Subscription, check repository.OverlapCheck, write func(q querier) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // после Commit ничего не делает
+
+	if err := lockOverlapKeys(ctx, tx, []domain.Subscription{sub}); err != nil {
+		return err
+	}
+	if check != nil {
+		overlaps, err := findOverlapping(ctx, tx, sub)
+		if err != nil {
+			return err
+		}
+		if err := check(overlaps); err != nil {
+			return err
+		}
+	}
+	if err := write(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit subscription: %w", err)
+	}
+	return nil
+}
+
+// lockOverlapKeys блокирует до конца транзакции пары пользователь+сервис сохраняемых подписок (advisory lock,
+// сервис без учета регистра, как в FindOverlapping). Для подписки, которая уже есть в базе, блокируется и ее
+// прежняя пара: update может перенести ее к другому пользователю или сервису, и запрос, проверяющий прежнюю
+// пару, должен дождаться переноса. Ключи берутся по возрастанию, чтобы транзакции с общими парами
+// не ждали друг друга по кругу; pg_advisory_xact_lock как volatile-функция вычисляется уже после сортировки
+func lockOverlapKeys(ctx context.Context, q querier, subs []domain.Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(subs))
+	users := make([]uuid.UUID, 0, len(subs))
+	services := make([]string, 0, len(subs))
+	for _, s := range subs {
+		ids = append(ids, s.ID)
+		users = append(users, s.UserID)
+		services = append(services, s.ServiceName)
+	}
+
+	query := `
+		SELECT pg_advisory_xact_lock(k) FROM (
+			SELECT hashtextextended(n.user_id::text || ':' || lower(n.service_name), 0) AS k
+			FROM unnest($2::uuid[], $3::text[]) AS n(user_id, service_name)
+			UNION
+			SELECT hashtextextended(user_id::text || ':' || lower(service_name), 0)
+			FROM subscriptions WHERE id = ANY($1)
+		) keys
+		ORDER BY k
+	`
+	if _, err := q.Exec(ctx, query, ids, users, services); err != nil {
+		return fmt.Errorf("failed to lock subscriptions of user and service: %w", err)
+	}
+	return nil
+}
+
+func (r *SubscriptionRepository) FindOverlapping(ctx context.Context, sub domain.Subscription) ([]domain.Subscription, error) {
+	return findOverlapping(ctx, r.pool, sub)
+}
+
+func findOverlapping(ctx context.Context, q querier, sub domain.Subscription) ([]domain.Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
+		WHERE user_id = $1
+		  AND lower(service_name) = lower($2)
+		  AND id <> $3
+		  AND start_date <= COALESCE($4::date, DATE '9999-12-01')
+		  AND COALESCE(end_date, DATE '9999-12-01') >= $5::date
+		ORDER BY start_date ASC, id ASC
+	`
+	rows, err := q.Query(ctx, query, sub.UserID, sub.ServiceName, sub.ID, sub.EndDate, sub.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find overlapping subscriptions: %w", err)
+	}
+	return collectSubscriptions(rows)
+}
+
+func (r *SubscriptionRepository) FindOverlapPairs(ctx context.Context, filter repository.SubscriptionFilter) ([]repository.OverlapPair, error) {
+	var b whereBuilder
+	b.applyFilter(filter)
+
+	query := `
+		WITH s AS (
+			SELECT ` + subscriptionColumns + ` FROM subscriptions
+			WHERE ` + b.sql() + `
+		)
+		SELECT a.*, b.*
+		FROM s a
+		JOIN s b ON b.user_id = a.user_id
+		        AND lower(b.service_name) = lower(a.service_name)
+		        AND (b.start_date, b.id) > (a.start_date, a.id)
+		WHERE ` + overlapCondition + `
+		ORDER BY a.user_id, lower(a.service_name), a.start_date, a.id, b.start_date, b.id
+	`
+	rows, err := r.pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find overlapping subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var result []repository.OverlapPair
+	for rows.Next() {
+		var p repository.OverlapPair
+		// в s ровно колонки subscriptionColumns, поэтому a.*, b.* сканируются как две подписки подряд
+		if err := rows.Scan(append(subscriptionDest(&p.First), subscriptionDest(&p.Second)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan overlapping subscriptions: %w", err)
+		}
+		result = append(result, p)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
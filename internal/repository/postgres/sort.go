@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// sortColumn - SQL-выражение и тип для поля сортировки. В запрос попадают только выражения
+// из этой таблицы, значения курсора идут параметрами, поэтому инъекция невозможна
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+var sortColumns = map[repository.SortField]sortColumn{
+	repository.SortStartDate: {expr: "start_date", cast: "date"},
+	// NULL (бессрочная) заменяем на дату из будущего, чтобы keyset-сравнения работали без NULL
+	repository.SortEndDate:     {expr: "COALESCE(end_date, DATE '" + repository.OpenEndDate.Format("2006-01-02") + "')", cast: "date"},
+	repository.SortPrice:       {expr: "price", cast: "int"},
+	repository.SortServiceName: {expr: "service_name", cast: "text"},
+	repository.SortCreatedAt:   {expr: "created_at", cast: "timestamptz"},
+}
+
+// orderBy строит ORDER BY по ключам сортировки, id ASC в конце делает порядок однозначным
+func orderBy(keys []repository.SortKey) (string, error) {
+	parts := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		col, ok := sortColumns[k.Field]
+		if !ok {
+			return "", fmt.Errorf("unknown sort field %q", k.Field)
+		}
+		dir := "ASC"
+		if k.Desc {
+			dir = "DESC"
+		}
+		parts = append(parts, col.expr+" "+dir)
+	}
+	parts = append(parts, "id ASC")
+	return strings.Join(parts, ", "), nil
+}
+
+// applyCursor добавляет keyset-условие "строка идет после курсора" для заданного порядка:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... OR (k1 = v1 AND ... AND id > cid),
+// где для DESC-ключей сравнение меняется на "<"
+func (b *whereBuilder) applyCursor(keys []repository.SortKey, cur *repository.Cursor) error {
+	if len(cur.Values) != len(keys) {
+		return fmt.Errorf("cursor does not match sort")
+	}
+
+	var ors []string
+	var eqs []string
+	for i, k := range keys {
+		col := sortColumns[k.Field]
+		p := b.arg(cur.Values[i]) + "::text::" + col.cast // значение курсора всегда строка
+		op := ">"
+		if k.Desc {
+			op = "<"
+		}
+		ors = append(ors, "("+strings.Join(append(append([]string{}, eqs...), col.expr+" "+op+" "+p), " AND ")+")")
+		eqs = append(eqs, col.expr+" = "+p)
+	}
+	ors = append(ors, "("+strings.Join(append(eqs, "id > "+b.arg(cur.ID)), " AND ")+")")
+
+	b.add("(" + strings.Join(ors, " OR ") + ")")
+	return nil
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestApplyCursor(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		name     string
+		keys     []repository.SortKey
+		values   []string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "single ascending key",
+			keys:     []repository.SortKey{{Field: repository.SortPrice}},
+			values:   []string{"400"},
+			wantSQL:  "((price > $1::text::int) OR (price = $1::text::int AND id > $2))",
+			wantArgs: []any{"400", id},
+		},
+		{
+			name:   "default sort",
+			keys:   repository.DefaultSort,
+			values: []string{"2025-07-01", "Netflix"},
+			wantSQL: "((start_date < $1::text::date)" +
+				" OR (start_date = $1::text::date AND service_name > $2::text::text)" +
+				" OR (start_date = $1::text::date AND service_name = $2::text::text AND id > $3))",
+			wantArgs: []any{"2025-07-01", "Netflix", id},
+		},
+		{
+			name:   "open end date",
+			keys:   []repository.SortKey{{Field: repository.SortEndDate, Desc: true}},
+			values: []string{"9999-12-01"},
+			wantSQL: "((COALESCE(end_date, DATE '9999-12-01') < $1::text::date)" +
+				" OR (COALESCE(end_date, DATE '9999-12-01') = $1::text::date AND id > $2))",
+			wantArgs: []any{"9999-12-01", id},
+		},
+		{
+			name:     "no keys",
+			keys:     nil,
+			values:   nil,
+			wantSQL:  "((id > $1))",
+			wantArgs: []any{id},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b whereBuilder
+			if err := b.applyCursor(tt.keys, &repository.Cursor{Values: tt.values, ID: id}); err != nil {
+				t.Fatalf("applyCursor() error = %v", err)
+			}
+			if got := b.sql(); got != tt.wantSQL {
+				t.Errorf("applyCursor() sql =\n%s\nwant\n%s", got, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("applyCursor() args = %v, want %v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestApplyCursorMismatch(t *testing.T) {
+	var b whereBuilder
+	err := b.applyCursor(repository.DefaultSort, &repository.Cursor{Values: []string{"2025-07-01"}, ID: uuid.New()})
+	if err == nil {
+		t.Fatal("applyCursor() error = nil, want mismatch")
+	}
+	if len(b.conds) != 0 {
+		t.Errorf("applyCursor() added conditions on error: %v", b.conds)
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []repository.SortKey
+		want    string
+		wantErr bool
+	}{
+		{"default sort", repository.DefaultSort, "start_date DESC, service_name ASC, id ASC", false},
+		{"open end sorted as far future", []repository.SortKey{{Field: repository.SortEndDate}}, "COALESCE(end_date, DATE '9999-12-01') ASC, id ASC", false},
+		{"no keys", nil, "id ASC", false},
+		{"unknown field", []repository.SortKey{{Field: "user_id; DROP TABLE subscriptions"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderBy(tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("orderBy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("orderBy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
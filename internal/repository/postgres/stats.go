@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func (r *SubscriptionRepository) MonthlySpendByUser(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) ([]repository.UserMonthSpend, error) {
+	var b whereBuilder
+	fromArg, toArg := b.arg(from), b.arg(to)
+	b.add("start_date <= m.month")
+	b.add(paidSince("m.month"))
+	b.applyFilter(filter)
+
+	query := `
+		SELECT user_id, m.month::date, sum(price)::int
+		FROM subscriptions
+		JOIN generate_series(` + fromArg + `::date, ` + toArg + `::date, interval '1 month') AS m(month) ON TRUE
+		WHERE ` + b.sql() + `
+		GROUP BY user_id, m.month
+		ORDER BY user_id, m.month`
+
+	rows, err := r.pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calc monthly spend by user: %w", err)
+	}
+	defer rows.Close()
+
+	var result []repository.UserMonthSpend
+	for rows.Next() {
+		var s repository.UserMonthSpend
+		if err := rows.Scan(&s.UserID, &s.Month, &s.Spend); err != nil {
+			return nil, fmt.Errorf("failed to scan monthly spend: %w", err)
+		}
+		result = append(result, s)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
@@ -2,15 +2,31 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/wsppppp/data-aggregation/internal/domain"
 	"github.com/wsppppp/data-aggregation/internal/repository"
 )
 
+const (
+	insertSubscriptionQuery = `
+		INSERT INTO subscriptions (id, user_id, service_name, price, start_date, end_date, plan, previous_id, auto_renew)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	updateSubscriptionQuery = `
+		UPDATE subscriptions
+		SET user_id = $2, service_name = $3, price = $4, start_date = $5, end_date = $6, plan = $7, auto_renew = $8
+		WHERE id = $1
+	`
+	deleteSubscriptionQuery = `DELETE FROM subscriptions WHERE id = $1`
+)
+
 type SubscriptionRepository struct {
 	pool *pgxpool.Pool
 }
@@ -19,160 +35,307 @@ func NewSubscriptionRepository(pool *pgxpool.Pool) *SubscriptionRepository {
 	return &SubscriptionRepository{pool: pool}
 }
 
-func (r *SubscriptionRepository) Create(ctx context.Context, sub *domain.Subscription) error {
+func (r *SubscriptionRepository) Create(ctx context.Context, sub *domain.Subscription, check repository.OverlapCheck) error {
+	return r.withOverlapCheck(ctx, *sub, check, func(q querier) error {
+		query := withEvent(insertSubscriptionQuery, domain.EventSubscriptionCreated)
+		created, err := scanSubscription(q.QueryRow(ctx, query, insertArgs(sub)...))
+		if isUniqueViolation(err) {
+			return repository.ErrConflict
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
+		}
+		*sub = created
+		return nil
+	})
+}
+
+func (r *SubscriptionRepository) Upsert(ctx context.Context, sub *domain.Subscription, check repository.OverlapCheck) (bool, error) {
+	// xmax = 0 только у только что вставленной строки, у обновленной в нем id текущей транзакции
 	query := `
-		INSERT INTO subscriptions (id, user_id, service_name, price, start_date, end_date)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		WITH s AS (
+		` + insertSubscriptionQuery + `
+		ON CONFLICT (id) DO UPDATE
+		SET user_id = EXCLUDED.user_id,
+		    service_name = EXCLUDED.service_name,
+		    price = EXCLUDED.price,
+		    start_date = EXCLUDED.start_date,
+		    end_date = EXCLUDED.end_date,
+		    plan = EXCLUDED.plan,
+		    auto_renew = EXCLUDED.auto_renew
+		RETURNING ` + subscriptionColumns + `, (xmax = 0) AS inserted
+		)` + insertEvents(`CASE WHEN inserted THEN '`+domain.EventSubscriptionCreated+`' ELSE '`+domain.EventSubscriptionUpdated+`' END`) + `
+		SELECT created_at, previous_id, canceled_at, inserted FROM s
 	`
-	_, err := r.pool.Exec(ctx, query,
-		sub.ID,
-		sub.UserID,
-		sub.ServiceName,
-		sub.Price,
-		sub.StartDate,
-		sub.EndDate,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create subscription: %w", err)
-	}
-	return nil
+	var created bool
+	err := r.withOverlapCheck(ctx, *sub, check, func(q querier) error {
+		err := q.QueryRow(ctx, query, insertArgs(sub)...).Scan(&sub.CreatedAt, &sub.PreviousID, &sub.CanceledAt, &created)
+		if err != nil {
+			return fmt.Errorf("failed to upsert subscription: %w", err)
+		}
+		return nil
+	})
+	return created, err
 }
 
 func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Subscription, error) {
 	query := `
-		SELECT * FROM subscriptions
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
 		WHERE id = $1
 	`
-	row := r.pool.QueryRow(ctx, query, id)
-
-	var sub domain.Subscription
-	var endDate *time.Time
-	if err := row.Scan(
-		&sub.ID,
-		&sub.UserID,
-		&sub.ServiceName,
-		&sub.Price,
-		&sub.StartDate,
-		&endDate,
-	); err != nil {
+	sub, err := scanSubscription(r.pool.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to get subscription: %w", err)
 	}
-	sub.EndDate = endDate
 	return &sub, nil
 }
 
-func (r *SubscriptionRepository) Update(ctx context.Context, sub *domain.Subscription) error {
-	query := `
-		UPDATE subscriptions
-		SET user_id = $2, service_name = $3, price = $4, start_date = $5, end_date = $6
-		WHERE id = $1
-	`
-	ct, err := r.pool.Exec(ctx, query,
-		sub.ID,
-		sub.UserID,
-		sub.ServiceName,
-		sub.Price,
-		sub.StartDate,
-		sub.EndDate,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update subscription: %w", err)
+func (r *SubscriptionRepository) Update(ctx context.Context, sub *domain.Subscription, check repository.OverlapCheck) error {
+	return r.withOverlapCheck(ctx, *sub, check, func(q querier) error {
+		query := withEvent(updateSubscriptionQuery, domain.EventSubscriptionUpdated)
+		updated, err := scanSubscription(q.QueryRow(ctx, query, updateArgs(sub)...))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repository.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+		*sub = updated
+		return nil
+	})
+}
+
+func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) (*domain.Subscription, error) {
+	query := withEvent(deleteSubscriptionQuery, domain.EventSubscriptionDeleted)
+	sub, err := scanSubscription(r.pool.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrNotFound
 	}
-	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("subscription not found")
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete subscription: %w", err)
 	}
-	return nil
+	return &sub, nil
 }
 
-func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM subscriptions WHERE id = $1`
-	ct, err := r.pool.Exec(ctx, query, id)
+func (r *SubscriptionRepository) List(ctx context.Context, filter repository.SubscriptionFilter, page repository.Page) ([]domain.Subscription, error) {
+	var b whereBuilder
+	b.applyFilter(filter)
+
+	sort := page.Sort
+	if len(sort) == 0 {
+		sort = repository.DefaultSort
+	}
+	order, err := orderBy(sort)
 	if err != nil {
-		return fmt.Errorf("failed to delete subscription: %w", err)
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
 	}
-	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("subscription not found")
+
+	offset := page.Offset
+	if page.After != nil {
+		offset = 0
+		if err := b.applyCursor(sort, page.After); err != nil {
+			return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+		}
 	}
-	return nil
-}
 
-func (r *SubscriptionRepository) List(ctx context.Context, filter repository.SubscriptionFilter, limit, offset int) ([]domain.Subscription, error) {
 	query := `
-		SELECT * FROM subscriptions
-		WHERE 1=1
-		  AND ($1::uuid IS NULL OR user_id = $1::uuid)
-		  AND ($2::text IS NULL OR service_name = $2::text)
-		ORDER BY start_date DESC, service_name ASC
-		LIMIT $3 OFFSET $4
-	`
-	var userID *uuid.UUID
-	if filter.UserID != nil {
-		userID = filter.UserID
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
+		WHERE ` + b.sql() + `
+		ORDER BY ` + order + `
+		LIMIT ` + b.arg(page.Limit) + ` OFFSET ` + b.arg(offset)
+
+	rows, err := r.pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
 	}
-	var serviceName *string
-	if filter.ServiceName != nil {
-		serviceName = filter.ServiceName
+	return collectSubscriptions(rows)
+}
+
+func (r *SubscriptionRepository) Stream(ctx context.Context, filter repository.SubscriptionFilter, sort []repository.SortKey, fn func(domain.Subscription) error) error {
+	var b whereBuilder
+	b.applyFilter(filter)
+
+	if len(sort) == 0 {
+		sort = repository.DefaultSort
 	}
+	order, err := orderBy(sort)
+	if err != nil {
+		return fmt.Errorf("failed to stream subscriptions: %w", err)
+	}
+
+	query := `
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
+		WHERE ` + b.sql() + `
+		ORDER BY ` + order
 
-	rows, err := r.pool.Query(ctx, query, userID, serviceName, limit, offset)
+	rows, err := r.pool.Query(ctx, query, b.args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+		return fmt.Errorf("failed to stream subscriptions: %w", err)
 	}
 	defer rows.Close()
 
-	var result []domain.Subscription
 	for rows.Next() {
-		var s domain.Subscription
-		var endDate *time.Time
-		if err := rows.Scan(
-			&s.ID, &s.UserID, &s.ServiceName, &s.Price, &s.StartDate, &endDate,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		if err := fn(s); err != nil {
+			return err
 		}
-		s.EndDate = endDate
-		result = append(result, s)
 	}
 	if rows.Err() != nil {
-		return nil, fmt.Errorf("rows error: %w", rows.Err())
+		return fmt.Errorf("rows error: %w", rows.Err())
 	}
-	return result, nil
+	return nil
+}
+
+func (r *SubscriptionRepository) Count(ctx context.Context, filter repository.SubscriptionFilter) (int, error) {
+	var b whereBuilder
+	b.applyFilter(filter)
+
+	query := `SELECT count(*) FROM subscriptions WHERE ` + b.sql()
+	var count int
+	if err := r.pool.QueryRow(ctx, query, b.args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+	return count, nil
 }
 
 func (r *SubscriptionRepository) FindActiveInPeriod(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) ([]domain.Subscription, error) {
+	var b whereBuilder
+	b.add("start_date <= " + b.arg(to))
+	b.add(paidSince(b.arg(from)))
+	b.applyFilter(filter)
+
 	query := `
-		SELECT * FROM subscriptions
-		WHERE start_date <= $2
-		  AND (end_date IS NULL OR end_date >= $1)
-		  AND ($3::uuid IS NULL OR user_id = $3::uuid)
-		  AND ($4::text IS NULL OR service_name = $4::text)
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
+		WHERE ` + b.sql() + `
 		ORDER BY start_date ASC, service_name ASC
 	`
 
-	var userID *uuid.UUID
-	if filter.UserID != nil {
-		userID = filter.UserID
+	rows, err := r.pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active subscriptions: %w", err)
 	}
-	var serviceName *string
-	if filter.ServiceName != nil {
-		serviceName = filter.ServiceName
+	return collectSubscriptions(rows)
+}
+
+// paidSince - подписка оплачивается в месяце m или позже: ее EffectiveEnd (end_date без автопродления)
+// не раньше m. Условие то же, что domain.Subscription.EffectiveEnd, для всех расчетов расходов в SQL
+func paidSince(m string) string {
+	return "(auto_renew OR end_date IS NULL OR end_date >= " + m + "::date)"
+}
+
+func (r *SubscriptionRepository) FindSuccessors(ctx context.Context, ids []uuid.UUID, filter repository.SubscriptionFilter) ([]domain.Subscription, error) {
+	var b whereBuilder
+	idsArg := b.arg(ids)
+	b.add("id IN (SELECT id FROM chain)")
+	b.applyFilter(filter)
+
+	query := `
+		WITH RECURSIVE chain(id) AS (
+			SELECT id FROM subscriptions WHERE previous_id = ANY(` + idsArg + `::uuid[])
+			UNION
+			SELECT s.id FROM subscriptions s JOIN chain c ON s.previous_id = c.id
+		)
+		SELECT ` + subscriptionColumns + ` FROM subscriptions
+		WHERE ` + b.sql() + `
+		ORDER BY start_date ASC, service_name ASC
+	`
+	rows, err := r.pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscription successors: %w", err)
+	}
+	return collectSubscriptions(rows)
+}
+
+func (r *SubscriptionRepository) ExistingKeys(ctx context.Context, keys []repository.SubscriptionKey) ([]repository.SubscriptionKey, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	userIDs := make([]uuid.UUID, len(keys))
+	names := make([]string, len(keys))
+	dates := make([]time.Time, len(keys))
+	for i, k := range keys {
+		userIDs[i], names[i], dates[i] = k.UserID, k.ServiceName, k.StartDate
 	}
 
-	rows, err := r.pool.Query(ctx, query, from, to, userID, serviceName)
+	query := `
+		SELECT k.user_id, k.service_name, k.start_date
+		FROM unnest($1::uuid[], $2::text[], $3::date[]) AS k(user_id, service_name, start_date)
+		WHERE EXISTS (
+			SELECT 1 FROM subscriptions s
+			WHERE s.user_id = k.user_id
+			  AND lower(s.service_name) = lower(k.service_name)
+			  AND s.start_date = k.start_date
+		)
+	`
+	rows, err := r.pool.Query(ctx, query, userIDs, names, dates)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find active subscriptions: %w", err)
+		return nil, fmt.Errorf("failed to find existing subscriptions: %w", err)
 	}
 	defer rows.Close()
 
+	var result []repository.SubscriptionKey
+	for rows.Next() {
+		var k repository.SubscriptionKey
+		if err := rows.Scan(&k.UserID, &k.ServiceName, &k.StartDate); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription key: %w", err)
+		}
+		result = append(result, k)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+const uniqueViolationCode = "23505"
+
+// isUniqueViolation - нарушение уникальности (для subscriptions - занятый id)
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
+
+// _________________ сканирование строк _________________
+
+const subscriptionColumns = "id, user_id, service_name, price, start_date, end_date, created_at, plan, previous_id, auto_renew, canceled_at"
+
+// insertArgs - аргументы insertSubscriptionQuery
+func insertArgs(sub *domain.Subscription) []any {
+	return []any{sub.ID, sub.UserID, sub.ServiceName, sub.Price, sub.StartDate, sub.EndDate, sub.Plan, sub.PreviousID, sub.AutoRenew}
+}
+
+// updateArgs - аргументы updateSubscriptionQuery
+func updateArgs(sub *domain.Subscription) []any {
+	return []any{sub.ID, sub.UserID, sub.ServiceName, sub.Price, sub.StartDate, sub.EndDate, sub.Plan, sub.AutoRenew}
+}
+
+// subscriptionDest - куда сканировать колонки subscriptionColumns
+func subscriptionDest(s *domain.Subscription) []any {
+	return []any{&s.ID, &s.UserID, &s.ServiceName, &s.Price, &s.StartDate, &s.EndDate, &s.CreatedAt, &s.Plan, &s.PreviousID, &s.AutoRenew, &s.CanceledAt}
+}
+
+// scanSubscription читает строку, выбранную с колонками subscriptionColumns
+func scanSubscription(row pgx.Row) (domain.Subscription, error) {
+	var s domain.Subscription
+	err := row.Scan(subscriptionDest(&s)...)
+	return s, err
+}
+
+func collectSubscriptions(rows pgx.Rows) ([]domain.Subscription, error) {
+	defer rows.Close()
+
 	var result []domain.Subscription
 	for rows.Next() {
-		var s domain.Subscription
-		var endDate *time.Time
-		if err := rows.Scan(
-			&s.ID, &s.UserID, &s.ServiceName, &s.Price, &s.StartDate, &endDate,
-		); err != nil {
+		s, err := scanSubscription(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan subscription: %w", err)
 		}
-		s.EndDate = endDate
 		result = append(result, s)
 	}
 	if rows.Err() != nil {
@@ -0,0 +1,381 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const (
+	// событие и доставки - одним запросом; без получателей событие не сохраняется
+	addEventQuery = `
+		WITH targets AS (
+			SELECT id FROM webhooks WHERE active AND $2 = ANY(event_types)
+		), e AS (
+			INSERT INTO webhook_events (id, type, subscription_id, payload, dedup_key)
+			SELECT $1, $2, $3, $4, $5
+			WHERE EXISTS (SELECT 1 FROM targets)
+			ON CONFLICT (dedup_key) DO NOTHING
+			RETURNING id
+		)
+		INSERT INTO webhook_deliveries (webhook_id, event_id)
+		SELECT t.id, e.id FROM targets t CROSS JOIN e
+	`
+	webhookColumns  = "id, url, secret, event_types, active, created_at"
+	deliveryColumns = `d.id, d.webhook_id, d.event_id, e.type, e.subscription_id, d.status, d.attempts,
+		d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at`
+)
+
+type WebhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookRepository(pool *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{pool: pool}
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, w *domain.Webhook) error {
+	query := `
+		INSERT INTO webhooks (id, url, secret, event_types, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	if err := r.pool.QueryRow(ctx, query, w.ID, w.URL, w.Secret, w.EventTypes, w.Active).Scan(&w.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+	var w domain.Webhook
+	err := r.pool.QueryRow(ctx, query, id).Scan(webhookDest(&w)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return &w, nil
+}
+
+func (r *WebhookRepository) Update(ctx context.Context, w *domain.Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $2, secret = $3, event_types = $4, active = $5
+		WHERE id = $1
+	`
+	ct, err := r.pool.Exec(ctx, query, w.ID, w.URL, w.Secret, w.EventTypes, w.Active)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return repository.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	ct, err := r.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return repository.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context) ([]domain.Webhook, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var result []domain.Webhook
+	for rows.Next() {
+		var w domain.Webhook
+		if err := rows.Scan(webhookDest(&w)...); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		result = append(result, w)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+func (r *WebhookRepository) AddEvent(ctx context.Context, event domain.WebhookEvent, dedupKey *string) (int, error) {
+	ct, err := r.pool.Exec(ctx, addEventQuery, event.ID, event.Type, event.SubscriptionID, event.Payload, dedupKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add webhook event: %w", err)
+	}
+	return int(ct.RowsAffected()), nil
+}
+
+func (r *WebhookRepository) LastEndedMonth(ctx context.Context) (*time.Time, error) {
+	var month time.Time
+	err := r.pool.QueryRow(ctx, `SELECT last_month FROM webhook_ended_state`).Scan(&month)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last ended month: %w", err)
+	}
+	return &month, nil
+}
+
+func (r *WebhookRepository) SetLastEndedMonth(ctx context.Context, month time.Time) error {
+	query := `
+		INSERT INTO webhook_ended_state (last_month) VALUES ($1)
+		ON CONFLICT (id) DO UPDATE SET last_month = GREATEST(webhook_ended_state.last_month, EXCLUDED.last_month)
+	`
+	if _, err := r.pool.Exec(ctx, query, month); err != nil {
+		return fmt.Errorf("failed to set last ended month: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error) {
+	// доставки удаляются каскадом; события с dead и ожидающими доставками остаются
+	query := `
+		DELETE FROM webhook_events e
+		WHERE e.created_at < $1
+		  AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id AND d.status <> 'delivered')
+	`
+	ct, err := r.pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete delivered webhook events: %w", err)
+	}
+	return ct.RowsAffected(), nil
+}
+
+func (r *WebhookRepository) DispatchEvents(ctx context.Context, limit int, build repository.BuildEventFunc) (int, int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // после Commit ничего не делает
+
+	// SKIP LOCKED - события, которые разбирает другой экземпляр сервиса, пропускаются
+	query := `
+		SELECT seq, type, occurred_at, ` + subscriptionColumns + `
+		FROM subscription_events
+		ORDER BY seq
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := tx.Query(ctx, query, limit)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read subscription events: %w", err)
+	}
+	var events []repository.SubscriptionEvent
+	for rows.Next() {
+		var e repository.SubscriptionEvent
+		dest := append([]any{&e.Seq, &e.Type, &e.OccurredAt}, subscriptionDest(&e.Subscription)...)
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan subscription event: %w", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, 0, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	if len(events) == 0 {
+		return 0, 0, nil
+	}
+
+	// события и удаление из outbox - одним батчем
+	batch := &pgx.Batch{}
+	seqs := make([]int64, len(events))
+	for i, e := range events {
+		event, err := build(e)
+		if err != nil {
+			return 0, 0, err
+		}
+		batch.Queue(addEventQuery, event.ID, event.Type, event.SubscriptionID, event.Payload, nil)
+		seqs[i] = e.Seq
+	}
+	batch.Queue(`DELETE FROM subscription_events WHERE seq = ANY($1)`, seqs)
+
+	deliveries := 0
+	results := tx.SendBatch(ctx, batch)
+	for range batch.Len() {
+		ct, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return 0, 0, fmt.Errorf("failed to dispatch subscription events: %w", err)
+		}
+		if ct.Insert() {
+			deliveries += int(ct.RowsAffected())
+		}
+	}
+	if err := results.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to close batch: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit subscription events: %w", err)
+	}
+	return len(events), deliveries, nil
+}
+
+func (r *WebhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]repository.PendingDelivery, error) {
+	// SKIP LOCKED - несколько экземпляров сервиса не возьмут одну доставку
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = now() + $2::float8 * interval '1 second'
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= now()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT ` + deliveryColumns + `, w.url, w.secret, e.payload
+		FROM claimed d
+		JOIN webhook_events e ON e.id = d.event_id
+		JOIN webhooks w ON w.id = d.webhook_id
+		ORDER BY d.id
+	`
+	rows, err := r.pool.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []repository.PendingDelivery
+	for rows.Next() {
+		var p repository.PendingDelivery
+		dest := append(deliveryDest(&p.Delivery), &p.URL, &p.Secret, &p.Payload)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		result = append(result, p)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id int64, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now()
+		WHERE id = $1
+	`
+	if _, err := r.pool.Exec(ctx, query, id, statusCode); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery delivered: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) MarkFailed(ctx context.Context, id int64, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+		    attempts = attempts + 1,
+		    last_status_code = $2,
+		    last_error = $3,
+		    next_attempt_at = COALESCE($4, next_attempt_at)
+		WHERE id = $1
+	`
+	if _, err := r.pool.Exec(ctx, query, id, statusCode, lastError, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to mark webhook delivery failed: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Deliveries(ctx context.Context, filter repository.DeliveryFilter) ([]domain.WebhookDelivery, error) {
+	var w whereBuilder
+	if filter.WebhookID != nil {
+		w.add("d.webhook_id = " + w.arg(*filter.WebhookID))
+	}
+	if filter.Status != nil {
+		w.add("d.status = " + w.arg(*filter.Status))
+	}
+
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN webhook_events e ON e.id = d.event_id
+		WHERE ` + w.sql() + `
+		ORDER BY d.id DESC
+		LIMIT ` + w.arg(filter.Limit)
+	rows, err := r.pool.Query(ctx, query, w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []domain.WebhookDelivery
+	for rows.Next() {
+		var d domain.WebhookDelivery
+		if err := rows.Scan(deliveryDest(&d)...); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		result = append(result, d)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return result, nil
+}
+
+func (r *WebhookRepository) Redeliver(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	query := `
+		WITH d AS (
+			UPDATE webhook_deliveries
+			SET status = 'pending', attempts = 0, next_attempt_at = now()
+			WHERE id = $1 AND status = 'dead'
+			RETURNING *
+		)
+		SELECT ` + deliveryColumns + `
+		FROM d
+		JOIN webhook_events e ON e.id = d.event_id
+	`
+	var d domain.WebhookDelivery
+	err := r.pool.QueryRow(ctx, query, id).Scan(deliveryDest(&d)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+		}
+		if exists {
+			return nil, repository.ErrDeliveryNotDead
+		}
+		return nil, repository.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook delivery: %w", err)
+	}
+	return &d, nil
+}
+
+// webhookDest - приемники для webhookColumns
+func webhookDest(w *domain.Webhook) []any {
+	return []any{&w.ID, &w.URL, &w.Secret, &w.EventTypes, &w.Active, &w.CreatedAt}
+}
+
+// deliveryDest - приемники для deliveryColumns
+func deliveryDest(d *domain.WebhookDelivery) []any {
+	return []any{
+		&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.SubscriptionID, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt,
+	}
+}
@@ -2,22 +2,401 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/wsppppp/data-aggregation/internal/domain"
 )
 
+var (
+	ErrNotFound = errors.New("subscription not found")
+	ErrConflict = errors.New("subscription with this id already exists")
+
+	ErrBudgetNotFound = errors.New("budget not found")
+	ErrBudgetExists   = errors.New("budget for this user and service already exists")
+
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryNotDead  = errors.New("only dead deliveries can be redelivered")
+)
+
+// SubscriptionFilter - условия отбора подписок, все заданные поля объединяются через AND.
+// Даты - первое число месяца, границы диапазонов включительно
 type SubscriptionFilter struct {
 	UserID      *uuid.UUID
 	ServiceName *string
+
+	UserIDs             []uuid.UUID // любой из
+	ServiceNames        []string    // любой из
+	ServiceNameContains *string     // подстрока без учета регистра
+
+	PriceMin *int
+	PriceMax *int
+
+	StartFrom *time.Time
+	StartTo   *time.Time
+	EndFrom   *time.Time
+	EndTo     *time.Time
+
+	ActiveAt  *time.Time // подписка оплачивается в этом месяце (с автопродлением - и после end_date)
+	OpenEnded bool       // только без end_date
+
+	AutoRenew  *bool
+	RenewsFrom *time.Time // срок (end_date) истекает в окне и подписка продлится
+	RenewsTo   *time.Time
+	EndsFrom   *time.Time // подписка закончится в окне (end_date без автопродления)
+	EndsTo     *time.Time
+
+	NotContinued bool // без продолжения: ни одна подписка не ссылается на нее через previous_id
+}
+
+// SortField - поле, по которому разрешено сортировать листинг (белый список)
+type SortField string
+
+const (
+	SortStartDate   SortField = "start_date"
+	SortEndDate     SortField = "end_date"
+	SortPrice       SortField = "price"
+	SortServiceName SortField = "service_name"
+	SortCreatedAt   SortField = "created_at"
+)
+
+var sortFields = map[SortField]struct{}{
+	SortStartDate:   {},
+	SortEndDate:     {},
+	SortPrice:       {},
+	SortServiceName: {},
+	SortCreatedAt:   {},
+}
+
+// ParseSortField проверяет, что поле есть в белом списке
+func ParseSortField(s string) (SortField, bool) {
+	_, ok := sortFields[SortField(s)]
+	return SortField(s), ok
+}
+
+// OpenEndDate - значение, которым в сортировке и курсоре заменяется end_date = NULL
+var OpenEndDate = time.Date(9999, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+// CursorValue - значение поля подписки в виде строки для курсора
+func (f SortField) CursorValue(s domain.Subscription) string {
+	switch f {
+	case SortStartDate:
+		return s.StartDate.Format(time.DateOnly)
+	case SortEndDate:
+		if s.EndDate == nil {
+			return OpenEndDate.Format(time.DateOnly)
+		}
+		return s.EndDate.Format(time.DateOnly)
+	case SortPrice:
+		return strconv.Itoa(s.Price)
+	case SortServiceName:
+		return s.ServiceName
+	case SortCreatedAt:
+		return s.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+type SortKey struct {
+	Field SortField
+	Desc  bool
+}
+
+// DefaultSort - порядок листинга, если клиент не указал свой. id всегда добавляется последним (ASC)
+var DefaultSort = []SortKey{
+	{Field: SortStartDate, Desc: true},
+	{Field: SortServiceName},
+}
+
+// Cursor - ключ последней отданной строки для keyset-пагинации:
+// значения полей сортировки (в порядке Page.Sort) и id
+type Cursor struct {
+	Values []string
+	ID     uuid.UUID
+}
+
+// NewCursor строит курсор по последней строке страницы
+func NewCursor(sort []SortKey, last domain.Subscription) *Cursor {
+	values := make([]string, len(sort))
+	for i, k := range sort {
+		values[i] = k.Field.CursorValue(last)
+	}
+	return &Cursor{Values: values, ID: last.ID}
+}
+
+// Page - параметры страницы. Если задан After, Offset игнорируется.
+// Пустой Sort означает DefaultSort
+type Page struct {
+	Limit  int
+	Offset int
+	Sort   []SortKey
+	After  *Cursor
+}
+
+// SubscriptionKey - признаки, по которым подписки считаются одинаковыми при импорте
+// (ServiceName сравнивается без учета регистра)
+type SubscriptionKey struct {
+	UserID      uuid.UUID
+	ServiceName string
+	StartDate   time.Time
 }
 
+type BulkOpKind string
+
+const (
+	BulkCreate BulkOpKind = "create"
+	BulkUpdate BulkOpKind = "update"
+	BulkDelete BulkOpKind = "delete"
+)
+
+// BulkOp - одна операция пакетного изменения. Для create/update заполняется Subscription,
+// для delete достаточно ID
+type BulkOp struct {
+	Kind         BulkOpKind
+	ID           uuid.UUID
+	Subscription *domain.Subscription
+	Check        OverlapCheck // для create/update - как в Create, nil - без проверки
+}
+
+// OverlapPair - две подписки одного пользователя на один сервис с пересекающимися интервалами
+type OverlapPair struct {
+	First, Second domain.Subscription
+}
+
+// HistoryAction - операция над подпиской, записанная в историю
+type HistoryAction string
+
+const (
+	HistoryMerge      HistoryAction = "merge"       // в подписку влиты другие (RelatedIDs)
+	HistoryMergedInto HistoryAction = "merged_into" // подписка влита в RelatedIDs[0] и удалена
+	HistorySplit      HistoryAction = "split"       // подписка разделена, вторая часть - RelatedIDs[0]
+	HistorySplitFrom  HistoryAction = "split_from"  // подписка выделена из RelatedIDs[0]
+	// смена тарифа - тот же split: старая подписка заканчивается, новая с другим тарифом ее продолжает
+	HistoryPlanChange     HistoryAction = "plan_change"      // тариф сменен, новая подписка - RelatedIDs[0]
+	HistoryPlanChangeFrom HistoryAction = "plan_change_from" // подписка продолжает RelatedIDs[0] с другим тарифом
+	HistoryCancel         HistoryAction = "cancel"           // отмена: задан end_date, автопродление выключено
+)
+
+// CounterpartAction - действие, которое split или смена тарифа записывает для второй подписки
+func CounterpartAction(action HistoryAction) HistoryAction {
+	if action == HistoryPlanChange {
+		return HistoryPlanChangeFrom
+	}
+	return HistorySplitFrom
+}
+
+type HistoryEntry struct {
+	ID             int64
+	SubscriptionID uuid.UUID
+	Action         HistoryAction
+	RelatedIDs     []uuid.UUID
+	Before         *domain.Subscription // nil - подписки до операции не было
+	After          *domain.Subscription // nil - подписка удалена
+	CreatedAt      time.Time
+}
+
+// MergeFunc получает подписку, в которую сливают, и сливаемые подписки и возвращает итоговую подписку
+type MergeFunc func(target domain.Subscription, sources []domain.Subscription) (domain.Subscription, error)
+
+// ChangeFunc получает текущее состояние подписки и возвращает новое
+type ChangeFunc func(sub domain.Subscription) (domain.Subscription, error)
+
+// OverlapCheck получает пересечения сохраняемой подписки (см. FindOverlapping), найденные в транзакции
+// сохранения под блокировкой пары пользователь+сервис. Ошибка отменяет сохранение
+type OverlapCheck func(overlaps []domain.Subscription) error
+
+// SplitFunc получает исходную подписку и возвращает ее две части: измененную исходную и новую
+type SplitFunc func(sub domain.Subscription) (first, second domain.Subscription, err error)
+
+// UserMonthSpend - расходы пользователя в месяце
+type UserMonthSpend struct {
+	UserID uuid.UUID
+	Month  time.Time
+	Spend  int
+}
+
+// Subscriptions - хранилище подписок. Методы, которые меняют подписки, в той же транзакции
+// пишут события created/updated/deleted в outbox, откуда их забирает Webhooks.DispatchEvents
 type Subscriptions interface {
-	Create(ctx context.Context, sub *domain.Subscription) error
+	// Create возвращает ErrConflict, если подписка с таким id уже есть.
+	// check (nil - без проверки) вызывается до вставки; параллельные сохранения подписок
+	// того же пользователя на тот же сервис выполняются по очереди, с проверкой и без
+	Create(ctx context.Context, sub *domain.Subscription, check OverlapCheck) error
+	// Upsert создает подписку или обновляет существующую с тем же id. created - была ли она создана.
+	// check - как в Create
+	Upsert(ctx context.Context, sub *domain.Subscription, check OverlapCheck) (created bool, err error)
+	// FindOverlapping возвращает другие подписки того же пользователя на тот же сервис
+	// (без учета регистра), интервалы которых пересекаются с sub
+	FindOverlapping(ctx context.Context, sub domain.Subscription) ([]domain.Subscription, error)
+	// FindOverlapPairs возвращает все пары пересекающихся подписок среди подходящих под фильтр
+	FindOverlapPairs(ctx context.Context, filter SubscriptionFilter) ([]OverlapPair, error)
+
+	// Merge в одной транзакции блокирует подписки, сохраняет результат merge в targetID,
+	// удаляет sourceIDs и пишет историю. ErrNotFound, если какой-то подписки нет
+	Merge(ctx context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID, merge MergeFunc) (*domain.Subscription, error)
+	// Split в одной транзакции сохраняет обе части подписки и пишет историю с действием action
+	// (HistorySplit или HistoryPlanChange) и парным ему для второй части
+	Split(ctx context.Context, id uuid.UUID, action HistoryAction, split SplitFunc) (first, second *domain.Subscription, err error)
+	// Change в одной транзакции блокирует подписку, сохраняет результат change
+	// (включая canceled_at) и пишет историю с действием action
+	Change(ctx context.Context, id uuid.UUID, action HistoryAction, change ChangeFunc) (*domain.Subscription, error)
+	// MonthlySpendByUser возвращает помесячные расходы каждого пользователя за [from, to],
+	// упорядоченные по пользователю и месяцу. Месяцы без расходов в выборку не попадают
+	MonthlySpendByUser(ctx context.Context, filter SubscriptionFilter, from, to time.Time) ([]UserMonthSpend, error)
+	// History возвращает историю операций над подпиской в хронологическом порядке
+	History(ctx context.Context, id uuid.UUID) ([]HistoryEntry, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Subscription, error)
-	Update(ctx context.Context, sub *domain.Subscription) error
-	Delete(ctx context.Context, id uuid.UUID) error
-	List(ctx context.Context, filter SubscriptionFilter, limit, offset int) ([]domain.Subscription, error)
+	// Update сохраняет подписку и заполняет sub ее состоянием в БД (created_at, previous_id, canceled_at).
+	// check - как в Create
+	Update(ctx context.Context, sub *domain.Subscription, check OverlapCheck) error
+	// Delete возвращает удаленную подписку
+	Delete(ctx context.Context, id uuid.UUID) (*domain.Subscription, error)
+	List(ctx context.Context, filter SubscriptionFilter, page Page) ([]domain.Subscription, error)
+	Count(ctx context.Context, filter SubscriptionFilter) (int, error)
+	// Stream вызывает fn для каждой подписки по мере чтения из БД, без загрузки всей выборки в память
+	Stream(ctx context.Context, filter SubscriptionFilter, sort []SortKey, fn func(domain.Subscription) error) error
+	// FindActiveInPeriod возвращает подписки, которые оплачиваются хотя бы в одном месяце [from, to]:
+	// начались не позже to и EffectiveEnd не раньше from (с автопродлением - и после end_date)
 	FindActiveInPeriod(ctx context.Context, filter SubscriptionFilter, from, to time.Time) ([]domain.Subscription, error)
+	// FindSuccessors возвращает подписки, продолжающие ids через previous_id (смена тарифа, split),
+	// по всей цепочке продолжений. Цепочка идет через все подписки, в результат попадают подходящие под filter
+	FindSuccessors(ctx context.Context, ids []uuid.UUID, filter SubscriptionFilter) ([]domain.Subscription, error)
+
+	// ExistingKeys возвращает те из ключей, для которых уже есть подписка
+	ExistingKeys(ctx context.Context, keys []SubscriptionKey) ([]SubscriptionKey, error)
+
+	// BulkAtomic выполняет все операции в одной транзакции: при первой ошибке все откатывается,
+	// в ответе - индекс упавшей операции. Оба режима записывают в Subscription каждой выполненной
+	// операции состояние подписки после нее (для удаления - удаленную подписку). Check операции вызывается
+	// перед ней с пересечениями, в которых учтены предыдущие операции пакета; его ошибка - ошибка операции
+	BulkAtomic(ctx context.Context, ops []BulkOp) (failed int, err error)
+	// BulkBestEffort выполняет операции независимо, ошибки возвращаются по каждой операции
+	BulkBestEffort(ctx context.Context, ops []BulkOp) []error
+}
+
+// IdempotencyRecord - сохраненный ответ на запрос с Idempotency-Key.
+// StatusCode = 0 - запрос с этим ключом еще выполняется
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+type IdempotencyKeys interface {
+	// Reserve занимает ключ. Если ключ уже занят и не истек, возвращает его запись и false
+	Reserve(ctx context.Context, key, requestHash string, expiresAt time.Time) (*IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	// Release освобождает ключ, чтобы запрос можно было повторить (например, после 5xx)
+	Release(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// BudgetAlertFilter - условия отбора срабатываний бюджетов, заданные поля объединяются через AND
+type BudgetAlertFilter struct {
+	UserID   *uuid.UUID
+	BudgetID *uuid.UUID
+	From     *time.Time // месяц срабатывания, включительно
+	To       *time.Time
+}
+
+type Budgets interface {
+	// Create возвращает ErrBudgetExists, если у пользователя уже есть бюджет на этот сервис (или общий)
+	Create(ctx context.Context, b *domain.Budget) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Budget, error)
+	Update(ctx context.Context, b *domain.Budget) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	// List возвращает бюджеты пользователя, при userID = nil - все
+	List(ctx context.Context, userID *uuid.UUID) ([]domain.Budget, error)
+
+	// AddAlerts сохраняет срабатывания и возвращает только новые:
+	// порог бюджета срабатывает не больше одного раза за месяц
+	AddAlerts(ctx context.Context, alerts []domain.BudgetAlert) ([]domain.BudgetAlert, error)
+	Alerts(ctx context.Context, filter BudgetAlertFilter) ([]domain.BudgetAlert, error)
+}
+
+// AnomalyFilter - условия отбора аномалий, заданные поля объединяются через AND
+type AnomalyFilter struct {
+	UserID *uuid.UUID
+	Rule   *string
+	From   *time.Time // месяц аномалии, включительно
+	To     *time.Time
+}
+
+type Anomalies interface {
+	// Add сохраняет аномалии и возвращает только новые: правило срабатывает
+	// для пользователя не больше одного раза за месяц
+	Add(ctx context.Context, anomalies []domain.Anomaly) ([]domain.Anomaly, error)
+	List(ctx context.Context, filter AnomalyFilter) ([]domain.Anomaly, error)
+}
+
+// статусы доставки webhook
+const (
+	DeliveryPending   = "pending"   // ждет попытки, в том числе повторной
+	DeliveryDelivered = "delivered" // получатель ответил 2xx
+	DeliveryDead      = "dead"      // попытки исчерпаны, повтор - только вручную
+)
+
+// DeliveryFilter - условия отбора доставок, заданные поля объединяются через AND
+type DeliveryFilter struct {
+	WebhookID *uuid.UUID
+	Status    *string
+	Limit     int
+}
+
+// PendingDelivery - доставка, взятая в работу, со всем, что нужно для запроса
+type PendingDelivery struct {
+	Delivery domain.WebhookDelivery
+	URL      string
+	Secret   string
+	Payload  []byte
+}
+
+// SubscriptionEvent - событие подписки из outbox, сохраненное в одной транзакции с изменением
+type SubscriptionEvent struct {
+	Seq          int64
+	Type         string
+	OccurredAt   time.Time
+	Subscription domain.Subscription // после изменения, у удаленной - перед удалением
+}
+
+// BuildEventFunc превращает событие outbox в событие webhook с готовым телом запроса
+type BuildEventFunc func(e SubscriptionEvent) (domain.WebhookEvent, error)
+
+type Webhooks interface {
+	Create(ctx context.Context, w *domain.Webhook) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error)
+	Update(ctx context.Context, w *domain.Webhook) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context) ([]domain.Webhook, error)
+
+	// AddEvent сохраняет событие и ставит его в доставку всем активным webhook, подписанным на его тип.
+	// Если таких нет или событие с тем же dedupKey уже было, ничего не сохраняется. Возвращает число доставок
+	AddEvent(ctx context.Context, event domain.WebhookEvent, dedupKey *string) (int, error)
+	// DispatchEvents забирает из outbox до limit самых старых событий подписок, ставит каждое
+	// в доставку, как AddEvent, и удаляет их в той же транзакции. Возвращает число событий и доставок
+	DispatchEvents(ctx context.Context, limit int, build BuildEventFunc) (events, deliveries int, err error)
+	// LastEndedMonth возвращает последний месяц, за который опубликованы subscription.ended (nil - еще ни одного).
+	// SetLastEndedMonth запоминает его, более ранний месяц сохраненный не заменяет
+	LastEndedMonth(ctx context.Context) (*time.Time, error)
+	SetLastEndedMonth(ctx context.Context, month time.Time) error
+	// ClaimDeliveries берет в работу до limit доставок, время попытки которых пришло, и откладывает
+	// их следующую попытку на lease: если обработчик упадет, доставка повторится
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingDelivery, error)
+	MarkDelivered(ctx context.Context, id int64, statusCode int) error
+	// MarkFailed записывает неудачную попытку. nextAttemptAt = nil - попытки исчерпаны, доставка dead
+	MarkFailed(ctx context.Context, id int64, statusCode *int, lastError string, nextAttemptAt *time.Time) error
+	// Deliveries возвращает доставки, новые первыми
+	Deliveries(ctx context.Context, filter DeliveryFilter) ([]domain.WebhookDelivery, error)
+	// DeleteDeliveredEvents удаляет события, созданные раньше before, все доставки которых успешны,
+	// вместе с доставками. Возвращает число удаленных событий
+	DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error)
+	// Redeliver возвращает доставку dead в очередь с обнуленным счетчиком попыток.
+	// ErrDeliveryNotDead, если доставка еще в очереди (возможно, отправляется прямо сейчас) или доставлена
+	Redeliver(ctx context.Context, id int64) (*domain.WebhookDelivery, error)
 }
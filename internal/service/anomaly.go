@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const (
+	AnomalyRuleJump   = "jump"   // рост к прошлому месяцу не меньше JumpPercent
+	AnomalyRuleZScore = "zscore" // z-оценка к предыдущим месяцам окна не меньше ZScore
+)
+
+// minZScoreHistory - сколько месяцев с подписками нужно в окне, чтобы считать z-оценку
+const minZScoreHistory = 3
+
+// AnomalyRules - настройки поиска аномалий, нулевое значение порога выключает правило
+type AnomalyRules struct {
+	JumpPercent float64
+	ZScore      float64
+	Window      int // сколько предыдущих месяцев учитывается
+}
+
+type AnomalyService struct {
+	subs  repository.Subscriptions
+	repo  repository.Anomalies
+	rules AnomalyRules
+}
+
+func NewAnomalyService(subs repository.Subscriptions, repo repository.Anomalies, rules AnomalyRules) *AnomalyService {
+	return &AnomalyService{subs: subs, repo: repo, rules: rules}
+}
+
+// Detect строит помесячные ряды расходов всех пользователей за окно до месяца now,
+// проверяет месяц now правилами и сохраняет новые аномалии
+func (s *AnomalyService) Detect(ctx context.Context, now time.Time) ([]domain.Anomaly, error) {
+	month := normalizeMonth(now)
+	from := month.AddDate(0, -s.rules.Window, 0)
+
+	spends, err := s.subs.MonthlySpendByUser(ctx, repository.SubscriptionFilter{}, from, month)
+	if err != nil {
+		return nil, err
+	}
+
+	// ряд пользователя: Window предыдущих месяцев и месяц month последним, месяцы без расходов - 0
+	series := make(map[uuid.UUID][]int)
+	var users []uuid.UUID
+	for _, sp := range spends {
+		row, ok := series[sp.UserID]
+		if !ok {
+			row = make([]int, s.rules.Window+1)
+			series[sp.UserID] = row
+			users = append(users, sp.UserID)
+		}
+		row[monthsBetweenInclusive(from, normalizeMonth(sp.Month))-1] = sp.Spend
+	}
+
+	var found []domain.Anomaly
+	for _, userID := range users {
+		for _, a := range s.rules.check(series[userID]) {
+			a.UserID, a.Month = userID, month
+			found = append(found, a)
+		}
+	}
+	return s.repo.Add(ctx, found)
+}
+
+func (s *AnomalyService) List(ctx context.Context, filter repository.AnomalyFilter) ([]domain.Anomaly, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// check проверяет последний месяц ряда. Правила ищут только рост расходов
+func (r AnomalyRules) check(series []int) []domain.Anomaly {
+	current := series[len(series)-1]
+	history := series[:len(series)-1]
+
+	var result []domain.Anomaly
+	if r.JumpPercent > 0 && len(history) > 0 {
+		// с нуля процент роста не определен - такие случаи ловит z-оценка
+		if prev := history[len(history)-1]; prev > 0 {
+			growth := float64(current-prev) * 100 / float64(prev)
+			if growth >= r.JumpPercent {
+				result = append(result, domain.Anomaly{Rule: AnomalyRuleJump, Spend: current, Baseline: float64(prev), Score: growth})
+			}
+		}
+	}
+
+	if r.ZScore > 0 {
+		// месяцы до первой подписки пользователя не учитываем, иначе новичок сразу аномален
+		for len(history) > 0 && history[0] == 0 {
+			history = history[1:]
+		}
+		if len(history) >= minZScoreHistory {
+			mean, std := meanStd(history)
+			// при постоянных расходах (std = 0) z-оценка не определена, рост ловит правило jump
+			if std > 0 {
+				if z := (float64(current) - mean) / std; z >= r.ZScore {
+					result = append(result, domain.Anomaly{Rule: AnomalyRuleZScore, Spend: current, Baseline: mean, Score: z})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// meanStd - среднее и стандартное отклонение (по генеральной совокупности)
+func meanStd(values []int) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		d := float64(v) - mean
+		sq += d * d
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+func TestMeanStd(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		mean   float64
+		std    float64
+	}{
+		{"textbook", []int{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+		{"single value", []int{3}, 3, 0},
+		{"constant", []int{100, 100, 100}, 100, 0},
+		{"two values", []int{0, 10}, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, std := meanStd(tt.values)
+			if !almostEqual(mean, tt.mean) || !almostEqual(std, tt.std) {
+				t.Errorf("meanStd() = %v, %v, want %v, %v", mean, std, tt.mean, tt.std)
+			}
+		})
+	}
+}
+
+func TestAnomalyRulesCheck(t *testing.T) {
+	rules := AnomalyRules{JumpPercent: 50, ZScore: 2}
+	stable := []int{100, 110, 90, 100} // среднее 100, отклонение sqrt(50)
+
+	tests := []struct {
+		name   string
+		rules  AnomalyRules
+		series []int
+		want   []domain.Anomaly
+	}{
+		{"steady spend", rules, []int{100, 100, 100, 100}, nil},
+		{"jump", rules, []int{100, 100, 150}, []domain.Anomaly{
+			{Rule: AnomalyRuleJump, Spend: 150, Baseline: 100, Score: 50},
+		}},
+		{"growth below jump threshold", rules, []int{100, 100, 149}, nil},
+		{"zscore", rules, append(stable, 120), []domain.Anomaly{
+			{Rule: AnomalyRuleZScore, Spend: 120, Baseline: 100, Score: 20 / math.Sqrt(50)},
+		}},
+		{"jump and zscore", rules, append(stable, 200), []domain.Anomaly{
+			{Rule: AnomalyRuleJump, Spend: 200, Baseline: 100, Score: 100},
+			{Rule: AnomalyRuleZScore, Spend: 200, Baseline: 100, Score: 100 / math.Sqrt(50)},
+		}},
+		{"months before first subscription ignored", rules, []int{0, 0, 0, 100, 100, 300}, []domain.Anomaly{
+			{Rule: AnomalyRuleJump, Spend: 300, Baseline: 100, Score: 200},
+		}},
+		{"growth from zero", rules, []int{0, 0, 100}, nil},
+		{"rules disabled", AnomalyRules{}, append(stable, 1000), nil},
+		{"no history", rules, []int{500}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rules.check(tt.series)
+			if len(got) != len(tt.want) {
+				t.Fatalf("check() = %+v, want %+v", got, tt.want)
+			}
+			for i, a := range got {
+				w := tt.want[i]
+				if a.Rule != w.Rule || a.Spend != w.Spend || !almostEqual(a.Baseline, w.Baseline) || !almostEqual(a.Score, w.Score) {
+					t.Errorf("check()[%d] = %+v, want %+v", i, a, w)
+				}
+			}
+		})
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
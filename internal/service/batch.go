@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const (
+	MaxTotalBatchSize = 100
+	totalBatchWorkers = 8 // не больше, чем имеет смысл держать соединений из пула на один запрос
+)
+
+var ErrBatchTooLarge = fmt.Errorf("batch is too large, max %d queries", MaxTotalBatchSize)
+
+type TotalQuery struct {
+	Filter repository.SubscriptionFilter
+	From   time.Time
+	To     time.Time
+}
+
+// TotalResult - итог одного запроса пакета или его ошибка
+type TotalResult struct {
+	Total int
+	Err   error
+}
+
+// TotalCostBatch считает TotalCost для каждого запроса конкурентно (ограниченным пулом воркеров).
+// Результаты возвращаются в порядке запросов; ошибка одного запроса не мешает остальным.
+// Ошибка функции - только слишком большой пакет или отмена ctx
+func (s *SubscriptionService) TotalCostBatch(ctx context.Context, queries []TotalQuery) ([]TotalResult, error) {
+	if len(queries) > MaxTotalBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]TotalResult, len(queries))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	workers := min(totalBatchWorkers, len(queries))
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				q := queries[i]
+				results[i].Total, results[i].Err = s.TotalCost(ctx, q.Filter, q.From, q.To)
+			}
+		}()
+	}
+
+	for i := range queries {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
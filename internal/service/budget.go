@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const maxBudgetThreshold = 1000 // порог в процентах, 1000% - лимит превышен в 10 раз
+
+var (
+	ErrInvalidBudgetLimit = errors.New("monthly_limit must be positive")
+	ErrInvalidThresholds  = errors.New("thresholds must be percents in 1..1000")
+)
+
+// DefaultBudgetThresholds - пороги, если при создании бюджета они не заданы
+var DefaultBudgetThresholds = []int{80, 100}
+
+type BudgetService struct {
+	repo repository.Budgets
+	subs *SubscriptionService // расходы считаются так же, как TotalCost
+}
+
+func NewBudgetService(repo repository.Budgets, subs *SubscriptionService) *BudgetService {
+	return &BudgetService{repo: repo, subs: subs}
+}
+
+type BudgetInput struct {
+	ServiceName  *string // nil - общий бюджет на все подписки; категорий у подписок нет, только сервисы
+	MonthlyLimit int
+	Thresholds   []int // пустой - DefaultBudgetThresholds
+}
+
+// BudgetStatus - расходы по бюджету в месяце
+type BudgetStatus struct {
+	Budget  domain.Budget
+	Month   time.Time
+	Spend   int
+	Percent int   // Spend в процентах от лимита, с округлением вниз
+	Reached []int // пороги, до которых дошли расходы
+}
+
+// Create создает бюджет и сразу проверяет его на текущий месяц, возвращая сработавшие пороги
+func (s *BudgetService) Create(ctx context.Context, userID uuid.UUID, input BudgetInput, now time.Time) (*domain.Budget, []domain.BudgetAlert, error) {
+	b := &domain.Budget{ID: uuid.New(), UserID: userID}
+	if err := applyBudgetInput(b, input); err != nil {
+		return nil, nil, err
+	}
+	if err := s.repo.Create(ctx, b); err != nil {
+		return nil, nil, err
+	}
+	return b, s.evaluateSaved(ctx, *b, now), nil
+}
+
+func (s *BudgetService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Budget, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Update меняет лимит, сервис и пороги бюджета и проверяет его на текущий месяц (срабатывания - в Alerts).
+// Пороги, сработавшие в этом месяце до изменения, повторно не срабатывают
+func (s *BudgetService) Update(ctx context.Context, id uuid.UUID, input BudgetInput, now time.Time) error {
+	b, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := applyBudgetInput(b, input); err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, b); err != nil {
+		return err
+	}
+	s.evaluateSaved(ctx, *b, now)
+	return nil
+}
+
+// evaluateSaved проверяет только что сохраненный бюджет на месяц now. Бюджет уже сохранен, поэтому
+// ошибка проверки только логируется: пропущенные пороги сработают при следующем запуске evaluateBudgets
+func (s *BudgetService) evaluateSaved(ctx context.Context, b domain.Budget, now time.Time) []domain.BudgetAlert {
+	alerts, err := s.evaluate(ctx, []domain.Budget{b}, normalizeMonth(now))
+	if err != nil {
+		slog.Error("failed to evaluate budget", "budget_id", b.ID, "error", err)
+		return nil
+	}
+	return alerts
+}
+
+func (s *BudgetService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// List возвращает бюджеты пользователя с расходами за месяц now
+func (s *BudgetService) List(ctx context.Context, userID uuid.UUID, now time.Time) ([]BudgetStatus, error) {
+	budgets, err := s.repo.List(ctx, &userID)
+	if err != nil {
+		return nil, err
+	}
+	month := normalizeMonth(now)
+	result := make([]BudgetStatus, 0, len(budgets))
+	for _, b := range budgets {
+		st, err := s.status(ctx, b, month)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, st)
+	}
+	return result, nil
+}
+
+// Status считает расходы по бюджету за месяц now
+func (s *BudgetService) Status(ctx context.Context, b domain.Budget, now time.Time) (BudgetStatus, error) {
+	return s.status(ctx, b, normalizeMonth(now))
+}
+
+// Evaluate проверяет все бюджеты на месяц now и сохраняет новые срабатывания порогов
+func (s *BudgetService) Evaluate(ctx context.Context, now time.Time) ([]domain.BudgetAlert, error) {
+	budgets, err := s.repo.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.evaluate(ctx, budgets, normalizeMonth(now))
+}
+
+func (s *BudgetService) Alerts(ctx context.Context, filter repository.BudgetAlertFilter) ([]domain.BudgetAlert, error) {
+	return s.repo.Alerts(ctx, filter)
+}
+
+func (s *BudgetService) evaluate(ctx context.Context, budgets []domain.Budget, month time.Time) ([]domain.BudgetAlert, error) {
+	var alerts []domain.BudgetAlert
+	for _, b := range budgets {
+		st, err := s.status(ctx, b, month)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range st.Reached {
+			alerts = append(alerts, domain.BudgetAlert{
+				BudgetID:     b.ID,
+				UserID:       b.UserID,
+				ServiceName:  b.ServiceName,
+				Month:        month,
+				Threshold:    t,
+				Spend:        st.Spend,
+				MonthlyLimit: b.MonthlyLimit,
+			})
+		}
+	}
+	return s.repo.AddAlerts(ctx, alerts)
+}
+
+func (s *BudgetService) status(ctx context.Context, b domain.Budget, month time.Time) (BudgetStatus, error) {
+	filter := repository.SubscriptionFilter{UserID: &b.UserID, ServiceName: b.ServiceName}
+	spend, err := s.subs.TotalCost(ctx, filter, month, month)
+	if err != nil {
+		return BudgetStatus{}, err
+	}
+
+	st := BudgetStatus{Budget: b, Month: month, Spend: spend, Percent: spend * 100 / b.MonthlyLimit}
+	for _, t := range b.Thresholds {
+		if spend*100 >= b.MonthlyLimit*t {
+			st.Reached = append(st.Reached, t)
+		}
+	}
+	return st, nil
+}
+
+// applyBudgetInput проверяет ввод и переносит его в бюджет; пороги сортируются без повторов
+func applyBudgetInput(b *domain.Budget, input BudgetInput) error {
+	if input.MonthlyLimit <= 0 {
+		return ErrInvalidBudgetLimit
+	}
+	thresholds := slices.Clone(input.Thresholds)
+	if len(thresholds) == 0 {
+		thresholds = slices.Clone(DefaultBudgetThresholds)
+	}
+	for _, t := range thresholds {
+		if t < 1 || t > maxBudgetThreshold {
+			return ErrInvalidThresholds
+		}
+	}
+	slices.Sort(thresholds)
+
+	b.ServiceName = input.ServiceName
+	b.MonthlyLimit = input.MonthlyLimit
+	b.Thresholds = slices.Compact(thresholds)
+	return nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+type fakeBudgets struct {
+	repository.Budgets
+	budgets   map[uuid.UUID]domain.Budget
+	alertsErr error
+}
+
+func (f *fakeBudgets) Create(_ context.Context, b *domain.Budget) error {
+	f.budgets[b.ID] = *b
+	return nil
+}
+
+func (f *fakeBudgets) GetByID(_ context.Context, id uuid.UUID) (*domain.Budget, error) {
+	b, ok := f.budgets[id]
+	if !ok {
+		return nil, repository.ErrBudgetNotFound
+	}
+	return &b, nil
+}
+
+func (f *fakeBudgets) Update(_ context.Context, b *domain.Budget) error {
+	f.budgets[b.ID] = *b
+	return nil
+}
+
+func (f *fakeBudgets) List(_ context.Context, userID *uuid.UUID) ([]domain.Budget, error) {
+	var result []domain.Budget
+	for _, b := range f.budgets {
+		if userID == nil || b.UserID == *userID {
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeBudgets) AddAlerts(_ context.Context, alerts []domain.BudgetAlert) ([]domain.BudgetAlert, error) {
+	if f.alertsErr != nil {
+		return nil, f.alertsErr
+	}
+	return alerts, nil
+}
+
+func TestBudgetSavedWhenEvaluationFails(t *testing.T) {
+	userID := uuid.New()
+	now := time.Date(2025, 9, 15, 0, 0, 0, 0, time.UTC)
+	subs := &fakeSubscriptions{subs: []domain.Subscription{
+		{ID: uuid.New(), UserID: userID, ServiceName: "Netflix", Price: 900, StartDate: month(2025, 1)},
+	}}
+	budgets := &fakeBudgets{budgets: make(map[uuid.UUID]domain.Budget)}
+	svc := NewBudgetService(budgets, NewSubscriptionService(subs, OverlapAllow))
+
+	b, alerts, err := svc.Create(context.Background(), userID, BudgetInput{MonthlyLimit: 1000}, now)
+	if err != nil || len(alerts) != 1 || alerts[0].Threshold != 80 {
+		t.Fatalf("Create() = %v alerts, %v, want threshold 80 reached", alerts, err)
+	}
+
+	// бюджет сохранен, поэтому ошибка проверки не превращается в ошибку запроса
+	budgets.alertsErr = errors.New("db is down")
+	if err := svc.Update(context.Background(), b.ID, BudgetInput{MonthlyLimit: 800}, now); err != nil {
+		t.Fatalf("Update() error = %v, want nil", err)
+	}
+	if got := budgets.budgets[b.ID].MonthlyLimit; got != 800 {
+		t.Errorf("saved limit %d, want 800", got)
+	}
+
+	created, alerts, err := svc.Create(context.Background(), uuid.New(), BudgetInput{MonthlyLimit: 100}, now)
+	if err != nil || created == nil || alerts != nil {
+		t.Errorf("Create() = %v, %v, %v, want budget without alerts", created, alerts, err)
+	}
+}
+
+func TestApplyBudgetInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   BudgetInput
+		want    []int
+		wantErr error
+	}{
+		{"default thresholds", BudgetInput{MonthlyLimit: 1000}, []int{80, 100}, nil},
+		{"sorted without repeats", BudgetInput{MonthlyLimit: 1000, Thresholds: []int{100, 50, 100, 1000}}, []int{50, 100, 1000}, nil},
+		{"zero limit", BudgetInput{MonthlyLimit: 0}, nil, ErrInvalidBudgetLimit},
+		{"negative limit", BudgetInput{MonthlyLimit: -1}, nil, ErrInvalidBudgetLimit},
+		{"zero threshold", BudgetInput{MonthlyLimit: 1000, Thresholds: []int{0, 80}}, nil, ErrInvalidThresholds},
+		{"threshold above max", BudgetInput{MonthlyLimit: 1000, Thresholds: []int{maxBudgetThreshold + 1}}, nil, ErrInvalidThresholds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b domain.Budget
+			err := applyBudgetInput(&b, tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyBudgetInput() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (b.MonthlyLimit != tt.input.MonthlyLimit || !slices.Equal(b.Thresholds, tt.want)) {
+				t.Errorf("budget = %+v, want thresholds %v", b, tt.want)
+			}
+		})
+	}
+	if !slices.Equal(DefaultBudgetThresholds, []int{80, 100}) {
+		t.Errorf("DefaultBudgetThresholds changed: %v", DefaultBudgetThresholds)
+	}
+}
+
+func TestBudgetEvaluate(t *testing.T) {
+	user := uuid.New()
+	netflix := "Netflix"
+	now := time.Date(2025, 9, 15, 0, 0, 0, 0, time.UTC)
+	subs := []domain.Subscription{
+		{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 600, StartDate: month(2025, 1), AutoRenew: true},
+		{ID: uuid.New(), UserID: user, ServiceName: "Kion", Price: 400, StartDate: month(2025, 9), EndDate: monthPtr(2025, 9)},
+		{ID: uuid.New(), UserID: user, ServiceName: "Spotify", Price: 500, StartDate: month(2025, 1), EndDate: monthPtr(2025, 8)}, // закончилась
+		{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", Price: 5000, StartDate: month(2025, 1), AutoRenew: true},
+	}
+
+	tests := []struct {
+		name        string
+		budget      domain.Budget
+		wantSpend   int
+		wantPercent int
+		wantReached []int
+	}{
+		{"below thresholds", domain.Budget{MonthlyLimit: 2000, Thresholds: []int{80, 100}}, 1000, 50, nil},
+		{"exactly at threshold", domain.Budget{MonthlyLimit: 1250, Thresholds: []int{80, 100}}, 1000, 80, []int{80}},
+		{"over limit", domain.Budget{MonthlyLimit: 400, Thresholds: []int{80, 100, 200}}, 1000, 250, []int{80, 100, 200}},
+		{"percent rounds down", domain.Budget{MonthlyLimit: 1001, Thresholds: []int{100}}, 1000, 99, nil},
+		{"service budget", domain.Budget{ServiceName: &netflix, MonthlyLimit: 600, Thresholds: []int{50, 100, 150}}, 600, 100, []int{50, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.budget.ID = uuid.New()
+			tt.budget.UserID = user
+			budgets := &fakeBudgets{budgets: map[uuid.UUID]domain.Budget{tt.budget.ID: tt.budget}}
+			svc := NewBudgetService(budgets, NewSubscriptionService(&fakeSubscriptions{subs: subs}, OverlapAllow))
+
+			st, err := svc.Status(context.Background(), tt.budget, now)
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			if st.Spend != tt.wantSpend || st.Percent != tt.wantPercent || !slices.Equal(st.Reached, tt.wantReached) || !st.Month.Equal(month(2025, 9)) {
+				t.Errorf("Status() = %+v, want spend %d, percent %d, reached %v", st, tt.wantSpend, tt.wantPercent, tt.wantReached)
+			}
+
+			alerts, err := svc.Evaluate(context.Background(), now)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			var want []domain.BudgetAlert
+			for _, th := range tt.wantReached {
+				want = append(want, domain.BudgetAlert{
+					BudgetID: tt.budget.ID, UserID: user, ServiceName: tt.budget.ServiceName, Month: month(2025, 9),
+					Threshold: th, Spend: tt.wantSpend, MonthlyLimit: tt.budget.MonthlyLimit,
+				})
+			}
+			if !reflect.DeepEqual(alerts, want) {
+				t.Errorf("Evaluate() = %+v, want %+v", alerts, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const MaxBulkOperations = 500
+
+var ErrBulkTooLarge = fmt.Errorf("too many operations, max %d", MaxBulkOperations)
+
+// BulkOpError - ошибка конкретной операции пакета
+type BulkOpError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkOpError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Err)
+}
+
+func (e *BulkOpError) Unwrap() error {
+	return e.Err
+}
+
+// BulkItem - результат операции пакета
+type BulkItem struct {
+	ID       uuid.UUID
+	Overlaps []domain.Subscription // пересечения сохраненной подписки при политике warn
+	Err      error                 // ошибка операции, только в BulkBestEffort
+}
+
+// prepareBulk проставляет id новым подпискам без id от клиента и проверку пересечений по политике policy
+// (пустая - политика сервиса) операциям create/update. Возвращает результаты с id каждой операции,
+// в Overlaps которых проверки запишут найденные пересечения
+func (s *SubscriptionService) prepareBulk(ops []repository.BulkOp, policy OverlapPolicy) ([]BulkItem, error) {
+	if len(ops) > MaxBulkOperations {
+		return nil, ErrBulkTooLarge
+	}
+	items := make([]BulkItem, len(ops))
+	for i := range ops {
+		op := &ops[i]
+		switch op.Kind {
+		case repository.BulkCreate:
+			if op.ID == uuid.Nil {
+				op.ID = uuid.New()
+			}
+			op.Subscription.ID = op.ID
+			op.Check = s.overlapCheck(policy, &items[i].Overlaps)
+		case repository.BulkUpdate:
+			op.Subscription.ID = op.ID
+			op.Check = s.overlapCheck(policy, &items[i].Overlaps)
+		}
+		items[i].ID = op.ID
+	}
+	return items, nil
+}
+
+// BulkAtomic выполняет операции по принципу "все или ничего".
+// При ошибке операции (в том числе *OverlapError при политике reject) возвращается *BulkOpError,
+// изменения не сохраняются
+func (s *SubscriptionService) BulkAtomic(ctx context.Context, ops []repository.BulkOp, policy OverlapPolicy) ([]BulkItem, error) {
+	items, err := s.prepareBulk(ops, policy)
+	if err != nil {
+		return nil, err
+	}
+	failed, err := s.repo.BulkAtomic(ctx, ops)
+	if err != nil {
+		if failed >= 0 {
+			return nil, &BulkOpError{Index: failed, Err: err}
+		}
+		return nil, err
+	}
+	return items, nil
+}
+
+// BulkBestEffort выполняет каждую операцию независимо и возвращает результат по каждой
+func (s *SubscriptionService) BulkBestEffort(ctx context.Context, ops []repository.BulkOp, policy OverlapPolicy) ([]BulkItem, error) {
+	items, err := s.prepareBulk(ops, policy)
+	if err != nil {
+		return nil, err
+	}
+	for i, err := range s.repo.BulkBestEffort(ctx, ops) {
+		items[i].Err = err
+	}
+	return items, nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+var (
+	ErrCancelInPast   = errors.New("cancellation month must not be in the past or before start_date")
+	ErrCancelAfterEnd = errors.New("subscription already ends before the cancellation month")
+)
+
+// Cancel отменяет подписку "в конце периода": последним оплаченным месяцем становится at
+// (nil - текущий месяц, он уже оплачен), автопродление выключается, время отмены запоминается.
+// Отмена пишется в историю
+func (s *SubscriptionService) Cancel(ctx context.Context, id uuid.UUID, at *time.Time) (*domain.Subscription, error) {
+	now := time.Now().UTC()
+	current := normalizeMonth(now)
+
+	sub, err := s.repo.Change(ctx, id, repository.HistoryCancel, func(sub domain.Subscription) (domain.Subscription, error) {
+		start := normalizeMonth(sub.StartDate)
+		last := maxDate(current, start) // подписку, которая еще не началась, можно отменить с первого месяца
+		if at != nil {
+			last = normalizeMonth(*at)
+		}
+		if last.Before(current) || last.Before(start) {
+			return sub, ErrCancelInPast
+		}
+		if sub.EndDate != nil && !sub.AutoRenew && normalizeMonth(*sub.EndDate).Before(last) {
+			return sub, ErrCancelAfterEnd
+		}
+
+		sub.EndDate = &last
+		sub.AutoRenew = false
+		sub.CanceledAt = &now
+		return sub, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
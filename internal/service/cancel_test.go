@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+func TestCancel(t *testing.T) {
+	current := normalizeMonth(time.Now().UTC())
+	at := func(months int) *time.Time {
+		m := current.AddDate(0, months, 0)
+		return &m
+	}
+
+	tests := []struct {
+		name    string
+		sub     domain.Subscription
+		at      *time.Time
+		wantErr error
+		wantEnd time.Time
+	}{
+		{"current month by default", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), AutoRenew: true}, nil, nil, current},
+		{"not started yet", domain.Subscription{StartDate: *at(2), AutoRenew: true}, nil, nil, *at(2)},
+		{"future month", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), AutoRenew: true}, at(3), nil, *at(3)},
+		{"mid-month date", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), AutoRenew: true}, func() *time.Time { m := at(1).AddDate(0, 0, 14); return &m }(), nil, *at(1)},
+		{"auto-renewed past end_date", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), EndDate: at(-2), AutoRenew: true}, at(1), nil, *at(1)},
+		{"earlier than fixed end_date", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), EndDate: at(4)}, at(1), nil, *at(1)},
+		{"past month", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), AutoRenew: true}, at(-1), ErrCancelInPast, time.Time{}},
+		{"before start", domain.Subscription{StartDate: *at(3), AutoRenew: true}, at(1), ErrCancelInPast, time.Time{}},
+		{"after fixed end_date", domain.Subscription{StartDate: current.AddDate(-1, 0, 0), EndDate: at(1)}, at(2), ErrCancelAfterEnd, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sub.ID = uuid.New()
+			repo := newFakeChanges(tt.sub)
+			got, err := NewSubscriptionService(repo, OverlapAllow).Cancel(context.Background(), tt.sub.ID, tt.at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Cancel() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if repo.subs[tt.sub.ID].CanceledAt != nil {
+					t.Error("subscription changed on error")
+				}
+				return
+			}
+			if got.EndDate == nil || !got.EndDate.Equal(tt.wantEnd) || got.AutoRenew || got.CanceledAt == nil {
+				t.Errorf("Cancel() = end %v, auto_renew %v, canceled_at %v, want end %v", got.EndDate, got.AutoRenew, got.CanceledAt, tt.wantEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const MaxUpcomingChargeDays = 366
+
+// UpcomingCharge - ожидаемое списание по подписке. Списания происходят первого числа каждого месяца
+type UpcomingCharge struct {
+	Date         time.Time
+	Subscription domain.Subscription
+	Amount       int
+	Renewal      bool // списание после окончания срока за счет автопродления
+}
+
+// chargedInMonth - будет ли списание по подписке в месяце month (см. activeInMonth);
+// renewal - списание после end_date за счет автопродления
+func chargedInMonth(sub domain.Subscription, month time.Time) (charged, renewal bool) {
+	if !activeInMonth(sub, month) {
+		return false, false
+	}
+	return true, sub.EndDate != nil && month.After(normalizeMonth(*sub.EndDate))
+}
+
+// UpcomingCharges возвращает списания пользователя за days дней начиная с now (включительно),
+// отсортированные по дате
+func (s *SubscriptionService) UpcomingCharges(ctx context.Context, userID uuid.UUID, now time.Time, days int) ([]UpcomingCharge, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := today.AddDate(0, 0, days) // не включительно
+
+	// первое списание - первое число текущего месяца, если сегодня первое, иначе следующего
+	first := normalizeMonth(today)
+	if first.Before(today) {
+		first = first.AddDate(0, 1, 0)
+	}
+	if !first.Before(until) {
+		return []UpcomingCharge{}, nil
+	}
+	last := normalizeMonth(until.AddDate(0, 0, -1))
+
+	subs, err := s.repo.FindActiveInPeriod(ctx, repository.SubscriptionFilter{UserID: &userID}, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	charges := []UpcomingCharge{}
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		for _, sub := range subs {
+			if charged, renewal := chargedInMonth(sub, month); charged {
+				charges = append(charges, UpcomingCharge{Date: month, Subscription: sub, Amount: sub.Price, Renewal: renewal})
+			}
+		}
+	}
+	sort.SliceStable(charges, func(i, j int) bool {
+		if !charges[i].Date.Equal(charges[j].Date) {
+			return charges[i].Date.Before(charges[j].Date)
+		}
+		return charges[i].Subscription.ServiceName < charges[j].Subscription.ServiceName
+	})
+	return charges, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+func TestChargedInMonth(t *testing.T) {
+	tests := []struct {
+		name        string
+		sub         domain.Subscription
+		month       time.Time
+		charged     bool
+		wantRenewal bool
+	}{
+		{"before start", domain.Subscription{StartDate: month(2025, 3)}, month(2025, 2), false, false},
+		{"open-ended", domain.Subscription{StartDate: month(2025, 3)}, month(2030, 1), true, false},
+		{"last month of term", domain.Subscription{StartDate: month(2025, 1), EndDate: monthPtr(2025, 6)}, month(2025, 6), true, false},
+		{"after end without renewal", domain.Subscription{StartDate: month(2025, 1), EndDate: monthPtr(2025, 6)}, month(2025, 7), false, false},
+		{"after end with renewal", domain.Subscription{StartDate: month(2025, 1), EndDate: monthPtr(2025, 6), AutoRenew: true}, month(2025, 7), true, true},
+		{"term with renewal", domain.Subscription{StartDate: month(2025, 1), EndDate: monthPtr(2025, 6), AutoRenew: true}, month(2025, 3), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charged, renewal := chargedInMonth(tt.sub, tt.month)
+			if charged != tt.charged || renewal != tt.wantRenewal {
+				t.Errorf("chargedInMonth() = %v, %v, want %v, %v", charged, renewal, tt.charged, tt.wantRenewal)
+			}
+		})
+	}
+}
+
+// подписка с автопродлением, срок которой закончился до периода, продолжает списываться
+func TestUpcomingChargesRenewalAfterEnd(t *testing.T) {
+	userID := uuid.New()
+	repo := &fakeSubscriptions{subs: []domain.Subscription{
+		{ID: uuid.New(), UserID: userID, ServiceName: "Renewing", Price: 300, StartDate: month(2024, 1), EndDate: monthPtr(2024, 12), AutoRenew: true},
+		{ID: uuid.New(), UserID: userID, ServiceName: "Expired", Price: 100, StartDate: month(2024, 1), EndDate: monthPtr(2024, 12)},
+	}}
+	svc := NewSubscriptionService(repo, OverlapAllow)
+
+	charges, err := svc.UpcomingCharges(context.Background(), userID, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{month(2026, 11), month(2026, 12)}
+	if len(charges) != len(want) {
+		t.Fatalf("got %d charges, want %d", len(charges), len(want))
+	}
+	for i, ch := range charges {
+		if !ch.Date.Equal(want[i]) || ch.Subscription.ServiceName != "Renewing" || ch.Amount != 300 || !ch.Renewal {
+			t.Errorf("charge %d = %+v", i, ch)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// TotalDelta - сравнение суммы текущего периода с базовым
+type TotalDelta struct {
+	Current  int
+	Baseline int
+	Change   int
+	// ChangePercent - nil, если в базовом периоде трат не было
+	ChangePercent *float64
+}
+
+type ServiceDelta struct {
+	ServiceName string
+	TotalDelta
+}
+
+type TotalComparison struct {
+	TotalDelta
+	Services []ServiceDelta // отсортированы по убыванию абсолютного изменения
+}
+
+// CompareTotals сравнивает итоговые суммы за [from, to] и [baselineFrom, baselineTo] в целом и по сервисам
+func (s *SubscriptionService) CompareTotals(ctx context.Context, filter repository.SubscriptionFilter, from, to, baselineFrom, baselineTo time.Time) (*TotalComparison, error) {
+	current, currentLines, err := s.TotalCostExplain(ctx, filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+	baseline, baselineLines, err := s.TotalCostExplain(ctx, filter, baselineFrom, baselineTo)
+	if err != nil {
+		return nil, err
+	}
+
+	byService := make(map[string]*ServiceDelta)
+	get := func(name string) *ServiceDelta {
+		sd, ok := byService[name]
+		if !ok {
+			sd = &ServiceDelta{ServiceName: name}
+			byService[name] = sd
+		}
+		return sd
+	}
+	for _, l := range currentLines {
+		get(l.Subscription.ServiceName).Current += l.Amount
+	}
+	for _, l := range baselineLines {
+		get(l.Subscription.ServiceName).Baseline += l.Amount
+	}
+
+	result := &TotalComparison{
+		TotalDelta: newTotalDelta(current, baseline),
+		Services:   make([]ServiceDelta, 0, len(byService)),
+	}
+	for _, sd := range byService {
+		sd.TotalDelta = newTotalDelta(sd.Current, sd.Baseline)
+		result.Services = append(result.Services, *sd)
+	}
+	sort.Slice(result.Services, func(i, j int) bool {
+		a, b := result.Services[i], result.Services[j]
+		if abs(a.Change) != abs(b.Change) {
+			return abs(a.Change) > abs(b.Change)
+		}
+		return a.ServiceName < b.ServiceName
+	})
+	return result, nil
+}
+
+func newTotalDelta(current, baseline int) TotalDelta {
+	d := TotalDelta{
+		Current:  current,
+		Baseline: baseline,
+		Change:   current - baseline,
+	}
+	if baseline != 0 {
+		pct := math.Round(float64(d.Change)/float64(baseline)*10000) / 100
+		d.ChangePercent = &pct
+	}
+	return d
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestNewTotalDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		current, baseline int
+		wantChange        int
+		wantPercent       *float64
+	}{
+		{"no spend in either period", 0, 0, 0, nil},
+		{"no baseline", 100, 0, 100, nil},
+		{"growth", 150, 100, 50, floatPtr(50)},
+		{"drop to zero", 0, 80, -80, floatPtr(-100)},
+		{"rounded to two decimals", 1, 3, -2, floatPtr(-66.67)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTotalDelta(tt.current, tt.baseline)
+			if d.Current != tt.current || d.Baseline != tt.baseline || d.Change != tt.wantChange {
+				t.Errorf("newTotalDelta() = %+v, want change %d", d, tt.wantChange)
+			}
+			if (d.ChangePercent == nil) != (tt.wantPercent == nil) || d.ChangePercent != nil && *d.ChangePercent != *tt.wantPercent {
+				t.Errorf("ChangePercent = %v, want %v", d.ChangePercent, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestCompareTotals(t *testing.T) {
+	svc := NewSubscriptionService(&fakeSubscriptions{subs: []domain.Subscription{
+		{ID: uuid.New(), ServiceName: "Netflix", Price: 100, StartDate: month(2024, 1)},
+		{ID: uuid.New(), ServiceName: "Spotify", Price: 10, StartDate: month(2025, 1)},
+		{ID: uuid.New(), ServiceName: "Kion", Price: 50, StartDate: month(2024, 1), EndDate: monthPtr(2024, 12)},
+	}}, OverlapAllow)
+
+	// год к году: первый квартал 2025 против первого квартала 2024
+	cmp, err := svc.CompareTotals(context.Background(), repository.SubscriptionFilter{},
+		month(2025, 1), month(2025, 3), month(2024, 1), month(2024, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmp.Current != 330 || cmp.Baseline != 450 || cmp.Change != -120 || cmp.ChangePercent == nil || *cmp.ChangePercent != -26.67 {
+		t.Errorf("total = %+v, want 330 vs 450, -120 (-26.67%%)", cmp.TotalDelta)
+	}
+
+	// по убыванию абсолютного изменения
+	want := []struct {
+		service           string
+		current, baseline int
+	}{
+		{"Kion", 0, 150},
+		{"Spotify", 30, 0},
+		{"Netflix", 300, 300},
+	}
+	if len(cmp.Services) != len(want) {
+		t.Fatalf("got %d services, want %d", len(cmp.Services), len(want))
+	}
+	for i, w := range want {
+		sd := cmp.Services[i]
+		if sd.ServiceName != w.service || sd.Current != w.current || sd.Baseline != w.baseline || sd.Change != w.current-w.baseline {
+			t.Errorf("service %d = %+v, want %+v", i, sd, w)
+		}
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// fakeSubscriptions - хранилище подписок в памяти. Реализованы только методы, которые нужны тестам,
+// вызов остальных паникует на nil-интерфейсе
+type fakeSubscriptions struct {
+	repository.Subscriptions
+	subs []domain.Subscription
+}
+
+func (f *fakeSubscriptions) FindActiveInPeriod(_ context.Context, filter repository.SubscriptionFilter, from, to time.Time) ([]domain.Subscription, error) {
+	return f.find(filter, func(sub domain.Subscription) bool {
+		end := sub.EffectiveEnd()
+		return !sub.StartDate.After(to) && (end == nil || !end.Before(from))
+	}), nil
+}
+
+func (f *fakeSubscriptions) FindSuccessors(_ context.Context, ids []uuid.UUID, filter repository.SubscriptionFilter) ([]domain.Subscription, error) {
+	chain := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		chain[id] = true
+	}
+	for found := true; found; {
+		found = false
+		for _, sub := range f.subs {
+			if sub.PreviousID != nil && chain[*sub.PreviousID] && !chain[sub.ID] {
+				chain[sub.ID] = true
+				found = true
+			}
+		}
+	}
+	return f.find(filter, func(sub domain.Subscription) bool {
+		return chain[sub.ID] && !slices.Contains(ids, sub.ID)
+	}), nil
+}
+
+// List отдает подписки в порядке хранения, сортировку и курсор не учитывает
+func (f *fakeSubscriptions) List(_ context.Context, filter repository.SubscriptionFilter, page repository.Page) ([]domain.Subscription, error) {
+	subs := f.find(filter, func(domain.Subscription) bool { return true })
+	from := min(page.Offset, len(subs))
+	return subs[from:min(from+page.Limit, len(subs))], nil
+}
+
+func (f *fakeSubscriptions) Stream(_ context.Context, filter repository.SubscriptionFilter, _ []repository.SortKey, fn func(domain.Subscription) error) error {
+	for _, sub := range f.find(filter, func(domain.Subscription) bool { return true }) {
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// find учитывает из фильтра только user_id, service_name, start_to, price_max, ends_from, ends_to и not_continued
+func (f *fakeSubscriptions) find(filter repository.SubscriptionFilter, match func(domain.Subscription) bool) []domain.Subscription {
+	var result []domain.Subscription
+	for _, sub := range f.subs {
+		if filter.UserID != nil && sub.UserID != *filter.UserID {
+			continue
+		}
+		if filter.ServiceName != nil && sub.ServiceName != *filter.ServiceName {
+			continue
+		}
+		if filter.StartTo != nil && sub.StartDate.After(*filter.StartTo) {
+			continue
+		}
+		if filter.PriceMax != nil && sub.Price > *filter.PriceMax {
+			continue
+		}
+		if (filter.EndsFrom != nil || filter.EndsTo != nil) && (sub.AutoRenew || sub.EndDate == nil) {
+			continue
+		}
+		if filter.EndsFrom != nil && sub.EndDate.Before(*filter.EndsFrom) || filter.EndsTo != nil && sub.EndDate.After(*filter.EndsTo) {
+			continue
+		}
+		if filter.NotContinued && slices.ContainsFunc(f.subs, func(n domain.Subscription) bool {
+			return n.PreviousID != nil && *n.PreviousID == sub.ID
+		}) {
+			continue
+		}
+		if match(sub) {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func monthPtr(year int, m time.Month) *time.Time {
+	t := month(year, m)
+	return &t
+}
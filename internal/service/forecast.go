@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// ServiceForecast - прогноз по одному сервису за месяц
+type ServiceForecast struct {
+	ServiceName string
+	Committed   int
+	Projected   int
+}
+
+// MonthForecast - прогноз расходов на один месяц.
+// Committed - подписки с известной датой окончания (оплата до end_date ожидается точно),
+// Projected - бессрочные подписки, которые мы считаем продолжающимися,
+// и подписки с автопродлением после окончания срока.
+type MonthForecast struct {
+	Month     time.Time
+	Committed int
+	Projected int
+	Services  []ServiceForecast
+}
+
+// Forecast прогнозирует помесячные расходы на months месяцев вперед, начиная со следующего месяца.
+// Запланированная смена тарифа - подписка-продолжение (PreviousID) с будущей датой начала - учитывается
+// с месяца перехода по новой цене. Списания ежемесячные: других периодов оплаты у подписок нет
+func (s *SubscriptionService) Forecast(ctx context.Context, filter repository.SubscriptionFilter, months int) ([]MonthForecast, error) {
+	from := normalizeMonth(time.Now()).AddDate(0, 1, 0)
+	to := from.AddDate(0, months-1, 0)
+
+	subs, err := s.repo.FindActiveInPeriod(ctx, filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+	// продолжение - та же подписка после смены тарифа, поэтому границы start_from/start_to к нему
+	// не применяются (start_to отсекал бы будущую дату начала), остальной фильтр - применяется
+	subs, err = s.withSuccessors(ctx, subs, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MonthForecast, 0, months)
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		mf := MonthForecast{Month: month}
+		byService := make(map[string]*ServiceForecast)
+
+		for _, sub := range subs {
+			charged, renewal := chargedInMonth(sub, month)
+			if !charged {
+				continue
+			}
+			// после окончания срока подписка с автопродлением считается как бессрочная
+			committed := sub.EndDate != nil && !renewal
+			sf, ok := byService[sub.ServiceName]
+			if !ok {
+				sf = &ServiceForecast{ServiceName: sub.ServiceName}
+				byService[sub.ServiceName] = sf
+			}
+			if committed {
+				sf.Committed += sub.Price
+				mf.Committed += sub.Price
+			} else {
+				sf.Projected += sub.Price
+				mf.Projected += sub.Price
+			}
+		}
+
+		mf.Services = make([]ServiceForecast, 0, len(byService))
+		for _, sf := range byService {
+			mf.Services = append(mf.Services, *sf)
+		}
+		sort.Slice(mf.Services, func(i, j int) bool {
+			return mf.Services[i].ServiceName < mf.Services[j].ServiceName
+		})
+		result = append(result, mf)
+	}
+	return result, nil
+}
+
+// withSuccessors добавляет к subs их продолжения, которых среди subs нет и которые подходят
+// под filter без учета границ даты начала
+func (s *SubscriptionService) withSuccessors(ctx context.Context, subs []domain.Subscription, filter repository.SubscriptionFilter) ([]domain.Subscription, error) {
+	if len(subs) == 0 {
+		return subs, nil
+	}
+	seen := make(map[uuid.UUID]struct{}, len(subs))
+	ids := make([]uuid.UUID, 0, len(subs))
+	for _, sub := range subs {
+		seen[sub.ID] = struct{}{}
+		ids = append(ids, sub.ID)
+	}
+
+	filter.StartFrom, filter.StartTo = nil, nil
+	successors, err := s.repo.FindSuccessors(ctx, ids, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range successors {
+		if _, ok := seen[sub.ID]; !ok {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// activeInMonth - оплачивается ли подписка в указанном месяце (до EffectiveEnd включительно)
+func activeInMonth(sub domain.Subscription, month time.Time) bool {
+	if normalizeMonth(sub.StartDate).After(month) {
+		return false
+	}
+	end := sub.EffectiveEnd()
+	return end == nil || !normalizeMonth(*end).Before(month)
+}
+
+// MonthlySpend - расходы на сервис за один месяц
+type MonthlySpend struct {
+	Month       time.Time
+	ServiceName string
+	Amount      int
+}
+
+// MonthlySpendBreakdown раскладывает TotalCost за [from, to] по месяцам и сервисам
+// (сумма всех строк равна TotalCost с тем же фильтром)
+func (s *SubscriptionService) MonthlySpendBreakdown(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) ([]MonthlySpend, error) {
+	from = normalizeMonth(from)
+	to = normalizeMonth(to)
+
+	subs, err := s.repo.FindActiveInPeriod(ctx, filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []MonthlySpend
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		byService := make(map[string]int)
+		for _, sub := range subs {
+			if activeInMonth(sub, month) {
+				byService[sub.ServiceName] += sub.Price
+			}
+		}
+		names := make([]string, 0, len(byService))
+		for name := range byService {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			result = append(result, MonthlySpend{Month: month, ServiceName: name, Amount: byService[name]})
+		}
+	}
+	return result, nil
+}
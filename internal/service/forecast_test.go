@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// подписка с автопродлением, срок которой закончился до прогноза, идет в projected
+func TestForecastRenewalAfterEnd(t *testing.T) {
+	repo := &fakeSubscriptions{subs: []domain.Subscription{
+		{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Renewing", Price: 300, StartDate: month(2020, 1), EndDate: monthPtr(2020, 12), AutoRenew: true},
+	}}
+	svc := NewSubscriptionService(repo, OverlapAllow)
+
+	forecast, err := svc.Forecast(context.Background(), repository.SubscriptionFilter{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecast) != 3 {
+		t.Fatalf("got %d months, want 3", len(forecast))
+	}
+	for _, mf := range forecast {
+		if mf.Committed != 0 || mf.Projected != 300 {
+			t.Errorf("%s: committed %d, projected %d, want 0, 300", mf.Month.Format("01-2006"), mf.Committed, mf.Projected)
+		}
+	}
+}
+
+// запланированная смена тарифа учитывается, даже если подписка-продолжение не подходит под фильтр
+func TestForecastScheduledPlanChange(t *testing.T) {
+	from := normalizeMonth(time.Now()).AddDate(0, 1, 0)
+	changeEnd := from
+	basic := domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", Price: 300, StartDate: month(2020, 1), EndDate: &changeEnd}
+	premium := basic
+	premium.ID, premium.PreviousID, premium.Price = uuid.New(), &basic.ID, 500
+	premium.StartDate, premium.EndDate, premium.AutoRenew = from.AddDate(0, 1, 0), nil, true
+
+	svc := NewSubscriptionService(&fakeSubscriptions{subs: []domain.Subscription{basic, premium}}, OverlapAllow)
+	startTo := month(2020, 12)
+	forecast, err := svc.Forecast(context.Background(), repository.SubscriptionFilter{StartTo: &startTo}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ committed, projected int }{{300, 0}, {0, 500}, {0, 500}}
+	if len(forecast) != len(want) {
+		t.Fatalf("got %d months, want %d", len(forecast), len(want))
+	}
+	for i, mf := range forecast {
+		if mf.Committed != want[i].committed || mf.Projected != want[i].projected {
+			t.Errorf("%s: committed %d, projected %d, want %d, %d",
+				mf.Month.Format("01-2006"), mf.Committed, mf.Projected, want[i].committed, want[i].projected)
+		}
+	}
+}
+
+// к продолжению применяется фильтр запроса, кроме границ даты начала
+func TestForecastSuccessorFilter(t *testing.T) {
+	from := normalizeMonth(time.Now()).AddDate(0, 1, 0)
+	changeEnd := from
+	basic := domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", Price: 300, StartDate: month(2020, 1), EndDate: &changeEnd}
+	premium := basic
+	premium.ID, premium.PreviousID, premium.Price = uuid.New(), &basic.ID, 500
+	premium.StartDate, premium.EndDate, premium.AutoRenew = from.AddDate(0, 1, 0), nil, true
+	svc := NewSubscriptionService(&fakeSubscriptions{subs: []domain.Subscription{basic, premium}}, OverlapAllow)
+
+	startTo, otherUser := month(2020, 12), uuid.New()
+	priceMax := func(v int) *int { return &v }
+	tests := []struct {
+		name   string
+		filter repository.SubscriptionFilter
+		want   []int
+	}{
+		{"successor matches", repository.SubscriptionFilter{StartTo: &startTo, PriceMax: priceMax(500)}, []int{300, 500, 500}},
+		{"successor filtered by price", repository.SubscriptionFilter{StartTo: &startTo, PriceMax: priceMax(400)}, []int{300, 0, 0}},
+		{"other user", repository.SubscriptionFilter{UserID: &otherUser}, []int{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forecast, err := svc.Forecast(context.Background(), tt.filter, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, mf := range forecast {
+				if got := mf.Committed + mf.Projected; got != tt.want[i] {
+					t.Errorf("%s: got %d, want %d", mf.Month.Format("01-2006"), got, tt.want[i])
+				}
+			}
+		})
+	}
+}
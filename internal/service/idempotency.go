@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+var (
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+// IdempotentResponse - сохраненный ответ, который отдается при повторе запроса
+type IdempotentResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+type IdempotencyService struct {
+	repo repository.IdempotencyKeys
+	ttl  time.Duration
+}
+
+func NewIdempotencyService(repo repository.IdempotencyKeys, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, ttl: ttl}
+}
+
+// Begin занимает ключ под запрос с хешем requestHash.
+// Возвращает сохраненный ответ, если такой запрос уже выполнялся, или nil, если запрос нужно выполнить
+func (s *IdempotencyService) Begin(ctx context.Context, key, requestHash string) (*IdempotentResponse, error) {
+	rec, reserved, err := s.repo.Reserve(ctx, key, requestHash, time.Now().Add(s.ttl))
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+	if rec.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+	if rec.StatusCode == 0 {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return &IdempotentResponse{StatusCode: rec.StatusCode, ContentType: rec.ContentType, Body: rec.Body}, nil
+}
+
+// Finish сохраняет ответ под ключом. Ответы 5xx не сохраняются - ключ освобождается, чтобы запрос можно было повторить
+func (s *IdempotencyService) Finish(ctx context.Context, key string, resp IdempotentResponse) error {
+	if resp.StatusCode >= 500 {
+		return s.repo.Release(ctx, key)
+	}
+	return s.repo.Complete(ctx, key, resp.StatusCode, resp.ContentType, resp.Body)
+}
+
+// Release освобождает ключ без сохранения ответа, например если обработчик запроса запаниковал
+func (s *IdempotencyService) Release(ctx context.Context, key string) error {
+	return s.repo.Release(ctx, key)
+}
+
+// Cleanup удаляет истекшие ключи
+func (s *IdempotencyService) Cleanup(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpired(ctx)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+type ImportStatus string
+
+const (
+	ImportCreated     ImportStatus = "created"
+	ImportWouldCreate ImportStatus = "would_create" // dry-run
+	ImportDuplicate   ImportStatus = "duplicate"
+	ImportInvalid     ImportStatus = "invalid"
+	ImportRejected    ImportStatus = "rejected" // запись отклонена, из-за нее не импортирован весь файл
+)
+
+// ErrImportRejected - запись одной из строк отклонена и ничего не импортировано, причина - в отчете у строки
+var ErrImportRejected = errors.New("import rejected, nothing was imported")
+
+// ImportLineError - непредвиденная ошибка записи строки Line, ничего не импортировано
+type ImportLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *ImportLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *ImportLineError) Unwrap() error {
+	return e.Err
+}
+
+// ImportRow - разобранная строка файла. Если Err != nil, строка невалидна и Subscription не заполнен
+type ImportRow struct {
+	Line         int
+	Subscription *domain.Subscription
+	Err          error
+}
+
+type ImportRowResult struct {
+	Line     int
+	Status   ImportStatus
+	ID       uuid.UUID // для created/would_create
+	Error    string
+	Overlaps []uuid.UUID // пересекающиеся подписки (warn - сохранена, reject - отклонена)
+}
+
+type ImportReport struct {
+	DryRun     bool
+	Total      int
+	Created    int // в dry-run - сколько было бы создано
+	Duplicates int
+	Invalid    int
+	Rejected   int
+	Rows       []ImportRowResult
+}
+
+// Importer принимает строки порциями и проверяет их, ничего не записывая; новые подписки
+// сохраняются одной транзакцией в Commit, поэтому ошибка посреди файла не оставляет импорт наполовину.
+// Дубликаты ищутся и среди существующих подписок, и среди предыдущих строк файла
+type Importer struct {
+	svc    *SubscriptionService
+	policy OverlapPolicy
+	seen   map[repository.SubscriptionKey]struct{}
+	ops    []repository.BulkOp
+	opRows []int // индекс строки отчета для каждой операции ops
+	Report ImportReport
+}
+
+// NewImporter - policy задает проверку пересечений при записи (пустая - политика сервиса)
+func (s *SubscriptionService) NewImporter(dryRun bool, policy OverlapPolicy) *Importer {
+	return &Importer{
+		svc:    s,
+		policy: policy,
+		seen:   make(map[repository.SubscriptionKey]struct{}),
+		Report: ImportReport{DryRun: dryRun, Rows: []ImportRowResult{}},
+	}
+}
+
+func importKey(sub *domain.Subscription) repository.SubscriptionKey {
+	return repository.SubscriptionKey{
+		UserID:      sub.UserID,
+		ServiceName: strings.ToLower(sub.ServiceName),
+		StartDate:   normalizeMonth(sub.StartDate),
+	}
+}
+
+// Add проверяет порцию строк и откладывает новые подписки до Commit
+func (im *Importer) Add(ctx context.Context, rows []ImportRow) error {
+	keys := make([]repository.SubscriptionKey, 0, len(rows))
+	for _, row := range rows {
+		if row.Err == nil {
+			keys = append(keys, importKey(row.Subscription))
+		}
+	}
+	existing, err := im.svc.repo.ExistingKeys(ctx, keys)
+	if err != nil {
+		return err
+	}
+	for _, k := range existing {
+		k.StartDate = normalizeMonth(k.StartDate) // чтобы ключи совпадали и по location
+		im.seen[k] = struct{}{}
+	}
+
+	results := make([]ImportRowResult, 0, len(rows))
+	for _, row := range rows {
+		res := ImportRowResult{Line: row.Line}
+		switch {
+		case row.Err != nil:
+			res.Status = ImportInvalid
+			res.Error = row.Err.Error()
+			im.Report.Invalid++
+		default:
+			key := importKey(row.Subscription)
+			if _, dup := im.seen[key]; dup {
+				res.Status = ImportDuplicate
+				im.Report.Duplicates++
+				break
+			}
+			im.seen[key] = struct{}{}
+
+			row.Subscription.ID = uuid.New()
+			res.ID = row.Subscription.ID
+			res.Status = ImportWouldCreate
+			if !im.Report.DryRun {
+				res.Status = ImportCreated
+				im.ops = append(im.ops, repository.BulkOp{Kind: repository.BulkCreate, ID: res.ID, Subscription: row.Subscription})
+				im.opRows = append(im.opRows, len(im.Report.Rows)+len(results))
+			}
+			im.Report.Created++
+		}
+		results = append(results, res)
+	}
+
+	im.Report.Total += len(rows)
+	im.Report.Rows = append(im.Report.Rows, results...)
+	return nil
+}
+
+// Commit сохраняет все новые подписки файла одной транзакцией, проверяя пересечения по политике импорта
+// (в том числе между строками файла). Если запись строки отклонена (пересечение при reject, занятый id),
+// ничего не сохраняется: строка получает статус rejected с причиной, остальные новые - would_create,
+// и возвращается ErrImportRejected. Другая ошибка записи строки возвращается как *ImportLineError.
+// В dry-run ничего не делает
+func (im *Importer) Commit(ctx context.Context) error {
+	if len(im.ops) == 0 {
+		return nil
+	}
+	overlaps := make([][]domain.Subscription, len(im.ops))
+	for i := range im.ops {
+		im.ops[i].Check = im.svc.overlapCheck(im.policy, &overlaps[i])
+	}
+
+	failed, err := im.svc.repo.BulkAtomic(ctx, im.ops)
+	if err != nil {
+		return im.reject(failed, err)
+	}
+	for i, row := range im.opRows {
+		im.Report.Rows[row].Overlaps = subscriptionIDs(overlaps[i])
+	}
+	return nil
+}
+
+// reject помечает в отчете строку, запись которой отклонена. Ошибки, не связанные со строкой, возвращаются как есть
+func (im *Importer) reject(failed int, err error) error {
+	if failed < 0 {
+		return err
+	}
+	row := &im.Report.Rows[im.opRows[failed]]
+	var overlapErr *OverlapError
+	switch {
+	case errors.As(err, &overlapErr):
+		row.Overlaps = subscriptionIDs(overlapErr.Overlaps)
+	case errors.Is(err, repository.ErrConflict):
+	default:
+		return &ImportLineError{Line: row.Line, Err: err}
+	}
+
+	for _, i := range im.opRows {
+		im.Report.Rows[i].Status = ImportWouldCreate
+	}
+	row.Status = ImportRejected
+	row.ID = uuid.Nil
+	row.Error = err.Error()
+
+	im.Report.Created = 0
+	im.Report.Rejected = 1
+	return ErrImportRejected
+}
+
+func subscriptionIDs(subs []domain.Subscription) []uuid.UUID {
+	if len(subs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(subs))
+	for _, s := range subs {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// ParseImportDate понимает MM-YYYY и ISO (YYYY-MM-DD, YYYY-MM) и приводит дату к первому числу месяца
+func ParseImportDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"01-2006", time.DateOnly, "2006-01"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return normalizeMonth(t), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestParseImportDate(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Time
+		wantOK bool
+	}{
+		{"07-2025", month(2025, time.July), true},
+		{"2025-07-15", month(2025, time.July), true},
+		{"2025-07", month(2025, time.July), true},
+		{"7-2025", time.Time{}, false},
+		{"2025/07/15", time.Time{}, false},
+		{"13-2025", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseImportDate(tt.in)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("ParseImportDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// fakeImport - fakeBulk, который находит уже сохраненные ключи среди своих подписок
+type fakeImport struct {
+	fakeBulk
+}
+
+func (f *fakeImport) ExistingKeys(_ context.Context, keys []repository.SubscriptionKey) ([]repository.SubscriptionKey, error) {
+	var result []repository.SubscriptionKey
+	for _, s := range f.subs {
+		key := repository.SubscriptionKey{UserID: s.UserID, ServiceName: strings.ToLower(s.ServiceName), StartDate: s.StartDate}
+		for _, k := range keys {
+			if k.UserID == key.UserID && k.ServiceName == key.ServiceName && k.StartDate.Equal(key.StartDate) {
+				result = append(result, key)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func TestImporterReport(t *testing.T) {
+	user := uuid.New()
+	existing := []domain.Subscription{
+		{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 399, StartDate: month(2025, time.January)},
+		{ID: uuid.New(), UserID: user, ServiceName: "YouTube", Price: 299, StartDate: month(2025, time.January)},
+	}
+	row := func(line int, service string, start time.Time) ImportRow {
+		return ImportRow{Line: line, Subscription: &domain.Subscription{UserID: user, ServiceName: service, Price: 100, StartDate: start}}
+	}
+	// строки приходят двумя порциями: дубликат ищется и в базе, и в предыдущей порции
+	chunks := func() [][]ImportRow {
+		return [][]ImportRow{
+			{
+				{Line: 2, Err: errors.New("invalid price")},
+				row(3, "netflix", month(2025, time.January).AddDate(0, 0, 14)),
+				row(4, "Spotify", month(2025, time.March)),
+			},
+			{
+				row(5, "SPOTIFY", month(2025, time.March)),
+				row(6, "YouTube", month(2025, time.April)),
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		dryRun     bool
+		want       []ImportStatus
+		wantSaved  int
+		wantWarned int // строка с пересечением в отчете
+	}{
+		{"import", false, []ImportStatus{ImportInvalid, ImportDuplicate, ImportCreated, ImportDuplicate, ImportCreated}, 4, 6},
+		{"dry-run", true, []ImportStatus{ImportInvalid, ImportDuplicate, ImportWouldCreate, ImportDuplicate, ImportWouldCreate}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeImport{fakeBulk{fakeSubscriptions{subs: append([]domain.Subscription(nil), existing...)}}}
+			im := NewSubscriptionService(repo, OverlapAllow).NewImporter(tt.dryRun, OverlapWarn)
+			for _, rows := range chunks() {
+				if err := im.Add(context.Background(), rows); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			if err := im.Commit(context.Background()); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			r := im.Report
+			if r.DryRun != tt.dryRun || r.Total != 5 || r.Created != 2 || r.Duplicates != 2 || r.Invalid != 1 || r.Rejected != 0 {
+				t.Errorf("report = %+v", r)
+			}
+			if len(r.Rows) != len(tt.want) {
+				t.Fatalf("rows = %d, want %d", len(r.Rows), len(tt.want))
+			}
+			for i, res := range r.Rows {
+				if res.Line != i+2 || res.Status != tt.want[i] {
+					t.Errorf("row %d = line %d %s, want line %d %s", i, res.Line, res.Status, i+2, tt.want[i])
+				}
+				created := res.Status == ImportCreated || res.Status == ImportWouldCreate
+				if (res.ID != uuid.Nil) != created {
+					t.Errorf("row %d id = %s", i, res.ID)
+				}
+				warned := res.Line == tt.wantWarned
+				if warned != (len(res.Overlaps) == 1) || (warned && res.Overlaps[0] != existing[1].ID) {
+					t.Errorf("row %d overlaps = %v", i, res.Overlaps)
+				}
+			}
+			if r.Rows[0].Error == "" {
+				t.Error("invalid row without error")
+			}
+			if len(repo.subs) != tt.wantSaved {
+				t.Errorf("saved %d subscriptions, want %d", len(repo.subs), tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestImporterReject(t *testing.T) {
+	newImporter := func() *Importer {
+		im := NewSubscriptionService(&fakeSubscriptions{}, OverlapAllow).NewImporter(false, "")
+		im.Report = ImportReport{
+			Created: 2,
+			Rows: []ImportRowResult{
+				{Line: 2, Status: ImportCreated, ID: uuid.New()},
+				{Line: 3, Status: ImportDuplicate},
+				{Line: 4, Status: ImportCreated, ID: uuid.New()},
+			},
+		}
+		im.opRows = []int{0, 2}
+		return im
+	}
+	dbErr := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		failed   int
+		err      error
+		wantErr  error
+		wantLine int // для *ImportLineError
+	}{
+		{"overlap", 1, &OverlapError{}, ErrImportRejected, 0},
+		{"id conflict", 0, repository.ErrConflict, ErrImportRejected, 0},
+		{"db error of a row", 1, dbErr, dbErr, 4},
+		{"commit error", -1, dbErr, dbErr, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := newImporter()
+			err := im.reject(tt.failed, tt.err)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reject() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var lineErr *ImportLineError
+			if errors.As(err, &lineErr) != (tt.wantLine > 0) || (lineErr != nil && lineErr.Line != tt.wantLine) {
+				t.Errorf("reject() error = %v, want line %d", err, tt.wantLine)
+			}
+			if tt.wantErr != ErrImportRejected {
+				if im.Report.Created != 2 || im.Report.Rows[0].Status != ImportCreated {
+					t.Errorf("report changed on unexpected error: %+v", im.Report)
+				}
+				return
+			}
+
+			rejected := im.Report.Rows[im.opRows[tt.failed]]
+			if rejected.Status != ImportRejected || rejected.ID != uuid.Nil || rejected.Error == "" {
+				t.Errorf("rejected row = %+v", rejected)
+			}
+			other := im.Report.Rows[im.opRows[1-tt.failed]]
+			if other.Status != ImportWouldCreate {
+				t.Errorf("other row status = %s, want %s", other.Status, ImportWouldCreate)
+			}
+			if im.Report.Rows[1].Status != ImportDuplicate {
+				t.Errorf("duplicate row status = %s", im.Report.Rows[1].Status)
+			}
+			if im.Report.Created != 0 || im.Report.Rejected != 1 {
+				t.Errorf("created %d, rejected %d, want 0, 1", im.Report.Created, im.Report.Rejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+var (
+	ErrMergeIDs      = errors.New("merge_ids must be non-empty, unique and differ from the target")
+	ErrMergeMismatch = errors.New("only subscriptions of the same user and service can be merged")
+	ErrInvalidSplit  = errors.New("split month must be after start_date and not after end_date")
+)
+
+// MergeInput - какие подписки влить в целевую и с какой ценой оставить результат
+type MergeInput struct {
+	SourceIDs []uuid.UUID
+	Price     *int // nil - цена целевой подписки
+}
+
+// Merge объединяет подписки одного пользователя на один сервис в targetID:
+// интервал - от самого раннего начала до самого позднего конца (бессрочный, если бессрочна любая),
+// исходные подписки удаляются. Все происходит в одной транзакции и пишется в историю
+func (s *SubscriptionService) Merge(ctx context.Context, targetID uuid.UUID, input MergeInput) (*domain.Subscription, error) {
+	if len(input.SourceIDs) == 0 {
+		return nil, ErrMergeIDs
+	}
+	seen := map[uuid.UUID]bool{targetID: true}
+	for _, id := range input.SourceIDs {
+		if seen[id] {
+			return nil, ErrMergeIDs
+		}
+		seen[id] = true
+	}
+
+	return s.repo.Merge(ctx, targetID, input.SourceIDs, func(target domain.Subscription, sources []domain.Subscription) (domain.Subscription, error) {
+		merged := target
+		for _, src := range sources {
+			if src.UserID != target.UserID || !strings.EqualFold(src.ServiceName, target.ServiceName) {
+				return merged, ErrMergeMismatch
+			}
+			merged.StartDate = minDate(merged.StartDate, src.StartDate)
+			if merged.EndDate != nil {
+				if src.EndDate == nil {
+					merged.EndDate = nil
+				} else {
+					end := maxDate(*merged.EndDate, *src.EndDate)
+					merged.EndDate = &end
+				}
+			}
+		}
+		if input.Price != nil {
+			merged.Price = *input.Price
+		}
+		if merged.EndDate == nil {
+			merged.AutoRenew = true
+		}
+		return merged, nil
+	})
+}
+
+// SplitInput - с какого месяца начинается вторая часть подписки и по какой цене
+type SplitInput struct {
+	Month time.Time
+	Price *int // nil - цена исходной подписки
+}
+
+// Split делит подписку на две: исходная заканчивается за месяц до Month,
+// новая начинается с Month, заканчивается там же, где заканчивалась исходная, и ссылается на нее через PreviousID
+func (s *SubscriptionService) Split(ctx context.Context, id uuid.UUID, input SplitInput) (*domain.Subscription, *domain.Subscription, error) {
+	return s.repo.Split(ctx, id, repository.HistorySplit, splitAt(input.Month, ErrInvalidSplit, func(second *domain.Subscription) {
+		if input.Price != nil {
+			second.Price = *input.Price
+		}
+	}))
+}
+
+// splitAt возвращает SplitFunc, который делит подписку с месяца month; change донастраивает вторую часть.
+// invalid возвращается, если month не позже начала подписки или позже ее конца
+func splitAt(month time.Time, invalid error, change func(second *domain.Subscription)) repository.SplitFunc {
+	month = normalizeMonth(month)
+	return func(sub domain.Subscription) (domain.Subscription, domain.Subscription, error) {
+		if !month.After(normalizeMonth(sub.StartDate)) || (sub.EndDate != nil && month.After(normalizeMonth(*sub.EndDate))) {
+			return sub, sub, invalid
+		}
+
+		second := sub
+		second.ID = uuid.New()
+		second.StartDate = month
+		second.PreviousID = &sub.ID
+		change(&second)
+
+		first := sub
+		firstEnd := month.AddDate(0, -1, 0)
+		first.EndDate = &firstEnd
+		first.AutoRenew = false // ее продолжает вторая часть
+		return first, second, nil
+	}
+}
+
+func (s *SubscriptionService) History(ctx context.Context, id uuid.UUID) ([]repository.HistoryEntry, error) {
+	return s.repo.History(ctx, id)
+}
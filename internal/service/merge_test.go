@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// fakeChanges сохраняет результат Merge/Split/Change в памяти; при ошибке функции ничего не меняет
+type fakeChanges struct {
+	repository.Subscriptions
+	subs map[uuid.UUID]domain.Subscription
+}
+
+func newFakeChanges(subs ...domain.Subscription) *fakeChanges {
+	f := &fakeChanges{subs: make(map[uuid.UUID]domain.Subscription, len(subs))}
+	for _, s := range subs {
+		f.subs[s.ID] = s
+	}
+	return f
+}
+
+func (f *fakeChanges) Merge(_ context.Context, targetID uuid.UUID, sourceIDs []uuid.UUID, merge repository.MergeFunc) (*domain.Subscription, error) {
+	target, ok := f.subs[targetID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	sources := make([]domain.Subscription, 0, len(sourceIDs))
+	for _, id := range sourceIDs {
+		src, ok := f.subs[id]
+		if !ok {
+			return nil, repository.ErrNotFound
+		}
+		sources = append(sources, src)
+	}
+	merged, err := merge(target, sources)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sourceIDs {
+		delete(f.subs, id)
+	}
+	f.subs[targetID] = merged
+	return &merged, nil
+}
+
+func (f *fakeChanges) Split(_ context.Context, id uuid.UUID, _ repository.HistoryAction, split repository.SplitFunc) (*domain.Subscription, *domain.Subscription, error) {
+	sub, ok := f.subs[id]
+	if !ok {
+		return nil, nil, repository.ErrNotFound
+	}
+	first, second, err := split(sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	f.subs[first.ID] = first
+	f.subs[second.ID] = second
+	return &first, &second, nil
+}
+
+func (f *fakeChanges) Change(_ context.Context, id uuid.UUID, _ repository.HistoryAction, change repository.ChangeFunc) (*domain.Subscription, error) {
+	sub, ok := f.subs[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	changed, err := change(sub)
+	if err != nil {
+		return nil, err
+	}
+	f.subs[id] = changed
+	return &changed, nil
+}
+
+func TestMerge(t *testing.T) {
+	user := uuid.New()
+	target := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 399, StartDate: month(2025, 3), EndDate: monthPtr(2025, 6)}
+	earlier := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "netflix", Price: 299, StartDate: month(2025, 1), EndDate: monthPtr(2025, 4)}
+	later := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 499, StartDate: month(2025, 5), EndDate: monthPtr(2025, 9)}
+	open := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 499, StartDate: month(2025, 7), AutoRenew: true}
+	otherUser := domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", StartDate: month(2025, 1)}
+	otherService := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "Kion", StartDate: month(2025, 1)}
+
+	tests := []struct {
+		name          string
+		sources       []uuid.UUID
+		price         *int
+		wantErr       error
+		wantStart     time.Time
+		wantEnd       *time.Time
+		wantPrice     int
+		wantAutoRenew bool
+	}{
+		{name: "no sources", wantErr: ErrMergeIDs},
+		{name: "target among sources", sources: []uuid.UUID{earlier.ID, target.ID}, wantErr: ErrMergeIDs},
+		{name: "repeated source", sources: []uuid.UUID{earlier.ID, earlier.ID}, wantErr: ErrMergeIDs},
+		{name: "other user", sources: []uuid.UUID{earlier.ID, otherUser.ID}, wantErr: ErrMergeMismatch},
+		{name: "other service", sources: []uuid.UUID{otherService.ID}, wantErr: ErrMergeMismatch},
+		{name: "missing source", sources: []uuid.UUID{uuid.New()}, wantErr: repository.ErrNotFound},
+		{name: "widest interval", sources: []uuid.UUID{earlier.ID, later.ID},
+			wantStart: month(2025, 1), wantEnd: monthPtr(2025, 9), wantPrice: 399},
+		{name: "open-ended source", sources: []uuid.UUID{later.ID, open.ID}, price: intPtr(450),
+			wantStart: month(2025, 3), wantPrice: 450, wantAutoRenew: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeChanges(target, earlier, later, open, otherUser, otherService)
+			svc := NewSubscriptionService(repo, OverlapAllow)
+			got, err := svc.Merge(context.Background(), target.ID, MergeInput{SourceIDs: tt.sources, Price: tt.price})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Merge() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.subs) != 6 || repo.subs[target.ID] != target {
+					t.Error("subscriptions changed on error")
+				}
+				return
+			}
+
+			if got.ID != target.ID || !got.StartDate.Equal(tt.wantStart) || got.Price != tt.wantPrice || got.AutoRenew != tt.wantAutoRenew {
+				t.Errorf("Merge() = %+v", got)
+			}
+			if (got.EndDate == nil) != (tt.wantEnd == nil) || (got.EndDate != nil && !got.EndDate.Equal(*tt.wantEnd)) {
+				t.Errorf("end_date = %v, want %v", got.EndDate, tt.wantEnd)
+			}
+			for _, id := range tt.sources {
+				if _, ok := repo.subs[id]; ok {
+					t.Errorf("source %s not deleted", id)
+				}
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	fixed := domain.Subscription{ID: uuid.New(), ServiceName: "Netflix", Price: 399, StartDate: month(2025, 1), EndDate: monthPtr(2025, 6)}
+	open := domain.Subscription{ID: uuid.New(), ServiceName: "Netflix", Price: 399, StartDate: month(2025, 1), AutoRenew: true}
+
+	tests := []struct {
+		name      string
+		sub       domain.Subscription
+		month     time.Time
+		price     *int
+		wantErr   error
+		wantPrice int
+	}{
+		{name: "at start", sub: fixed, month: month(2025, 1), wantErr: ErrInvalidSplit},
+		{name: "before start", sub: fixed, month: month(2024, 12), wantErr: ErrInvalidSplit},
+		{name: "after end", sub: fixed, month: month(2025, 7), wantErr: ErrInvalidSplit},
+		{name: "last month", sub: fixed, month: month(2025, 6), wantPrice: 399},
+		{name: "mid-month date", sub: fixed, month: month(2025, 3).AddDate(0, 0, 14), price: intPtr(499), wantPrice: 499},
+		{name: "open-ended", sub: open, month: month(2025, 3), wantPrice: 399},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeChanges(tt.sub)
+			first, second, err := NewSubscriptionService(repo, OverlapAllow).Split(context.Background(), tt.sub.ID, SplitInput{Month: tt.month, Price: tt.price})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Split() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.subs) != 1 {
+					t.Error("subscriptions changed on error")
+				}
+				return
+			}
+
+			splitMonth := normalizeMonth(tt.month)
+			if first.ID != tt.sub.ID || first.Price != tt.sub.Price || first.AutoRenew ||
+				first.EndDate == nil || !first.EndDate.Equal(splitMonth.AddDate(0, -1, 0)) {
+				t.Errorf("first = %+v", first)
+			}
+			if second.ID == tt.sub.ID || second.PreviousID == nil || *second.PreviousID != tt.sub.ID ||
+				!second.StartDate.Equal(splitMonth) || second.Price != tt.wantPrice || second.AutoRenew != tt.sub.AutoRenew {
+				t.Errorf("second = %+v", second)
+			}
+			if (second.EndDate == nil) != (tt.sub.EndDate == nil) || (second.EndDate != nil && !second.EndDate.Equal(*tt.sub.EndDate)) {
+				t.Errorf("second end_date = %v, want %v", second.EndDate, tt.sub.EndDate)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int { return &v }
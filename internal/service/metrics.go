@@ -0,0 +1,46 @@
+package service
+
+import (
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+// SubscriptionMetrics - вычисляемые атрибуты подписки на момент now.
+// Списание происходит первого числа каждого месяца, текущий месяц считается уже оплаченным
+type SubscriptionMetrics struct {
+	MonthlyCost     int
+	MonthsActive    int        // оплаченных месяцев с начала подписки по текущий включительно
+	LifetimeCost    int        // потрачено на подписку к текущему месяцу
+	RemainingMonths *int       // сколько месяцев еще будет списание, nil для бессрочной и с автопродлением
+	NextChargeDate  *time.Time // nil, если списаний больше не будет
+}
+
+func ComputeMetrics(sub domain.Subscription, now time.Time) SubscriptionMetrics {
+	current := normalizeMonth(now)
+	next := current.AddDate(0, 1, 0)
+	start := normalizeMonth(sub.StartDate)
+
+	m := SubscriptionMetrics{MonthlyCost: sub.Price}
+
+	// подписка с автопродлением оплачивается и после end_date, как в TotalCost
+	end := sub.EffectiveEnd()
+
+	paidUntil := current
+	if end != nil {
+		paidUntil = minDate(paidUntil, normalizeMonth(*end))
+	}
+	m.MonthsActive = monthsBetweenInclusive(start, paidUntil)
+	m.LifetimeCost = m.MonthsActive * sub.Price
+
+	chargeFrom := maxDate(start, next)
+	if end != nil {
+		remaining := monthsBetweenInclusive(chargeFrom, normalizeMonth(*end))
+		m.RemainingMonths = &remaining
+		if remaining == 0 {
+			return m
+		}
+	}
+	m.NextChargeDate = &chargeFrom
+	return m
+}
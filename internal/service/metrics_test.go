@@ -0,0 +1,63 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	remaining := func(n int) *int { return &n }
+
+	tests := []struct {
+		name string
+		sub  domain.Subscription
+		want SubscriptionMetrics
+	}{
+		{
+			name: "open-ended",
+			sub:  domain.Subscription{Price: 100, StartDate: month(2025, 1)},
+			want: SubscriptionMetrics{MonthlyCost: 100, MonthsActive: 6, LifetimeCost: 600, NextChargeDate: monthPtr(2025, 7)},
+		},
+		{
+			name: "ends later",
+			sub:  domain.Subscription{Price: 100, StartDate: month(2025, 1), EndDate: monthPtr(2025, 8)},
+			want: SubscriptionMetrics{MonthlyCost: 100, MonthsActive: 6, LifetimeCost: 600, RemainingMonths: remaining(2), NextChargeDate: monthPtr(2025, 7)},
+		},
+		{
+			name: "ends this month",
+			sub:  domain.Subscription{Price: 100, StartDate: month(2025, 1), EndDate: monthPtr(2025, 6)},
+			want: SubscriptionMetrics{MonthlyCost: 100, MonthsActive: 6, LifetimeCost: 600, RemainingMonths: remaining(0)},
+		},
+		{
+			name: "already ended",
+			sub:  domain.Subscription{Price: 100, StartDate: month(2025, 1), EndDate: monthPtr(2025, 3)},
+			want: SubscriptionMetrics{MonthlyCost: 100, MonthsActive: 3, LifetimeCost: 300, RemainingMonths: remaining(0)},
+		},
+		{
+			name: "starts this month",
+			sub:  domain.Subscription{Price: 250, StartDate: month(2025, 6)},
+			want: SubscriptionMetrics{MonthlyCost: 250, MonthsActive: 1, LifetimeCost: 250, NextChargeDate: monthPtr(2025, 7)},
+		},
+		{
+			name: "not started yet",
+			sub:  domain.Subscription{Price: 100, StartDate: month(2025, 9)},
+			want: SubscriptionMetrics{MonthlyCost: 100, NextChargeDate: monthPtr(2025, 9)},
+		},
+		{
+			name: "not started yet with end",
+			sub:  domain.Subscription{Price: 100, StartDate: month(2025, 9), EndDate: monthPtr(2025, 10)},
+			want: SubscriptionMetrics{MonthlyCost: 100, RemainingMonths: remaining(2), NextChargeDate: monthPtr(2025, 9)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeMetrics(tt.sub, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ComputeMetrics() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
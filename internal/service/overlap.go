@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// OverlapPolicy - что делать, если подписка пересекается по времени с другой подпиской
+// того же пользователя на тот же сервис (такие подписки считаются в TotalCost дважды)
+type OverlapPolicy string
+
+const (
+	OverlapReject OverlapPolicy = "reject" // не сохранять, ErrOverlap
+	OverlapWarn   OverlapPolicy = "warn"   // сохранить и вернуть пересечения
+	OverlapAllow  OverlapPolicy = "allow"  // не проверять
+)
+
+func ParseOverlapPolicy(s string) (OverlapPolicy, bool) {
+	switch p := OverlapPolicy(s); p {
+	case OverlapReject, OverlapWarn, OverlapAllow:
+		return p, true
+	}
+	return "", false
+}
+
+var ErrOverlap = errors.New("subscription overlaps an existing subscription of the same user and service")
+
+// OverlapError - подписка отклонена политикой reject, Overlaps - с чем она пересекается
+type OverlapError struct {
+	Overlaps []domain.Subscription
+}
+
+func (e *OverlapError) Error() string {
+	return ErrOverlap.Error()
+}
+
+func (e *OverlapError) Unwrap() error {
+	return ErrOverlap
+}
+
+// overlapCheck возвращает проверку политики (пустая - политика сервиса по умолчанию) для сохранения подписки.
+// Для warn найденные пересечения записываются в overlaps, для reject при пересечениях сохранение
+// отменяется с *OverlapError. Для allow - nil, подписка сохраняется без проверки
+func (s *SubscriptionService) overlapCheck(policy OverlapPolicy, overlaps *[]domain.Subscription) repository.OverlapCheck {
+	if policy == "" {
+		policy = s.overlapPolicy
+	}
+	if policy == OverlapAllow {
+		return nil
+	}
+	return func(found []domain.Subscription) error {
+		if len(found) > 0 && policy == OverlapReject {
+			return &OverlapError{Overlaps: found}
+		}
+		*overlaps = found
+		return nil
+	}
+}
+
+// Duplicate - пара пересекающихся подписок одного пользователя на один сервис
+type Duplicate struct {
+	First, Second domain.Subscription
+	OverlapFrom   time.Time
+	OverlapTo     *time.Time // nil - обе подписки бессрочные
+	OverlapMonths *int       // nil для бессрочного пересечения
+}
+
+// FindDuplicates ищет пересекающиеся подписки по всем данным (с учетом фильтра)
+func (s *SubscriptionService) FindDuplicates(ctx context.Context, filter repository.SubscriptionFilter) ([]Duplicate, error) {
+	pairs, err := s.repo.FindOverlapPairs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Duplicate, 0, len(pairs))
+	for _, p := range pairs {
+		d := Duplicate{
+			First:       p.First,
+			Second:      p.Second,
+			OverlapFrom: maxDate(normalizeMonth(p.First.StartDate), normalizeMonth(p.Second.StartDate)),
+		}
+		switch {
+		case p.First.EndDate != nil && p.Second.EndDate != nil:
+			to := minDate(normalizeMonth(*p.First.EndDate), normalizeMonth(*p.Second.EndDate))
+			d.OverlapTo = &to
+		case p.First.EndDate != nil:
+			to := normalizeMonth(*p.First.EndDate)
+			d.OverlapTo = &to
+		case p.Second.EndDate != nil:
+			to := normalizeMonth(*p.Second.EndDate)
+			d.OverlapTo = &to
+		}
+		if d.OverlapTo != nil {
+			months := monthsBetweenInclusive(d.OverlapFrom, *d.OverlapTo)
+			d.OverlapMonths = &months
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestOverlapCheck(t *testing.T) {
+	found := []domain.Subscription{{ID: uuid.New()}}
+	svc := NewSubscriptionService(&fakeSubscriptions{}, OverlapWarn)
+
+	if svc.overlapCheck(OverlapAllow, new([]domain.Subscription)) != nil {
+		t.Error("allow: want no check")
+	}
+
+	var overlaps []domain.Subscription
+	if err := svc.overlapCheck("", &overlaps)(found); err != nil || len(overlaps) != 1 {
+		t.Errorf("default warn: err %v, overlaps %d, want nil, 1", err, len(overlaps))
+	}
+
+	overlaps = nil
+	err := svc.overlapCheck(OverlapReject, &overlaps)(found)
+	var overlapErr *OverlapError
+	if !errors.As(err, &overlapErr) || len(overlapErr.Overlaps) != 1 || overlaps != nil {
+		t.Errorf("reject: err %v, overlaps %d", err, len(overlaps))
+	}
+	if err := svc.overlapCheck(OverlapReject, &overlaps)(nil); err != nil {
+		t.Errorf("reject without overlaps: %v", err)
+	}
+}
+
+// fakeBulk выполняет пакет над подписками в памяти: проверка операции видит подписки,
+// записанные предыдущими операциями, atomic при ошибке все откатывает
+type fakeBulk struct {
+	fakeSubscriptions
+}
+
+func (f *fakeBulk) overlapping(sub domain.Subscription) []domain.Subscription {
+	var result []domain.Subscription
+	for _, s := range f.subs {
+		if s.ID == sub.ID || s.UserID != sub.UserID || !strings.EqualFold(s.ServiceName, sub.ServiceName) {
+			continue
+		}
+		if (sub.EndDate == nil || !s.StartDate.After(*sub.EndDate)) && (s.EndDate == nil || !sub.StartDate.After(*s.EndDate)) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (f *fakeBulk) apply(op repository.BulkOp) error {
+	if op.Check != nil {
+		if err := op.Check(f.overlapping(*op.Subscription)); err != nil {
+			return err
+		}
+	}
+	f.subs = append(f.subs, *op.Subscription) // в тестах только create
+	return nil
+}
+
+func (f *fakeBulk) BulkAtomic(_ context.Context, ops []repository.BulkOp) (int, error) {
+	saved := len(f.subs)
+	for i, op := range ops {
+		if err := f.apply(op); err != nil {
+			f.subs = f.subs[:saved]
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+func (f *fakeBulk) BulkBestEffort(_ context.Context, ops []repository.BulkOp) []error {
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		errs[i] = f.apply(op)
+	}
+	return errs
+}
+
+func (f *fakeBulk) ExistingKeys(context.Context, []repository.SubscriptionKey) ([]repository.SubscriptionKey, error) {
+	return nil, nil
+}
+
+func TestBulkOverlapPolicy(t *testing.T) {
+	user := uuid.New()
+	existing := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 100, StartDate: month(2025, time.January)}
+	newOps := func() []repository.BulkOp {
+		create := func(service string, start time.Time) repository.BulkOp {
+			return repository.BulkOp{Kind: repository.BulkCreate, Subscription: &domain.Subscription{UserID: user, ServiceName: service, Price: 100, StartDate: start}}
+		}
+		return []repository.BulkOp{
+			create("netflix", month(2025, time.March)),   // пересекается с существующей
+			create("Spotify", month(2025, time.January)), // без пересечений
+			create("Spotify", month(2025, time.June)),    // пересекается с предыдущей операцией пакета
+		}
+	}
+
+	tests := []struct {
+		name         string
+		policy       OverlapPolicy
+		bestEffort   bool
+		wantOverlaps []int // число пересечений по операциям
+		wantFailed   []bool
+		wantIndex    int // atomic: индекс отклоненной операции, -1 - пакет сохранен
+	}{
+		{name: "warn", policy: OverlapWarn, wantOverlaps: []int{1, 0, 1}, wantIndex: -1},
+		{name: "allow", policy: OverlapAllow, wantOverlaps: []int{0, 0, 0}, wantIndex: -1},
+		{name: "reject atomic", policy: OverlapReject, wantIndex: 0},
+		{name: "reject best effort", policy: OverlapReject, bestEffort: true, wantOverlaps: []int{0, 0, 0}, wantFailed: []bool{true, false, true}, wantIndex: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeBulk{fakeSubscriptions{subs: []domain.Subscription{existing}}}
+			svc := NewSubscriptionService(repo, OverlapAllow)
+
+			var items []BulkItem
+			var err error
+			if tt.bestEffort {
+				items, err = svc.BulkBestEffort(context.Background(), newOps(), tt.policy)
+			} else {
+				items, err = svc.BulkAtomic(context.Background(), newOps(), tt.policy)
+			}
+
+			var opErr *BulkOpError
+			if tt.wantIndex >= 0 {
+				if !errors.As(err, &opErr) || opErr.Index != tt.wantIndex || !errors.Is(err, ErrOverlap) {
+					t.Fatalf("error = %v, want overlap at operation %d", err, tt.wantIndex)
+				}
+				if len(repo.subs) != 1 {
+					t.Errorf("%d subscriptions after rejected bulk, want 1", len(repo.subs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			for i, item := range items {
+				if len(item.Overlaps) != tt.wantOverlaps[i] {
+					t.Errorf("operation %d: %d overlaps, want %d", i, len(item.Overlaps), tt.wantOverlaps[i])
+				}
+				if tt.wantFailed != nil && (item.Err != nil) != tt.wantFailed[i] {
+					t.Errorf("operation %d: error %v, want failed %v", i, item.Err, tt.wantFailed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImporterCommitOverlap(t *testing.T) {
+	user := uuid.New()
+	existing := domain.Subscription{ID: uuid.New(), UserID: user, ServiceName: "Netflix", Price: 100, StartDate: month(2025, time.January)}
+	rows := func() []ImportRow {
+		return []ImportRow{
+			{Line: 2, Subscription: &domain.Subscription{UserID: user, ServiceName: "Spotify", Price: 100, StartDate: month(2025, time.January)}},
+			{Line: 3, Err: errors.New("invalid price")},
+			{Line: 4, Subscription: &domain.Subscription{UserID: user, ServiceName: "Netflix", Price: 100, StartDate: month(2025, time.May)}},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		policy       OverlapPolicy
+		wantErr      error
+		wantStatuses []ImportStatus
+		wantCreated  int
+	}{
+		{"warn", OverlapWarn, nil, []ImportStatus{ImportCreated, ImportInvalid, ImportCreated}, 2},
+		{"reject", OverlapReject, ErrImportRejected, []ImportStatus{ImportWouldCreate, ImportInvalid, ImportRejected}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeBulk{fakeSubscriptions{subs: []domain.Subscription{existing}}}
+			im := NewSubscriptionService(repo, OverlapAllow).NewImporter(false, tt.policy)
+			if err := im.Add(context.Background(), rows()); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			if err := im.Commit(context.Background()); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Commit() error = %v, want %v", err, tt.wantErr)
+			}
+			for i, row := range im.Report.Rows {
+				if row.Status != tt.wantStatuses[i] {
+					t.Errorf("line %d: status %s, want %s", row.Line, row.Status, tt.wantStatuses[i])
+				}
+			}
+			// строка 4 пересекается с существующей подпиской
+			if got := im.Report.Rows[2].Overlaps; len(got) != 1 || got[0] != existing.ID {
+				t.Errorf("line 4: overlaps %v, want [%s]", got, existing.ID)
+			}
+			if im.Report.Created != tt.wantCreated {
+				t.Errorf("created = %d, want %d", im.Report.Created, tt.wantCreated)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+var ErrInvalidPlanChange = errors.New("effective_from must be after start_date and not after end_date")
+
+type ChangePlanInput struct {
+	Plan          string
+	Price         *int      // nil - цена текущей подписки
+	EffectiveFrom time.Time // первый месяц на новом тарифе
+}
+
+// ChangePlan переводит подписку на другой тариф с месяца EffectiveFrom: текущая подписка
+// заканчивается месяцем раньше, новая продолжает ее (PreviousID) с новым тарифом и ценой.
+// Возвращает старую и новую подписки
+func (s *SubscriptionService) ChangePlan(ctx context.Context, id uuid.UUID, input ChangePlanInput) (*domain.Subscription, *domain.Subscription, error) {
+	return s.repo.Split(ctx, id, repository.HistoryPlanChange, splitAt(input.EffectiveFrom, ErrInvalidPlanChange, func(next *domain.Subscription) {
+		plan := input.Plan
+		next.Plan = &plan
+		if input.Price != nil {
+			next.Price = *input.Price
+		}
+	}))
+}
+
+// MRRMovement - изменение месячной выручки (MRR) за месяц по сравнению с предыдущим.
+// Смена тарифа (подписка с PreviousID, продолжающая подписку прошлого месяца) считается
+// расширением или сокращением, а не оттоком и новой подпиской
+type MRRMovement struct {
+	Month       time.Time
+	MRR         int // сумма цен подписок, активных в месяце
+	New         int // новые подписки
+	Expansion   int // рост цены при смене тарифа
+	Contraction int // снижение цены при смене тарифа, положительное число
+	Churn       int // закончившиеся подписки без продолжения, положительное число
+	Net         int // New + Expansion - Contraction - Churn = MRR - MRR прошлого месяца
+}
+
+// MRRMovements считает движение MRR по месяцам периода [from, to]
+func (s *SubscriptionService) MRRMovements(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) ([]MRRMovement, error) {
+	from, to = normalizeMonth(from), normalizeMonth(to)
+	// месяц перед периодом нужен как база для первого месяца
+	subs, err := s.repo.FindActiveInPeriod(ctx, filter, from.AddDate(0, -1, 0), to)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]domain.Subscription, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+	}
+
+	result := make([]MRRMovement, 0, monthsBetweenInclusive(from, to))
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		prev := month.AddDate(0, -1, 0)
+		m := MRRMovement{Month: month}
+
+		active := make(map[uuid.UUID]domain.Subscription)
+		continued := make(map[uuid.UUID]bool) // подписки прошлого месяца, продолженные сменой тарифа
+		for _, sub := range subs {
+			if activeInMonth(sub, month) {
+				active[sub.ID] = sub
+			}
+		}
+		for _, sub := range active {
+			m.MRR += sub.Price
+			if activeInMonth(sub, prev) {
+				continue
+			}
+			if sub.PreviousID != nil {
+				if p, ok := byID[*sub.PreviousID]; ok && activeInMonth(p, prev) {
+					continued[p.ID] = true
+					if delta := sub.Price - p.Price; delta > 0 {
+						m.Expansion += delta
+					} else {
+						m.Contraction -= delta
+					}
+					continue
+				}
+			}
+			m.New += sub.Price
+		}
+		for _, sub := range subs {
+			if _, ok := active[sub.ID]; !ok && activeInMonth(sub, prev) && !continued[sub.ID] {
+				m.Churn += sub.Price
+			}
+		}
+		m.Net = m.New + m.Expansion - m.Contraction - m.Churn
+		result = append(result, m)
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestMRRMovements(t *testing.T) {
+	basic := domain.Subscription{ID: uuid.New(), Price: 200, StartDate: month(2025, 1), EndDate: monthPtr(2025, 3)}
+	premium := domain.Subscription{ID: uuid.New(), Price: 300, StartDate: month(2025, 4), PreviousID: &basic.ID}
+	family := domain.Subscription{ID: uuid.New(), Price: 400, StartDate: month(2025, 1), EndDate: monthPtr(2025, 4)}
+	single := domain.Subscription{ID: uuid.New(), Price: 250, StartDate: month(2025, 5), PreviousID: &family.ID}
+	late := domain.Subscription{ID: uuid.New(), Price: 300, StartDate: month(2025, 4), PreviousID: &basic.ID}
+	basicUntilFeb := basic
+	basicUntilFeb.EndDate = monthPtr(2025, 2)
+
+	tests := []struct {
+		name string
+		subs []domain.Subscription
+		from time.Time
+		to   time.Time
+		want []MRRMovement
+	}{
+		{
+			name: "new, plan changes and churn",
+			subs: []domain.Subscription{
+				{ID: uuid.New(), Price: 100, StartDate: month(2025, 1)},
+				basic, premium, family, single,
+				{ID: uuid.New(), Price: 150, StartDate: month(2025, 4)},
+				{ID: uuid.New(), Price: 50, StartDate: month(2025, 2), EndDate: monthPtr(2025, 4)},
+			},
+			from: month(2025, 3), to: month(2025, 5),
+			want: []MRRMovement{
+				{Month: month(2025, 3), MRR: 750},
+				{Month: month(2025, 4), MRR: 1000, New: 150, Expansion: 100, Net: 250},
+				{Month: month(2025, 5), MRR: 800, Contraction: 150, Churn: 50, Net: -200},
+			},
+		},
+		{
+			name: "previous subscription not loaded",
+			subs: []domain.Subscription{premium},
+			from: month(2025, 4), to: month(2025, 4),
+			want: []MRRMovement{{Month: month(2025, 4), MRR: 300, New: 300, Net: 300}},
+		},
+		{
+			name: "gap between plans is churn and new",
+			subs: []domain.Subscription{basicUntilFeb, late},
+			from: month(2025, 3), to: month(2025, 4),
+			want: []MRRMovement{
+				{Month: month(2025, 3), Churn: 200, Net: -200},
+				{Month: month(2025, 4), MRR: 300, New: 300, Net: 300},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewSubscriptionService(&fakeSubscriptions{subs: tt.subs}, OverlapAllow)
+			got, err := svc.MRRMovements(context.Background(), repository.SubscriptionFilter{}, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("MRRMovements() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MRRMovements() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
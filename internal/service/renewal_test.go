@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// Подписка с автопродлением, срок которой истек, во всех расчетах оплачивается и дальше,
+// а такая же подписка без автопродления заканчивается на end_date
+func TestRenewalConsistency(t *testing.T) {
+	now := normalizeMonth(time.Now())
+	ago := func(n int) time.Time { return now.AddDate(0, -n, 0) }
+	agoPtr := func(n int) *time.Time { m := ago(n); return &m }
+
+	renewing := domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", Price: 100, StartDate: ago(3), EndDate: agoPtr(1), AutoRenew: true}
+	ended := domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Spotify", Price: 10, StartDate: ago(3), EndDate: agoPtr(1)}
+	svc := NewSubscriptionService(&fakeSubscriptions{subs: []domain.Subscription{renewing, ended}}, OverlapAllow)
+	ctx := context.Background()
+	byUser := func(sub domain.Subscription) repository.SubscriptionFilter {
+		return repository.SubscriptionFilter{UserID: &sub.UserID}
+	}
+
+	// [ago(3), now+2]: 6 месяцев продленной подписки и 3 месяца закончившейся
+	from, to := ago(3), now.AddDate(0, 2, 0)
+	total, err := svc.TotalCost(ctx, repository.SubscriptionFilter{}, from, to)
+	if err != nil || total != 630 {
+		t.Errorf("TotalCost() = %d, %v, want 630", total, err)
+	}
+	spend, err := svc.MonthlySpendBreakdown(ctx, repository.SubscriptionFilter{}, from, to)
+	if err != nil {
+		t.Fatalf("MonthlySpendBreakdown() error = %v", err)
+	}
+	sum := 0
+	for _, s := range spend {
+		sum += s.Amount
+	}
+	if sum != total {
+		t.Errorf("MonthlySpendBreakdown() sums to %d, want %d", sum, total)
+	}
+
+	// в каждом месяце после окончания срока все расчеты видят одно списание продленной подписки
+	mrr, err := svc.MRRMovements(ctx, repository.SubscriptionFilter{}, now, to)
+	if err != nil {
+		t.Fatalf("MRRMovements() error = %v", err)
+	}
+	charges, err := svc.UpcomingCharges(ctx, renewing.UserID, now, 90)
+	if err != nil {
+		t.Fatalf("UpcomingCharges() error = %v", err)
+	}
+	forecast, err := svc.Forecast(ctx, repository.SubscriptionFilter{}, 2)
+	if err != nil {
+		t.Fatalf("Forecast() error = %v", err)
+	}
+	budgets := NewBudgetService(&fakeBudgets{}, svc)
+	for i := range 3 {
+		month := now.AddDate(0, i, 0)
+		if got, _ := svc.TotalCost(ctx, repository.SubscriptionFilter{}, month, month); got != 100 {
+			t.Errorf("%s: TotalCost() = %d, want 100", month.Format("01-2006"), got)
+		}
+		if mrr[i].MRR != 100 {
+			t.Errorf("%s: MRR = %d, want 100", month.Format("01-2006"), mrr[i].MRR)
+		}
+		st, err := budgets.status(ctx, domain.Budget{UserID: renewing.UserID, MonthlyLimit: 1000}, month)
+		if err != nil || st.Spend != 100 {
+			t.Errorf("%s: budget spend = %d, %v, want 100", month.Format("01-2006"), st.Spend, err)
+		}
+		charged := 0
+		for _, c := range charges {
+			if c.Date.Equal(month) {
+				charged += c.Amount
+				if !c.Renewal {
+					t.Errorf("%s: charge is not a renewal", month.Format("01-2006"))
+				}
+			}
+		}
+		if charged != 100 {
+			t.Errorf("%s: upcoming charges = %d, want 100", month.Format("01-2006"), charged)
+		}
+		if i > 0 {
+			if f := forecast[i-1]; f.Committed+f.Projected != 100 {
+				t.Errorf("%s: forecast = %d, want 100", month.Format("01-2006"), f.Committed+f.Projected)
+			}
+		}
+	}
+	// закончившаяся подписка уходит в отток в первом месяце после end_date, продленная - нет
+	if mrr[0].Churn != 10 {
+		t.Errorf("churn = %d, want 10", mrr[0].Churn)
+	}
+
+	m := ComputeMetrics(renewing, now)
+	lifetime, _ := svc.TotalCost(ctx, byUser(renewing), renewing.StartDate, now)
+	if m.MonthsActive != 4 || m.LifetimeCost != lifetime || m.RemainingMonths != nil || m.NextChargeDate == nil || !m.NextChargeDate.Equal(now.AddDate(0, 1, 0)) {
+		t.Errorf("ComputeMetrics() = %+v, want 4 months, lifetime %d, no end, next charge next month", m, lifetime)
+	}
+
+	cohorts, err := svc.Retention(ctx, repository.SubscriptionFilter{}, ago(3), ago(3))
+	if err != nil {
+		t.Fatalf("Retention() error = %v", err)
+	}
+	if want := []float64{1, 1, 1, 0.5}; len(cohorts) != 1 || !equalFloats(cohorts[0].Retention, want) {
+		t.Errorf("Retention() = %+v, want %v", cohorts, want)
+	}
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// RetentionCohort - когорта подписок, начавшихся в одном месяце
+type RetentionCohort struct {
+	Month time.Time
+	Size  int
+	// Retention[n] - доля подписок когорты, активных через n месяцев после старта
+	Retention []float64
+}
+
+// Retention строит когортную матрицу удержания для подписок, стартовавших в [from, to].
+// Колонки считаются только до текущего месяца включительно, поэтому матрица "треугольная".
+func (s *SubscriptionService) Retention(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) ([]RetentionCohort, error) {
+	from = normalizeMonth(from)
+	to = normalizeMonth(to)
+	now := normalizeMonth(time.Now())
+	if to.After(now) {
+		to = now // будущие когорты еще не наблюдались
+	}
+	if to.Before(from) {
+		return []RetentionCohort{}, nil
+	}
+
+	subs, err := s.repo.FindActiveInPeriod(ctx, filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+	// старая часть смены тарифа или split удерживается, пока действует ее продолжение
+	subs, err = s.withSuccessors(ctx, subs, filter)
+	if err != nil {
+		return nil, err
+	}
+	next := make(map[uuid.UUID][]domain.Subscription)
+	for _, sub := range subs {
+		if sub.PreviousID != nil {
+			next[*sub.PreviousID] = append(next[*sub.PreviousID], sub)
+		}
+	}
+	var retained func(sub domain.Subscription, month time.Time) bool
+	retained = func(sub domain.Subscription, month time.Time) bool {
+		if activeInMonth(sub, month) { // с автопродлением подписка удерживается и после end_date
+			return true
+		}
+		for _, succ := range next[sub.ID] {
+			if retained(succ, month) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cohortCount := monthsBetweenInclusive(from, to)
+	// active[i][n] - сколько подписок когорты i активны через n месяцев
+	sizes := make([]int, cohortCount)
+	active := make([][]int, cohortCount)
+	for i := range active {
+		cohortMonth := from.AddDate(0, i, 0)
+		active[i] = make([]int, monthsBetweenInclusive(cohortMonth, now))
+	}
+
+	for _, sub := range subs {
+		start := normalizeMonth(sub.StartDate)
+		if start.Before(from) {
+			continue // FindActiveInPeriod отдает и более ранние подписки, они не из наших когорт
+		}
+		if sub.PreviousID != nil {
+			continue // продолжение - не новая подписка, удерживается в когорте исходной
+		}
+		i := monthsBetweenInclusive(from, start) - 1
+		sizes[i]++
+		for n := range active[i] {
+			month := start.AddDate(0, n, 0)
+			if !retained(sub, month) {
+				break
+			}
+			active[i][n]++
+		}
+	}
+
+	result := make([]RetentionCohort, 0, cohortCount)
+	for i := range active {
+		if sizes[i] == 0 {
+			continue
+		}
+		cohort := RetentionCohort{
+			Month:     from.AddDate(0, i, 0),
+			Size:      sizes[i],
+			Retention: make([]float64, len(active[i])),
+		}
+		for n, cnt := range active[i] {
+			cohort.Retention[n] = math.Round(float64(cnt)/float64(sizes[i])*10000) / 10000
+		}
+		result = append(result, cohort)
+	}
+	return result, nil
+}
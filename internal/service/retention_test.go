@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestRetention(t *testing.T) {
+	// матрица считается до текущего месяца, поэтому месяцы - относительно него
+	now := normalizeMonth(time.Now())
+	ago := func(n int) time.Time { return now.AddDate(0, -n, 0) }
+	agoPtr := func(n int) *time.Time { m := ago(n); return &m }
+	sub := func(start time.Time, end *time.Time) domain.Subscription {
+		return domain.Subscription{ID: uuid.New(), ServiceName: "Netflix", Price: 100, StartDate: start, EndDate: end}
+	}
+
+	// смена тарифа: старая часть закончилась, продолжение действует
+	basic, premium := sub(ago(2), agoPtr(1)), sub(now, nil)
+	premium.PreviousID = &basic.ID
+	first, second := sub(ago(3), agoPtr(2)), sub(ago(1), agoPtr(1))
+	second.PreviousID = &first.ID
+
+	tests := []struct {
+		name     string
+		subs     []domain.Subscription
+		from, to time.Time
+		want     []RetentionCohort
+	}{
+		{
+			name: "one cohort",
+			subs: []domain.Subscription{sub(ago(2), nil), sub(ago(2), agoPtr(1)), sub(ago(2), agoPtr(2))},
+			from: ago(2), to: ago(2),
+			want: []RetentionCohort{{Month: ago(2), Size: 3, Retention: []float64{1, 0.6667, 0.3333}}},
+		},
+		{
+			name: "earlier subscriptions and empty cohorts skipped",
+			subs: []domain.Subscription{sub(ago(5), nil), sub(ago(1), nil)},
+			from: ago(2), to: now,
+			want: []RetentionCohort{{Month: ago(1), Size: 1, Retention: []float64{1, 1}}},
+		},
+		{
+			name: "future months clamped to now",
+			subs: []domain.Subscription{sub(now, nil)},
+			from: now, to: now.AddDate(0, 3, 0),
+			want: []RetentionCohort{{Month: now, Size: 1, Retention: []float64{1}}},
+		},
+		{
+			name: "several cohorts",
+			subs: []domain.Subscription{sub(ago(2), agoPtr(2)), sub(ago(1), nil), sub(ago(1), agoPtr(1))},
+			from: ago(2), to: ago(1),
+			want: []RetentionCohort{
+				{Month: ago(2), Size: 1, Retention: []float64{1, 0, 0}},
+				{Month: ago(1), Size: 2, Retention: []float64{1, 0.5}},
+			},
+		},
+		{
+			name: "plan change is not churn",
+			subs: []domain.Subscription{basic, premium},
+			from: ago(2), to: now,
+			want: []RetentionCohort{{Month: ago(2), Size: 1, Retention: []float64{1, 1, 1}}},
+		},
+		{
+			name: "continued subscription ends",
+			subs: []domain.Subscription{first, second},
+			from: ago(3), to: ago(3),
+			want: []RetentionCohort{{Month: ago(3), Size: 1, Retention: []float64{1, 1, 1, 0}}},
+		},
+		{
+			name: "period in the future",
+			subs: []domain.Subscription{sub(now, nil)},
+			from: now.AddDate(0, 1, 0), to: now.AddDate(0, 2, 0),
+			want: []RetentionCohort{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewSubscriptionService(&fakeSubscriptions{subs: tt.subs}, OverlapAllow)
+			got, err := svc.Retention(context.Background(), repository.SubscriptionFilter{}, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Retention() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Retention() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
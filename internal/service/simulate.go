@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+const MaxSimulationChanges = 100
+
+// SimulationChangeType - гипотетическое изменение подписок в симуляции итоговой суммы
+type SimulationChangeType string
+
+const (
+	SimulateCancel  SimulationChangeType = "cancel"  // подписка не оплачивается с EffectiveFrom
+	SimulateAdd     SimulationChangeType = "add"     // новая подписка с EffectiveFrom
+	SimulateReprice SimulationChangeType = "reprice" // новая цена с EffectiveFrom
+)
+
+var (
+	ErrTooManyChanges        = fmt.Errorf("too many changes, max %d", MaxSimulationChanges)
+	ErrInvalidChange         = errors.New("invalid change")
+	ErrSimulationSubNotFound = errors.New("subscription is not active in the period or does not match the filter")
+)
+
+type SimulationChange struct {
+	Type           SimulationChangeType
+	SubscriptionID uuid.UUID  // для cancel и reprice
+	EffectiveFrom  *time.Time // первый месяц, к которому применяется изменение; nil - начало периода
+	// для add; UserID = uuid.Nil - пользователь из фильтра
+	UserID      uuid.UUID
+	ServiceName string
+	EndDate     *time.Time
+	Price       int // для add и reprice
+}
+
+// SimulationLine - вклад подписки в итоговую сумму до и после изменений.
+// SubscriptionID = nil - подписка добавлена симуляцией
+type SimulationLine struct {
+	SubscriptionID *uuid.UUID
+	ServiceName    string
+	Baseline       int
+	Simulated      int
+}
+
+type Simulation struct {
+	Baseline  int
+	Simulated int
+	Lines     []SimulationLine
+}
+
+// simRow - подписка (или ее часть после reprice) в симуляции, line - индекс строки результата
+type simRow struct {
+	sub  domain.Subscription
+	line int
+}
+
+// SimulateTotal считает TotalQuery как есть и после применения changes по порядку.
+// Изменения применяются в памяти к подпискам из FindActiveInPeriod и никуда не сохраняются
+func (s *SubscriptionService) SimulateTotal(ctx context.Context, q TotalQuery, changes []SimulationChange) (*Simulation, error) {
+	if len(changes) > MaxSimulationChanges {
+		return nil, ErrTooManyChanges
+	}
+	from, to := normalizeMonth(q.From), normalizeMonth(q.To)
+
+	subs, err := s.repo.FindActiveInPeriod(ctx, q.Filter, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Simulation{Lines: make([]SimulationLine, 0, len(subs))}
+	rows := make([]simRow, 0, len(subs))
+	lineByID := make(map[uuid.UUID]int, len(subs))
+	for _, sub := range subs {
+		id := sub.ID
+		line := SimulationLine{SubscriptionID: &id, ServiceName: sub.ServiceName, Baseline: costLine(sub, from, to).Amount}
+		result.Baseline += line.Baseline
+		lineByID[sub.ID] = len(result.Lines)
+		rows = append(rows, simRow{sub: sub, line: len(result.Lines)})
+		result.Lines = append(result.Lines, line)
+	}
+
+	for i, ch := range changes {
+		effective := from
+		if ch.EffectiveFrom != nil {
+			effective = normalizeMonth(*ch.EffectiveFrom)
+		}
+
+		switch ch.Type {
+		case SimulateCancel, SimulateReprice:
+			line, ok := lineByID[ch.SubscriptionID]
+			if !ok {
+				return nil, fmt.Errorf("change %d: %w", i, ErrSimulationSubNotFound)
+			}
+			if ch.Type == SimulateReprice && ch.Price < 0 {
+				return nil, fmt.Errorf("change %d: %w: price must be non-negative", i, ErrInvalidChange)
+			}
+			rows = applyToLine(rows, line, effective, ch)
+		case SimulateAdd:
+			sub, err := simulatedSubscription(ch, effective, q)
+			if err != nil {
+				return nil, fmt.Errorf("change %d: %w", i, err)
+			}
+			rows = append(rows, simRow{sub: sub, line: len(result.Lines)})
+			result.Lines = append(result.Lines, SimulationLine{ServiceName: sub.ServiceName})
+		default:
+			return nil, fmt.Errorf("change %d: %w: unknown type %q", i, ErrInvalidChange, ch.Type)
+		}
+	}
+
+	for _, row := range rows {
+		amount := costLine(row.sub, from, to).Amount
+		result.Lines[row.line].Simulated += amount
+		result.Simulated += amount
+	}
+	return result, nil
+}
+
+// applyToLine применяет cancel или reprice ко всем частям подписки строки line
+func applyToLine(rows []simRow, line int, effective time.Time, ch SimulationChange) []simRow {
+	result := make([]simRow, 0, len(rows)+1)
+	for _, row := range rows {
+		if row.line != line {
+			result = append(result, row)
+			continue
+		}
+		before, hasBefore := endBefore(row.sub, effective)
+		if hasBefore {
+			result = append(result, simRow{sub: before, line: line})
+		}
+		// часть с effective: при отмене ее нет, при смене цены - та же подписка с новой ценой
+		if ch.Type == SimulateReprice && activeSince(row.sub, effective) {
+			after := row.sub
+			after.StartDate = maxDate(normalizeMonth(row.sub.StartDate), effective)
+			after.Price = ch.Price
+			result = append(result, simRow{sub: after, line: line})
+		}
+	}
+	return result
+}
+
+// endBefore обрезает подписку так, чтобы последним месяцем был месяц перед month.
+// false - подписка начинается не раньше month и до него ничего не остается
+func endBefore(sub domain.Subscription, month time.Time) (domain.Subscription, bool) {
+	last := month.AddDate(0, -1, 0)
+	if last.Before(normalizeMonth(sub.StartDate)) {
+		return sub, false
+	}
+	if end := sub.EffectiveEnd(); end == nil || normalizeMonth(*end).After(last) {
+		sub.EndDate = &last
+		sub.AutoRenew = false // иначе обрезанная часть продлевалась бы дальше
+	}
+	return sub, true
+}
+
+// activeSince - оплачивается ли подписка в month или позже
+func activeSince(sub domain.Subscription, month time.Time) bool {
+	end := sub.EffectiveEnd()
+	return end == nil || !normalizeMonth(*end).Before(month)
+}
+
+func simulatedSubscription(ch SimulationChange, effective time.Time, q TotalQuery) (domain.Subscription, error) {
+	userID := ch.UserID
+	if userID == uuid.Nil && q.Filter.UserID != nil {
+		userID = *q.Filter.UserID
+	}
+	switch {
+	case userID == uuid.Nil:
+		return domain.Subscription{}, fmt.Errorf("%w: user_id is required when the filter has none", ErrInvalidChange)
+	case ch.ServiceName == "":
+		return domain.Subscription{}, fmt.Errorf("%w: service_name is required", ErrInvalidChange)
+	case ch.Price < 0:
+		return domain.Subscription{}, fmt.Errorf("%w: price must be non-negative", ErrInvalidChange)
+	case ch.EndDate != nil && normalizeMonth(*ch.EndDate).Before(effective):
+		return domain.Subscription{}, fmt.Errorf("%w: end_date is before effective_from", ErrInvalidChange)
+	}
+
+	sub := domain.Subscription{
+		UserID:      userID,
+		ServiceName: ch.ServiceName,
+		Price:       ch.Price,
+		StartDate:   effective,
+		AutoRenew:   ch.EndDate == nil,
+	}
+	if ch.EndDate != nil {
+		end := normalizeMonth(*ch.EndDate)
+		sub.EndDate = &end
+	}
+	return sub, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+)
+
+func TestEndBefore(t *testing.T) {
+	tests := []struct {
+		name    string
+		sub     domain.Subscription
+		month   time.Time
+		wantEnd *time.Time
+		wantOK  bool
+	}{
+		{"open-ended", domain.Subscription{StartDate: month(2025, 1)}, month(2025, 6), monthPtr(2025, 5), true},
+		{"ends later", domain.Subscription{StartDate: month(2025, 1), EndDate: monthPtr(2025, 12)}, month(2025, 6), monthPtr(2025, 5), true},
+		{"ends earlier", domain.Subscription{StartDate: month(2025, 1), EndDate: monthPtr(2025, 3)}, month(2025, 6), monthPtr(2025, 3), true},
+		{"one month left", domain.Subscription{StartDate: month(2025, 5)}, month(2025, 6), monthPtr(2025, 5), true},
+		{"starts in month", domain.Subscription{StartDate: month(2025, 6)}, month(2025, 6), nil, false},
+		{"starts later", domain.Subscription{StartDate: month(2025, 8)}, month(2025, 6), nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := endBefore(tt.sub, tt.month)
+			if ok != tt.wantOK {
+				t.Fatalf("endBefore() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got.EndDate, tt.wantEnd) {
+				t.Errorf("endBefore() end = %v, want %v", got.EndDate, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestApplyToLine(t *testing.T) {
+	open := domain.Subscription{ID: uuid.New(), Price: 100, StartDate: month(2025, 1)}
+	fixed := domain.Subscription{ID: uuid.New(), Price: 200, StartDate: month(2025, 1), EndDate: monthPtr(2025, 12)}
+	rows := []simRow{{sub: open, line: 0}, {sub: fixed, line: 1}}
+
+	// with возвращает копию подписки с другими сроками и ценой
+	with := func(sub domain.Subscription, start time.Time, end *time.Time, price int) domain.Subscription {
+		sub.StartDate, sub.EndDate, sub.Price = start, end, price
+		return sub
+	}
+	type change struct {
+		line      int
+		effective time.Time
+		ch        SimulationChange
+	}
+	cancel := SimulationChange{Type: SimulateCancel}
+	reprice := SimulationChange{Type: SimulateReprice, Price: 150}
+
+	tests := []struct {
+		name    string
+		changes []change
+		want    []simRow
+	}{
+		{"cancel", []change{{0, month(2025, 6), cancel}}, []simRow{
+			{sub: with(open, month(2025, 1), monthPtr(2025, 5), 100), line: 0},
+			{sub: fixed, line: 1},
+		}},
+		{"cancel from start", []change{{0, month(2025, 1), cancel}}, []simRow{
+			{sub: fixed, line: 1},
+		}},
+		{"reprice", []change{{1, month(2025, 6), reprice}}, []simRow{
+			{sub: open, line: 0},
+			{sub: with(fixed, month(2025, 1), monthPtr(2025, 5), 200), line: 1},
+			{sub: with(fixed, month(2025, 6), monthPtr(2025, 12), 150), line: 1},
+		}},
+		{"reprice after end", []change{{1, month(2026, 2), reprice}}, []simRow{
+			{sub: open, line: 0},
+			{sub: fixed, line: 1},
+		}},
+		{"reprice then cancel", []change{{0, month(2025, 6), reprice}, {0, month(2025, 9), cancel}}, []simRow{
+			{sub: with(open, month(2025, 1), monthPtr(2025, 5), 100), line: 0},
+			{sub: with(open, month(2025, 6), monthPtr(2025, 8), 150), line: 0},
+			{sub: fixed, line: 1},
+		}},
+		// более ранняя смена цены перекрывает обе части прежней
+		{"earlier reprice overrides", []change{{0, month(2025, 6), reprice}, {0, month(2025, 3), SimulationChange{Type: SimulateReprice, Price: 50}}}, []simRow{
+			{sub: with(open, month(2025, 1), monthPtr(2025, 2), 100), line: 0},
+			{sub: with(open, month(2025, 3), monthPtr(2025, 5), 50), line: 0},
+			{sub: with(open, month(2025, 6), nil, 50), line: 0},
+			{sub: fixed, line: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rows
+			for _, c := range tt.changes {
+				got = applyToLine(got, c.line, c.effective, c.ch)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyToLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
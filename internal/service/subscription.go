@@ -10,23 +10,33 @@ import (
 )
 
 type SubscriptionService struct {
-	repo repository.Subscriptions
+	repo          repository.Subscriptions
+	overlapPolicy OverlapPolicy // политика по умолчанию для пересекающихся подписок
 }
 
-func NewSubscriptionService(repo repository.Subscriptions) *SubscriptionService {
-	return &SubscriptionService{repo: repo}
+func NewSubscriptionService(repo repository.Subscriptions, overlapPolicy OverlapPolicy) *SubscriptionService {
+	return &SubscriptionService{repo: repo, overlapPolicy: overlapPolicy}
 }
 
 type CreateSubscriptionInput struct {
+	ID          *uuid.UUID // id, присвоенный клиентом; nil - сгенерировать
 	ServiceName string
 	Price       int
 	UserID      uuid.UUID
 	StartDate   time.Time
 	EndDate     *time.Time // Для будущих операций обновления/создания с end_date (опционально)
+	Plan        *string
+	AutoRenew   *bool // nil - true для бессрочной подписки, false при заданном EndDate
+	// OverlapPolicy переопределяет политику сервиса для этого запроса (пустая - по умолчанию)
+	OverlapPolicy OverlapPolicy
 }
 
-func (s *SubscriptionService) Create(ctx context.Context, input CreateSubscriptionInput) (uuid.UUID, error) {
+// Create создает подписку и возвращает ее id и пересечения с другими подписками (при политике warn)
+func (s *SubscriptionService) Create(ctx context.Context, input CreateSubscriptionInput) (uuid.UUID, []domain.Subscription, error) {
 	id := uuid.New()
+	if input.ID != nil {
+		id = *input.ID
+	}
 	sub := &domain.Subscription{
 		ID:          id,
 		UserID:      input.UserID,
@@ -34,27 +44,72 @@ func (s *SubscriptionService) Create(ctx context.Context, input CreateSubscripti
 		Price:       input.Price,
 		StartDate:   input.StartDate,
 		EndDate:     input.EndDate,
+		Plan:        input.Plan,
+		AutoRenew:   input.EndDate == nil,
+	}
+	if input.AutoRenew != nil {
+		sub.AutoRenew = *input.AutoRenew
 	}
-	if err := s.repo.Create(ctx, sub); err != nil {
-		return uuid.Nil, err
+	var overlaps []domain.Subscription
+	if err := s.repo.Create(ctx, sub, s.overlapCheck(input.OverlapPolicy, &overlaps)); err != nil {
+		return uuid.Nil, nil, err
 	}
-	return id, nil
+	return id, overlaps, nil
 }
 
 func (s *SubscriptionService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Subscription, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *SubscriptionService) Update(ctx context.Context, sub *domain.Subscription) error {
-	return s.repo.Update(ctx, sub)
+// Update обновляет подписку и возвращает ее пересечения с другими подписками (при политике warn)
+func (s *SubscriptionService) Update(ctx context.Context, sub *domain.Subscription, policy OverlapPolicy) ([]domain.Subscription, error) {
+	var overlaps []domain.Subscription
+	if err := s.repo.Update(ctx, sub, s.overlapCheck(policy, &overlaps)); err != nil {
+		return nil, err
+	}
+	return overlaps, nil
+}
+
+// Upsert создает подписку с заданным id или заменяет существующую. Возвращает true, если подписка создана
+func (s *SubscriptionService) Upsert(ctx context.Context, sub *domain.Subscription, policy OverlapPolicy) (bool, []domain.Subscription, error) {
+	var overlaps []domain.Subscription
+	created, err := s.repo.Upsert(ctx, sub, s.overlapCheck(policy, &overlaps))
+	if err != nil {
+		return false, nil, err
+	}
+	return created, overlaps, nil
 }
 
 func (s *SubscriptionService) Delete(ctx context.Context, id uuid.UUID) error {
-	return s.repo.Delete(ctx, id)
+	_, err := s.repo.Delete(ctx, id)
+	return err
+}
+
+// List возвращает страницу подписок и курсор следующей страницы (nil, если страница последняя)
+func (s *SubscriptionService) List(ctx context.Context, filter repository.SubscriptionFilter, page repository.Page) ([]domain.Subscription, *repository.Cursor, error) {
+	if len(page.Sort) == 0 {
+		page.Sort = repository.DefaultSort
+	}
+	limit := page.Limit
+	page.Limit++ // берем на одну строку больше, чтобы понять, есть ли следующая страница
+	items, err := s.repo.List(ctx, filter, page)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+
+	items = items[:limit]
+	return items, repository.NewCursor(page.Sort, items[limit-1]), nil
 }
 
-func (s *SubscriptionService) List(ctx context.Context, filter repository.SubscriptionFilter, limit, offset int) ([]domain.Subscription, error) {
-	return s.repo.List(ctx, filter, limit, offset)
+func (s *SubscriptionService) Stream(ctx context.Context, filter repository.SubscriptionFilter, sort []repository.SortKey, fn func(domain.Subscription) error) error {
+	return s.repo.Stream(ctx, filter, sort, fn)
+}
+
+func (s *SubscriptionService) Count(ctx context.Context, filter repository.SubscriptionFilter) (int, error) {
+	return s.repo.Count(ctx, filter)
 }
 
 // _________________функции для рассчета итоговой суммы __________________
@@ -90,31 +145,59 @@ func minDate(a, b time.Time) time.Time {
 
 // _________________ итоговая сумма _________________
 
+// CostLine - вклад одной подписки в итоговую сумму
+type CostLine struct {
+	Subscription domain.Subscription
+	Left         time.Time // начало пересечения подписки с периодом
+	Right        time.Time // конец пересечения (включительно)
+	Months       int
+	Amount       int
+}
+
 func (s *SubscriptionService) TotalCost(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) (int, error) {
+	total, _, err := s.TotalCostExplain(ctx, filter, from, to)
+	return total, err
+}
+
+// TotalCostExplain считает итоговую сумму и возвращает построчную расшифровку по каждой подписке
+func (s *SubscriptionService) TotalCostExplain(ctx context.Context, filter repository.SubscriptionFilter, from, to time.Time) (int, []CostLine, error) {
 	from = normalizeMonth(from)
 	to = normalizeMonth(to)
 
 	subs, err := s.repo.FindActiveInPeriod(ctx, filter, from, to)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	total := 0
+	lines := make([]CostLine, 0, len(subs))
 	for _, sub := range subs {
-		left := maxDate(sub.StartDate, from)
-
-		// Если end_date = NULL - до конца
-		rightCandidate := to
-		if sub.EndDate != nil {
-			rightCandidate = *sub.EndDate
-		}
-		right := minDate(rightCandidate, to)
-
-		months := monthsBetweenInclusive(left, right)
-		if months > 0 {
-			total += sub.Price * months
+		line := costLine(sub, from, to)
+		if line.Months > 0 {
+			total += line.Amount
+			lines = append(lines, line)
 		}
 	}
 
-	return total, nil
+	return total, lines, nil
+}
+
+func costLine(sub domain.Subscription, from, to time.Time) CostLine {
+	left := maxDate(sub.StartDate, from)
+
+	// без конца (EffectiveEnd = nil) - до конца периода
+	rightCandidate := to
+	if end := sub.EffectiveEnd(); end != nil {
+		rightCandidate = *end
+	}
+	right := minDate(rightCandidate, to)
+
+	months := monthsBetweenInclusive(left, right)
+	return CostLine{
+		Subscription: sub,
+		Left:         left,
+		Right:        right,
+		Months:       months,
+		Amount:       sub.Price * months,
+	}
 }
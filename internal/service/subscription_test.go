@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestTotalCostExplain(t *testing.T) {
+	sub := func(name string, price int, start time.Time, end *time.Time, autoRenew bool) domain.Subscription {
+		return domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: name, Price: price, StartDate: start, EndDate: end, AutoRenew: autoRenew}
+	}
+	type line struct {
+		service     string
+		left, right time.Time
+		months      int
+		amount      int
+	}
+
+	tests := []struct {
+		name      string
+		subs      []domain.Subscription
+		from, to  time.Time
+		wantTotal int
+		want      []line
+	}{
+		{
+			name: "open-ended clipped to period",
+			subs: []domain.Subscription{sub("Netflix", 100, month(2024, 6), nil, false)},
+			from: month(2025, 1), to: month(2025, 6),
+			wantTotal: 600,
+			want:      []line{{"Netflix", month(2025, 1), month(2025, 6), 6, 600}},
+		},
+		{
+			name: "inside period",
+			subs: []domain.Subscription{sub("Spotify", 10, month(2025, 3), monthPtr(2025, 4), false)},
+			from: month(2025, 1), to: month(2025, 6),
+			wantTotal: 20,
+			want:      []line{{"Spotify", month(2025, 3), month(2025, 4), 2, 20}},
+		},
+		{
+			name: "auto-renew continues after end_date",
+			subs: []domain.Subscription{sub("Kion", 50, month(2024, 1), monthPtr(2025, 2), true)},
+			from: month(2025, 1), to: month(2025, 6),
+			wantTotal: 300,
+			want:      []line{{"Kion", month(2025, 1), month(2025, 6), 6, 300}},
+		},
+		{
+			name: "outside period",
+			subs: []domain.Subscription{
+				sub("Netflix", 100, month(2024, 1), monthPtr(2024, 12), false),
+				sub("Spotify", 10, month(2025, 7), nil, false),
+			},
+			from: month(2025, 1), to: month(2025, 6),
+			wantTotal: 0,
+		},
+		{
+			name: "several subscriptions, one month",
+			subs: []domain.Subscription{
+				sub("Netflix", 100, month(2025, 1), nil, false),
+				sub("Spotify", 10, month(2024, 1), monthPtr(2025, 3), false),
+			},
+			from: month(2025, 3), to: month(2025, 3),
+			wantTotal: 110,
+			want: []line{
+				{"Netflix", month(2025, 3), month(2025, 3), 1, 100},
+				{"Spotify", month(2025, 3), month(2025, 3), 1, 10},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewSubscriptionService(&fakeSubscriptions{subs: tt.subs}, OverlapAllow)
+			total, lines, err := svc.TotalCostExplain(context.Background(), repository.SubscriptionFilter{}, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d", len(lines), len(tt.want))
+			}
+			sum := 0
+			for i, l := range lines {
+				sum += l.Amount
+				got := line{l.Subscription.ServiceName, l.Left, l.Right, l.Months, l.Amount}
+				if got != tt.want[i] {
+					t.Errorf("line %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+			if sum != total {
+				t.Errorf("lines sum to %d, total %d", sum, total)
+			}
+		})
+	}
+}
+
+func TestListNextCursor(t *testing.T) {
+	var subs []domain.Subscription
+	for i := range 5 {
+		subs = append(subs, domain.Subscription{ID: uuid.New(), ServiceName: "Netflix", Price: 100, StartDate: month(2025, time.Month(5-i))})
+	}
+	svc := NewSubscriptionService(&fakeSubscriptions{subs: subs}, OverlapAllow)
+
+	tests := []struct {
+		name      string
+		page      repository.Page
+		wantItems int
+		wantAfter *domain.Subscription // последняя строка страницы, если есть следующая
+	}{
+		{"more pages", repository.Page{Limit: 2}, 2, &subs[1]},
+		{"exactly the rest", repository.Page{Limit: 2, Offset: 3}, 2, nil},
+		{"limit covers all", repository.Page{Limit: 5}, 5, nil},
+		{"custom sort", repository.Page{Limit: 3, Sort: []repository.SortKey{{Field: repository.SortPrice, Desc: true}}}, 3, &subs[2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, next, err := svc.List(context.Background(), repository.SubscriptionFilter{}, tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != tt.wantItems {
+				t.Errorf("got %d items, want %d", len(items), tt.wantItems)
+			}
+			if tt.wantAfter == nil {
+				if next != nil {
+					t.Errorf("next = %+v, want nil on the last page", next)
+				}
+				return
+			}
+			sort := tt.page.Sort
+			if len(sort) == 0 {
+				sort = repository.DefaultSort
+			}
+			want := repository.NewCursor(sort, *tt.wantAfter)
+			if next == nil || next.ID != want.ID || !slices.Equal(next.Values, want.Values) {
+				t.Errorf("next = %+v, want %+v", next, want)
+			}
+		})
+	}
+}
+
+func TestPrepareBulkClientID(t *testing.T) {
+	clientID := uuid.New()
+	updateID := uuid.New()
+	ops := []repository.BulkOp{
+		{Kind: repository.BulkCreate, Subscription: &domain.Subscription{}},
+		{Kind: repository.BulkCreate, ID: clientID, Subscription: &domain.Subscription{}},
+		{Kind: repository.BulkUpdate, ID: updateID, Subscription: &domain.Subscription{}},
+		{Kind: repository.BulkDelete, ID: updateID},
+	}
+	items, err := NewSubscriptionService(&fakeSubscriptions{}, OverlapAllow).prepareBulk(ops, "")
+	if err != nil {
+		t.Fatalf("prepareBulk() error = %v", err)
+	}
+
+	if items[0].ID == uuid.Nil || items[0].ID == clientID || ops[0].Subscription.ID != items[0].ID {
+		t.Errorf("generated id: item %s, subscription %s", items[0].ID, ops[0].Subscription.ID)
+	}
+	for i, want := range []uuid.UUID{clientID, updateID} {
+		if items[i+1].ID != want || ops[i+1].Subscription.ID != want {
+			t.Errorf("operation %d: item %s, subscription %s, want %s", i+1, items[i+1].ID, ops[i+1].Subscription.ID, want)
+		}
+	}
+	if items[3].ID != updateID {
+		t.Errorf("delete id = %s, want %s", items[3].ID, updateID)
+	}
+}
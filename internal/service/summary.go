@@ -0,0 +1,95 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+const (
+	summaryTopServices = 5
+	summaryEndsMonths  = 3 // окно "скоро закончатся": текущий месяц и два следующих
+	summaryEndsLimit   = 10
+)
+
+// SpendStats - агрегаты расходов на момент месяца, суммы - как в TotalCost
+type SpendStats struct {
+	ActiveCount   int // подписок, оплачиваемых в месяце
+	MonthlySpend  int // сумма их цен
+	YearSpend     int // потрачено с января года по месяц включительно
+	LifetimeSpend int // потрачено за все время по месяц включительно
+}
+
+// ServiceSpend - расходы на сервис в месяц
+type ServiceSpend struct {
+	ServiceName   string
+	MonthlySpend  int
+	Subscriptions int
+}
+
+// UserSummary - сводка расходов пользователя на текущий месяц
+type UserSummary struct {
+	Month time.Time
+	SpendStats
+	TopServices  []ServiceSpend        // самые дорогие сервисы в текущем месяце
+	UpcomingEnds []domain.Subscription // закончатся без продления в ближайшие месяцы
+}
+
+// UserSummary считает сводку по тем же правилам продления, что TotalCost и UpcomingCharges
+func (s *SubscriptionService) UserSummary(ctx context.Context, userID uuid.UUID, now time.Time) (*UserSummary, error) {
+	month := normalizeMonth(now)
+	endsTo := month.AddDate(0, summaryEndsMonths-1, 0)
+	yearStart := time.Date(month.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// все подписки пользователя, начавшиеся не позже конца окна окончаний
+	subs, err := s.repo.FindActiveInPeriod(ctx, repository.SubscriptionFilter{UserID: &userID}, time.Time{}, endsTo)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &UserSummary{Month: month}
+	services := make(map[string]*ServiceSpend)
+	for _, sub := range subs {
+		summary.YearSpend += costLine(sub, yearStart, month).Amount
+		summary.LifetimeSpend += costLine(sub, sub.StartDate, month).Amount
+
+		if activeInMonth(sub, month) {
+			summary.ActiveCount++
+			summary.MonthlySpend += sub.Price
+			ss, ok := services[sub.ServiceName]
+			if !ok {
+				ss = &ServiceSpend{ServiceName: sub.ServiceName}
+				services[sub.ServiceName] = ss
+			}
+			ss.MonthlySpend += sub.Price
+			ss.Subscriptions++
+		}
+
+		if end := sub.EffectiveEnd(); end != nil && !end.Before(month) && !end.After(endsTo) {
+			summary.UpcomingEnds = append(summary.UpcomingEnds, sub)
+		}
+	}
+
+	for _, ss := range services {
+		summary.TopServices = append(summary.TopServices, *ss)
+	}
+	slices.SortFunc(summary.TopServices, func(a, b ServiceSpend) int {
+		return cmp.Or(cmp.Compare(b.MonthlySpend, a.MonthlySpend), cmp.Compare(a.ServiceName, b.ServiceName))
+	})
+	if len(summary.TopServices) > summaryTopServices {
+		summary.TopServices = summary.TopServices[:summaryTopServices]
+	}
+
+	slices.SortFunc(summary.UpcomingEnds, func(a, b domain.Subscription) int {
+		return cmp.Or(a.EndDate.Compare(*b.EndDate), cmp.Compare(a.ServiceName, b.ServiceName))
+	})
+	if len(summary.UpcomingEnds) > summaryEndsLimit {
+		summary.UpcomingEnds = summary.UpcomingEnds[:summaryEndsLimit]
+	}
+	return summary, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestUserSummary(t *testing.T) {
+	userID := uuid.New()
+	renewing := domain.Subscription{ID: uuid.New(), UserID: userID, ServiceName: "Netflix", Price: 100, StartDate: month(2024, 11), EndDate: monthPtr(2025, 3), AutoRenew: true}
+	renewsInWindow := domain.Subscription{ID: uuid.New(), UserID: userID, ServiceName: "Kion", Price: 30, StartDate: month(2025, 1), EndDate: monthPtr(2025, 7), AutoRenew: true}
+	ending := domain.Subscription{ID: uuid.New(), UserID: userID, ServiceName: "Spotify", Price: 10, StartDate: month(2025, 2), EndDate: monthPtr(2025, 7)}
+	ended := domain.Subscription{ID: uuid.New(), UserID: userID, ServiceName: "Yandex Plus", Price: 50, StartDate: month(2024, 1), EndDate: monthPtr(2025, 1)}
+	future := domain.Subscription{ID: uuid.New(), UserID: userID, ServiceName: "Spotify", Price: 20, StartDate: month(2025, 7), EndDate: monthPtr(2025, 8)}
+	other := domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", Price: 1000, StartDate: month(2025, 1)}
+	svc := NewSubscriptionService(&fakeSubscriptions{subs: []domain.Subscription{renewing, renewsInWindow, ending, ended, future, other}}, OverlapAllow)
+	ctx := context.Background()
+
+	s, err := svc.UserSummary(ctx, userID, time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := SpendStats{ActiveCount: 3, MonthlySpend: 140, YearSpend: 880, LifetimeSpend: 1680}
+	if !s.Month.Equal(month(2025, 6)) || s.SpendStats != want {
+		t.Errorf("UserSummary() = %v %+v, want 06-2025 %+v", s.Month, s.SpendStats, want)
+	}
+
+	// суммы совпадают с TotalCost за те же месяцы
+	filter := repository.SubscriptionFilter{UserID: &userID}
+	for _, tt := range []struct {
+		name string
+		from time.Time
+		got  int
+	}{
+		{"monthly", month(2025, 6), s.MonthlySpend},
+		{"year", month(2025, 1), s.YearSpend},
+		{"lifetime", month(2020, 1), s.LifetimeSpend},
+	} {
+		total, err := svc.TotalCost(ctx, filter, tt.from, month(2025, 6))
+		if err != nil || total != tt.got {
+			t.Errorf("%s: TotalCost() = %d, %v, summary has %d", tt.name, total, err, tt.got)
+		}
+	}
+
+	wantTop := []ServiceSpend{{"Netflix", 100, 1}, {"Kion", 30, 1}, {"Spotify", 10, 1}}
+	if len(s.TopServices) != len(wantTop) {
+		t.Fatalf("TopServices = %+v, want %+v", s.TopServices, wantTop)
+	}
+	for i := range wantTop {
+		if s.TopServices[i] != wantTop[i] {
+			t.Errorf("TopServices[%d] = %+v, want %+v", i, s.TopServices[i], wantTop[i])
+		}
+	}
+
+	// с автопродлением подписка не заканчивается, даже если end_date в окне
+	wantEnds := []uuid.UUID{ending.ID, future.ID}
+	if len(s.UpcomingEnds) != len(wantEnds) {
+		t.Fatalf("UpcomingEnds = %+v, want %v", s.UpcomingEnds, wantEnds)
+	}
+	for i, id := range wantEnds {
+		if s.UpcomingEnds[i].ID != id {
+			t.Errorf("UpcomingEnds[%d] = %s, want %s", i, s.UpcomingEnds[i].ServiceName, id)
+		}
+	}
+}
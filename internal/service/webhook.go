@@ -0,0 +1,484 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+var WebhookEventTypes = []string{
+	domain.EventSubscriptionCreated,
+	domain.EventSubscriptionUpdated,
+	domain.EventSubscriptionDeleted,
+	domain.EventSubscriptionEnded,
+}
+
+// заголовки запроса к получателю
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	MaxWebhookDeliveries  = 500
+	minWebhookSecret      = 16
+	webhookClaimBatch     = 50
+	webhookDispatchBatch  = 500
+	webhookWorkers        = 8
+	maxWebhookRetryDelay  = time.Hour
+	maxWebhookErrorLength = 500
+)
+
+var (
+	ErrInvalidWebhookURL = errors.New("url must be an absolute http or https URL")
+	ErrPrivateWebhookURL = errors.New("url must not point to a loopback, private or link-local address")
+	ErrInvalidEventType  = errors.New("invalid event type, expected subscription.created, subscription.updated, subscription.deleted or subscription.ended")
+	ErrWebhookSecret     = fmt.Errorf("secret must be at least %d characters", minWebhookSecret)
+)
+
+// WebhookDeliveryConfig - настройки доставки событий
+type WebhookDeliveryConfig struct {
+	Timeout     time.Duration // таймаут одного запроса к получателю
+	MaxAttempts int           // после стольких неудач доставка уходит в dead
+	RetryBase   time.Duration // задержка перед первым повтором, дальше удваивается
+	// AllowPrivate разрешает адреса loopback, частных сетей и link-local (локальная разработка).
+	// Без него такие адреса запрещены при сохранении webhook и проверяются при каждом соединении:
+	// имя может разрешиться во внутренний адрес уже после проверки URL
+	AllowPrivate bool
+	// EventRetention - сколько хранятся полностью доставленные события (см. PruneEvents)
+	EventRetention time.Duration
+}
+
+type WebhookService struct {
+	repo   repository.Webhooks
+	subs   repository.Subscriptions
+	cfg    WebhookDeliveryConfig
+	client *http.Client
+}
+
+func NewWebhookService(repo repository.Webhooks, subs repository.Subscriptions, cfg WebhookDeliveryConfig) *WebhookService {
+	client := &http.Client{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil // через прокси проверялся бы адрес прокси, а не получателя
+		transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: dialPublicOnly}).DialContext
+		client.Transport = transport
+	}
+	return &WebhookService{repo: repo, subs: subs, cfg: cfg, client: client}
+}
+
+// _________________ управление webhook _________________
+
+type WebhookInput struct {
+	URL        string
+	Secret     string   // пустой - при создании сгенерировать, при изменении оставить прежний
+	EventTypes []string // пустой - все типы
+	Active     *bool    // nil - true при создании, без изменений при обновлении
+}
+
+// Create создает webhook. Сгенерированный секрет возвращается в Secret и больше нигде не отдается
+func (s *WebhookService) Create(ctx context.Context, input WebhookInput) (*domain.Webhook, error) {
+	w := &domain.Webhook{ID: uuid.New(), Active: true}
+	if input.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		input.Secret = secret
+	}
+	if err := s.applyWebhookInput(w, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *WebhookService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *WebhookService) List(ctx context.Context) ([]domain.Webhook, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *WebhookService) Update(ctx context.Context, id uuid.UUID, input WebhookInput) error {
+	w, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.applyWebhookInput(w, input); err != nil {
+		return err
+	}
+	return s.repo.Update(ctx, w)
+}
+
+// Delete удаляет webhook вместе с его доставками
+func (s *WebhookService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *WebhookService) Deliveries(ctx context.Context, filter repository.DeliveryFilter) ([]domain.WebhookDelivery, error) {
+	if filter.Limit <= 0 || filter.Limit > MaxWebhookDeliveries {
+		filter.Limit = MaxWebhookDeliveries
+	}
+	return s.repo.Deliveries(ctx, filter)
+}
+
+// Redeliver ставит доставку (обычно dead) в очередь заново с полным набором попыток
+func (s *WebhookService) Redeliver(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	return s.repo.Redeliver(ctx, id)
+}
+
+func (s *WebhookService) applyWebhookInput(w *domain.Webhook, input WebhookInput) error {
+	u, err := url.Parse(input.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidWebhookURL
+	}
+	if !s.cfg.AllowPrivate && privateWebhookHost(u.Hostname()) {
+		return ErrPrivateWebhookURL
+	}
+	if input.Secret != "" && len(input.Secret) < minWebhookSecret {
+		return ErrWebhookSecret
+	}
+
+	types := slices.Clone(input.EventTypes)
+	if len(types) == 0 {
+		types = slices.Clone(WebhookEventTypes)
+	}
+	for _, t := range types {
+		if !slices.Contains(WebhookEventTypes, t) {
+			return ErrInvalidEventType
+		}
+	}
+	slices.Sort(types)
+
+	w.URL = input.URL
+	w.EventTypes = slices.Compact(types)
+	if input.Secret != "" {
+		w.Secret = input.Secret
+	}
+	if input.Active != nil {
+		w.Active = *input.Active
+	}
+	return nil
+}
+
+// privateWebhookHost - хост из URL webhook указывает на внутренний адрес. Имена, кроме localhost,
+// здесь не разрешаются: это делает dialPublicOnly при соединении
+func privateWebhookHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && privateAddr(addr)
+}
+
+// privateAddr - адрес не из публичного интернета
+func privateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap() // ::ffff:127.0.0.1 - тот же loopback
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
+
+// 100.64.0.0/10 - адреса провайдерского NAT, IsPrivate их не покрывает
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// dialPublicOnly запрещает соединение с внутренним адресом, в том числе после редиректа
+// и если DNS-имя получателя разрешилось в такой адрес
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || privateAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateWebhookURL, host)
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// _________________ события _________________
+
+// webhookPayload - тело запроса к получателю
+type webhookPayload struct {
+	ID        uuid.UUID           `json:"id"`
+	Type      string              `json:"type"`
+	CreatedAt time.Time           `json:"created_at"`
+	Data      webhookSubscription `json:"data"`
+}
+
+// webhookSubscription - подписка в том же виде, что и в ответах API (даты - MM-YYYY)
+type webhookSubscription struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	ServiceName string     `json:"service_name"`
+	Price       int        `json:"price"`
+	StartDate   string     `json:"start_date"`
+	EndDate     *string    `json:"end_date,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Plan        *string    `json:"plan,omitempty"`
+	PreviousID  *uuid.UUID `json:"previous_id,omitempty"`
+	AutoRenew   bool       `json:"auto_renew"`
+	CanceledAt  *time.Time `json:"canceled_at,omitempty"`
+}
+
+func toWebhookSubscription(sub domain.Subscription) webhookSubscription {
+	ws := webhookSubscription{
+		ID:          sub.ID,
+		UserID:      sub.UserID,
+		ServiceName: sub.ServiceName,
+		Price:       sub.Price,
+		StartDate:   sub.StartDate.Format("01-2006"),
+		CreatedAt:   sub.CreatedAt,
+		Plan:        sub.Plan,
+		PreviousID:  sub.PreviousID,
+		AutoRenew:   sub.AutoRenew,
+		CanceledAt:  sub.CanceledAt,
+	}
+	if sub.EndDate != nil {
+		end := sub.EndDate.Format("01-2006")
+		ws.EndDate = &end
+	}
+	return ws
+}
+
+// newWebhookEvent собирает событие с готовым телом запроса
+func newWebhookEvent(eventType string, sub domain.Subscription, createdAt time.Time) (domain.WebhookEvent, error) {
+	event := domain.WebhookEvent{ID: uuid.New(), Type: eventType, SubscriptionID: sub.ID, CreatedAt: createdAt.UTC()}
+	payload, err := json.Marshal(webhookPayload{
+		ID:        event.ID,
+		Type:      eventType,
+		CreatedAt: event.CreatedAt,
+		Data:      toWebhookSubscription(sub),
+	})
+	if err != nil {
+		return event, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	event.Payload = payload
+	return event, nil
+}
+
+// DispatchEvents ставит в доставку события подписок, которые репозиторий сохранил в outbox
+// вместе с изменениями, пока outbox не опустеет. Возвращает число поставленных в очередь доставок
+func (s *WebhookService) DispatchEvents(ctx context.Context) (int, error) {
+	build := func(e repository.SubscriptionEvent) (domain.WebhookEvent, error) {
+		return newWebhookEvent(e.Type, e.Subscription, e.OccurredAt)
+	}
+	total := 0
+	for {
+		events, deliveries, err := s.repo.DispatchEvents(ctx, webhookDispatchBatch, build)
+		total += deliveries
+		if err != nil || events < webhookDispatchBatch {
+			return total, err
+		}
+	}
+}
+
+// PublishEnded публикует subscription.ended для подписок, которые закончились до месяца now
+// и не продлеваются и не продолжаются сменой тарифа. Месяцы публикуются по порядку со следующего
+// за последним опубликованным, поэтому после простоя пропущенные месяцы догоняются; при первом
+// запуске - только прошлый месяц. Для каждой подписки и ее end_date событие публикуется один раз.
+// Возвращает число поставленных в очередь доставок
+func (s *WebhookService) PublishEnded(ctx context.Context, now time.Time) (int, error) {
+	last := normalizeMonth(now).AddDate(0, -1, 0)
+	from := last
+	published, err := s.repo.LastEndedMonth(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if published != nil {
+		from = normalizeMonth(*published).AddDate(0, 1, 0)
+	}
+
+	total := 0
+	for month := from; !month.After(last); month = month.AddDate(0, 1, 0) {
+		n, err := s.publishEndedIn(ctx, month, now)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if err := s.repo.SetLastEndedMonth(ctx, month); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// publishEndedIn публикует subscription.ended для подписок с последним месяцем month
+func (s *WebhookService) publishEndedIn(ctx context.Context, month, now time.Time) (int, error) {
+	// старая часть смены тарифа или split закончилась, но подписка продолжается
+	filter := repository.SubscriptionFilter{EndsFrom: &month, EndsTo: &month, NotContinued: true}
+
+	var ended []domain.Subscription
+	err := s.subs.Stream(ctx, filter, nil, func(sub domain.Subscription) error {
+		ended = append(ended, sub)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, sub := range ended {
+		key := domain.EventSubscriptionEnded + ":" + sub.ID.String() + ":" + month.Format("2006-01")
+		event, err := newWebhookEvent(domain.EventSubscriptionEnded, sub, now)
+		if err != nil {
+			return total, err
+		}
+		n, err := s.repo.AddEvent(ctx, event, &key)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// PruneEvents удаляет события старше EventRetention, все доставки которых успешны.
+// dedup_key subscription.ended удаляется вместе с событием, но повтора не будет:
+// PublishEnded не возвращается к уже опубликованным месяцам
+func (s *WebhookService) PruneEvents(ctx context.Context, now time.Time) (int64, error) {
+	return s.repo.DeleteDeliveredEvents(ctx, now.Add(-s.cfg.EventRetention))
+}
+
+// _________________ доставка _________________
+
+// SignWebhookPayload - подпись запроса: HMAC-SHA256 от "<timestamp>.<тело>" ключом secret.
+// Получатель считает ее так же и сравнивает с заголовком X-Webhook-Signature
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver отправляет доставки, время попытки которых пришло. Возвращает число успешных и неудачных попыток;
+// ошибка - только если не удалось взять доставки в работу или сохранить результат
+func (s *WebhookService) Deliver(ctx context.Context) (delivered, failed int, err error) {
+	// аренда с запасом на таймаут запроса: упавшая на середине доставка повторится после нее
+	pending, err := s.repo.ClaimDeliveries(ctx, webhookClaimBatch, 2*s.cfg.Timeout+time.Minute)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	sem := make(chan struct{}, webhookWorkers)
+	for _, p := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			ok, err := s.deliverOne(ctx, p)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				delivered++
+			} else {
+				failed++
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return delivered, failed, errors.Join(errs...)
+}
+
+func (s *WebhookService) deliverOne(ctx context.Context, p repository.PendingDelivery) (bool, error) {
+	statusCode, sendErr := s.send(ctx, p)
+	if sendErr == nil {
+		return true, s.repo.MarkDelivered(ctx, p.Delivery.ID, statusCode)
+	}
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	msg := sendErr.Error()
+	if len(msg) > maxWebhookErrorLength {
+		msg = msg[:maxWebhookErrorLength]
+	}
+
+	attempt := p.Delivery.Attempts + 1
+	var next *time.Time
+	if attempt < s.cfg.MaxAttempts {
+		at := time.Now().Add(retryDelay(s.cfg.RetryBase, attempt))
+		next = &at
+	}
+	return false, s.repo.MarkFailed(ctx, p.Delivery.ID, code, msg, next)
+}
+
+// send отправляет событие получателю; успех - ответ 2xx
+func (s *WebhookService) send(ctx context.Context, p repository.PendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(p.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, p.Delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(p.Delivery.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(p.Secret, ts, p.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // чтобы соединение вернулось в пул
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay - экспоненциальная задержка перед повтором после attempt неудачных попыток
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookRetryDelay)
+}
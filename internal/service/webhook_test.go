@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"payload", "secret-1234567890", 1700000000, `{"id":1}`, "sha256=f5cdc499b8adc1d9d4d88ed16ccba9de4222ca3ee1e522911bc16c8e527347ab"},
+		{"other timestamp", "secret-1234567890", 1700000001, `{"id":1}`, "sha256=1d5a5b977ed2fe8f3a56c265e18b331326e4fc4b4a04a73da2e84d3792c02dd0"},
+		{"other secret", "another-secret-123", 1700000000, `{"id":1}`, "sha256=fbcd9e9b9ff4afa22d2ecdc82dd3a54e9ac6d0d23061c62eced6e713e926d8b0"},
+		{"empty body", "secret-1234567890", 1700000000, "", "sha256=78cd3ea2c4f0fb973c397f211c9621dead384c3b27dbf49c107ce925a44a491f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("SignWebhookPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{"first retry", time.Minute, 1, time.Minute},
+		{"doubles", time.Minute, 2, 2 * time.Minute},
+		{"doubles again", time.Minute, 4, 8 * time.Minute},
+		{"capped", time.Minute, 10, maxWebhookRetryDelay},
+		{"many attempts", time.Minute, 1000, maxWebhookRetryDelay},
+		{"base above cap", 2 * time.Hour, 1, maxWebhookRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(tt.base, tt.attempt); got != tt.want {
+				t.Errorf("retryDelay(%v, %d) = %v, want %v", tt.base, tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeWebhooks отдает доставки один раз и запоминает результаты попыток
+type fakeWebhooks struct {
+	repository.Webhooks
+	mu        sync.Mutex
+	pending   []repository.PendingDelivery
+	delivered map[int64]int
+	failed    map[int64]failedAttempt
+	events    map[string]domain.WebhookEvent // по dedupKey
+	lastEnded *time.Time
+	prunedTo  time.Time
+}
+
+type failedAttempt struct {
+	statusCode *int
+	next       *time.Time
+}
+
+func (f *fakeWebhooks) ClaimDeliveries(context.Context, int, time.Duration) ([]repository.PendingDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	claimed := f.pending
+	f.pending = nil
+	return claimed, nil
+}
+
+func (f *fakeWebhooks) MarkDelivered(_ context.Context, id int64, statusCode int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delivered[id] = statusCode
+	return nil
+}
+
+func (f *fakeWebhooks) MarkFailed(_ context.Context, id int64, statusCode *int, _ string, next *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed[id] = failedAttempt{statusCode: statusCode, next: next}
+	return nil
+}
+
+func (f *fakeWebhooks) AddEvent(_ context.Context, event domain.WebhookEvent, dedupKey *string) (int, error) {
+	if _, ok := f.events[*dedupKey]; ok {
+		return 0, nil
+	}
+	f.events[*dedupKey] = event
+	return 1, nil
+}
+
+func (f *fakeWebhooks) LastEndedMonth(context.Context) (*time.Time, error) {
+	return f.lastEnded, nil
+}
+
+func (f *fakeWebhooks) SetLastEndedMonth(_ context.Context, month time.Time) error {
+	f.lastEnded = &month
+	return nil
+}
+
+func (f *fakeWebhooks) DeleteDeliveredEvents(_ context.Context, before time.Time) (int64, error) {
+	f.prunedTo = before
+	return 1, nil
+}
+
+func TestPruneEvents(t *testing.T) {
+	repo := &fakeWebhooks{}
+	svc := NewWebhookService(repo, nil, WebhookDeliveryConfig{EventRetention: 30 * 24 * time.Hour})
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	if _, err := svc.PruneEvents(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 5, 16, 12, 0, 0, 0, time.UTC); !repo.prunedTo.Equal(want) {
+		t.Errorf("pruned events before %v, want %v", repo.prunedTo, want)
+	}
+}
+
+func TestPublishEnded(t *testing.T) {
+	now := time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC)
+	endedIn := func(end time.Time) domain.Subscription {
+		return domain.Subscription{ID: uuid.New(), UserID: uuid.New(), ServiceName: "Netflix", Price: 100, StartDate: month(2024, 1), EndDate: &end}
+	}
+	may, april, march, february := endedIn(month(2025, 5)), endedIn(month(2025, 4)), endedIn(month(2025, 3)), endedIn(month(2025, 2))
+	renewing := endedIn(month(2025, 5))
+	renewing.AutoRenew = true
+	// смена тарифа: старая часть закончилась в мае, новая продолжает ее с июня
+	basic := endedIn(month(2025, 5))
+	premium := domain.Subscription{ID: uuid.New(), UserID: basic.UserID, ServiceName: "Netflix", Price: 200, StartDate: month(2025, 6), PreviousID: &basic.ID}
+	subs := &fakeSubscriptions{subs: []domain.Subscription{may, april, march, february, renewing, basic, premium}}
+	key := func(sub domain.Subscription) string {
+		return domain.EventSubscriptionEnded + ":" + sub.ID.String() + ":" + sub.EndDate.Format("2006-01")
+	}
+
+	tests := []struct {
+		name      string
+		published *time.Time
+		want      []domain.Subscription
+	}{
+		{"first run publishes the previous month", nil, []domain.Subscription{may}},
+		{"catches up after downtime", monthPtr(2025, 2), []domain.Subscription{march, april, may}},
+		{"already published", monthPtr(2025, 5), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeWebhooks{events: make(map[string]domain.WebhookEvent), lastEnded: tt.published}
+			svc := NewWebhookService(repo, subs, WebhookDeliveryConfig{})
+
+			for range 2 { // повторная публикация ничего не добавляет
+				if _, err := svc.PublishEnded(context.Background(), now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(repo.events) != len(tt.want) {
+				t.Errorf("events = %v, want %d", slices.Collect(maps.Keys(repo.events)), len(tt.want))
+			}
+			for _, sub := range tt.want {
+				if _, ok := repo.events[key(sub)]; !ok {
+					t.Errorf("no event %s", key(sub))
+				}
+			}
+			if repo.lastEnded == nil || !repo.lastEnded.Equal(month(2025, 5)) {
+				t.Errorf("last ended month = %v, want 2025-05", repo.lastEnded)
+			}
+		})
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	const secret = "secret-1234567890"
+	body := []byte(`{"type":"subscription.created"}`)
+
+	// код ответа получателя задается в пути
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhookPayload(secret, ts, got) ||
+			r.Header.Get(WebhookEventHeader) != domain.EventSubscriptionCreated {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		code, _ := strconv.Atoi(r.URL.Path[1:])
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	delivery := func(id int64, status, attempts int, key string) repository.PendingDelivery {
+		return repository.PendingDelivery{
+			Delivery: domain.WebhookDelivery{ID: id, EventID: uuid.New(), EventType: domain.EventSubscriptionCreated, Attempts: attempts},
+			URL:      srv.URL + "/" + strconv.Itoa(status),
+			Secret:   key,
+			Payload:  body,
+		}
+	}
+	repo := &fakeWebhooks{
+		pending: []repository.PendingDelivery{
+			delivery(1, http.StatusOK, 0, secret),
+			delivery(2, http.StatusNoContent, 3, secret),
+			delivery(3, http.StatusInternalServerError, 0, secret),
+			delivery(4, http.StatusInternalServerError, 2, secret),
+			delivery(5, http.StatusOK, 0, "wrong-secret-12345"),
+		},
+		delivered: make(map[int64]int),
+		failed:    make(map[int64]failedAttempt),
+	}
+	svc := NewWebhookService(repo, nil, WebhookDeliveryConfig{Timeout: 5 * time.Second, MaxAttempts: 3, RetryBase: time.Minute, AllowPrivate: true})
+
+	start := time.Now()
+	delivered, failed, err := svc.Deliver(context.Background())
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	if delivered != 2 || failed != 3 {
+		t.Errorf("Deliver() = %d delivered, %d failed, want 2, 3", delivered, failed)
+	}
+
+	for id, want := range map[int64]int{1: http.StatusOK, 2: http.StatusNoContent} {
+		if got, ok := repo.delivered[id]; !ok || got != want {
+			t.Errorf("delivery %d: delivered with %d (%v), want %d", id, got, ok, want)
+		}
+	}
+
+	tests := []struct {
+		id        int64
+		code      int
+		retry     bool
+		wantDelay time.Duration
+	}{
+		{3, http.StatusInternalServerError, true, time.Minute}, // первая неудача - повтор через RetryBase
+		{4, http.StatusInternalServerError, false, 0},          // третья из трех - dead
+		{5, http.StatusUnauthorized, true, time.Minute},        // неверная подпись отклонена получателем
+	}
+	for _, tt := range tests {
+		f, ok := repo.failed[tt.id]
+		if !ok {
+			t.Errorf("delivery %d: not marked failed", tt.id)
+			continue
+		}
+		if f.statusCode == nil || *f.statusCode != tt.code {
+			t.Errorf("delivery %d: status code = %v, want %d", tt.id, f.statusCode, tt.code)
+		}
+		if !tt.retry {
+			if f.next != nil {
+				t.Errorf("delivery %d: next attempt = %v, want dead", tt.id, *f.next)
+			}
+			continue
+		}
+		if f.next == nil {
+			t.Errorf("delivery %d: dead, want retry", tt.id)
+			continue
+		}
+		if d := f.next.Sub(start); d < tt.wantDelay || d > tt.wantDelay+time.Minute {
+			t.Errorf("delivery %d: next attempt in %v, want about %v", tt.id, d, tt.wantDelay)
+		}
+	}
+}
+
+func TestWebhookURLPrivate(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{"https://hooks.example.com/path", false, nil},
+		{"https://93.184.216.34/", false, nil},
+		{"ftp://hooks.example.com/", false, ErrInvalidWebhookURL},
+		{"http:///path", false, ErrInvalidWebhookURL},
+		{"http://localhost:9090/", false, ErrPrivateWebhookURL},
+		{"http://api.localhost/", false, ErrPrivateWebhookURL},
+		{"http://127.0.0.1/", false, ErrPrivateWebhookURL},
+		{"http://10.1.2.3/", false, ErrPrivateWebhookURL},
+		{"http://192.168.0.10/", false, ErrPrivateWebhookURL},
+		{"http://169.254.169.254/latest/meta-data", false, ErrPrivateWebhookURL},
+		{"http://100.64.0.1/", false, ErrPrivateWebhookURL},
+		{"http://0.0.0.0/", false, ErrPrivateWebhookURL},
+		{"http://[::1]:8080/", false, ErrPrivateWebhookURL},
+		{"http://[::ffff:127.0.0.1]/", false, ErrPrivateWebhookURL},
+		{"http://[fd00::1]/", false, ErrPrivateWebhookURL},
+		{"http://localhost:9090/", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			svc := NewWebhookService(nil, nil, WebhookDeliveryConfig{AllowPrivate: tt.allowPrivate})
+			err := svc.applyWebhookInput(&domain.Webhook{}, WebhookInput{URL: tt.url})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("applyWebhookInput() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// адрес проверяется при соединении: имя, разрешившееся во внутренний адрес, не пропускается
+func TestDeliverPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	repo := &fakeWebhooks{
+		pending: []repository.PendingDelivery{{
+			Delivery: domain.WebhookDelivery{ID: 1, EventID: uuid.New(), EventType: domain.EventSubscriptionCreated},
+			URL:      srv.URL, // 127.0.0.1 - в реальности так выглядит имя, разрешившееся в loopback
+			Secret:   "secret-1234567890",
+			Payload:  []byte(`{}`),
+		}},
+		delivered: make(map[int64]int),
+		failed:    make(map[int64]failedAttempt),
+	}
+	svc := NewWebhookService(repo, nil, WebhookDeliveryConfig{Timeout: 5 * time.Second, MaxAttempts: 3, RetryBase: time.Minute})
+
+	delivered, failed, err := svc.Deliver(context.Background())
+	if err != nil || delivered != 0 || failed != 1 {
+		t.Errorf("Deliver() = %d, %d, %v, want 0 delivered, 1 failed", delivered, failed, err)
+	}
+	if f := repo.failed[1]; f.statusCode != nil {
+		t.Errorf("status code = %d, want no response", *f.statusCode)
+	}
+}
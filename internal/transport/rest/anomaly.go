@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+func (h *Handler) listAnomalies(c *gin.Context) {
+	var filter repository.AnomalyFilter
+	if s := c.Query("user_id"); s != "" {
+		userID, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		filter.UserID = &userID
+	}
+	if rule := c.Query("rule"); rule != "" {
+		if rule != service.AnomalyRuleJump && rule != service.AnomalyRuleZScore {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule, expected jump or zscore"})
+			return
+		}
+		filter.Rule = &rule
+	}
+	var err error
+	if filter.From, err = queryMonth(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = queryMonth(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	anomalies, err := h.anomalyService.List(c.Request.Context(), filter)
+	if err != nil {
+		slog.Error("failed to list anomalies", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAnomalyResponses(anomalies))
+}
@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+// fakeTotals учитывает из фильтра только service_name и price_max; service_name_contains=fail - ошибка БД
+type fakeTotals struct {
+	repository.Subscriptions
+	subs []domain.Subscription
+}
+
+func (f *fakeTotals) FindActiveInPeriod(_ context.Context, filter repository.SubscriptionFilter, _, _ time.Time) ([]domain.Subscription, error) {
+	if filter.ServiceNameContains != nil && *filter.ServiceNameContains == "fail" {
+		return nil, errors.New("connection refused")
+	}
+	var result []domain.Subscription
+	for _, sub := range f.subs {
+		if filter.ServiceName != nil && sub.ServiceName != *filter.ServiceName ||
+			len(filter.ServiceNames) > 0 && !slices.Contains(filter.ServiceNames, sub.ServiceName) ||
+			filter.PriceMax != nil && sub.Price > *filter.PriceMax {
+			continue
+		}
+		result = append(result, sub)
+	}
+	return result, nil
+}
+
+func TestTotalCostBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeTotals{subs: []domain.Subscription{
+		{ID: uuid.New(), ServiceName: "Netflix", Price: 100, StartDate: start},
+		{ID: uuid.New(), ServiceName: "Spotify", Price: 10, StartDate: start},
+		{ID: uuid.New(), ServiceName: "Kion", Price: 50, StartDate: start},
+	}}
+	router := (&Handler{service: service.NewSubscriptionService(repo, service.OverlapAllow)}).InitRoutes()
+
+	body := `[
+		{"from": "01-2025", "to": "03-2025", "filter": {"service_name": ["Netflix", "Spotify"]}},
+		{"from": "01-2025", "to": "01-2025", "filter": {"service_name": "Netflix", "price_max": 50}},
+		{"from": "2025-01", "to": "01-2025"},
+		{"from": "01-2025", "to": "01-2025", "filter": {"plan": "premium"}},
+		{"from": "01-2025", "to": "01-2025", "filter": {"price_max": "cheap"}},
+		{"from": "01-2025", "to": "01-2025", "filter": {"service_name_contains": "fail"}}
+	]`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions/total:batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Results []TotalBatchResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TotalBatchResult{
+		{Index: 0, Total: intPtr(330)},
+		{Index: 1, Total: intPtr(0)},
+		{Index: 2, Error: "invalid from format, expected MM-YYYY"},
+		{Index: 3, Error: "unknown filter field plan"},
+		{Index: 4, Error: "invalid price_max, expected integer"},
+		{Index: 5, Error: "internal server error"},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d: %s", len(resp.Results), len(want), w.Body)
+	}
+	for i, got := range resp.Results {
+		if got.Index != want[i].Index || got.Error != want[i].Error ||
+			(got.Total == nil) != (want[i].Total == nil) || got.Total != nil && *got.Total != *want[i].Total {
+			t.Errorf("result %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestTotalActionRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := (&Handler{}).InitRoutes()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/subscriptions/total:batch", http.StatusBadRequest}, // пустой пакет
+		{"/api/v1/subscriptions/total:unknown", http.StatusNotFound},
+		{"/api/v1/subscriptions/" + uuid.NewString(), http.StatusNotFound}, // POST на подписку не зарегистрирован
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`[]`)))
+		if w.Code != tt.want {
+			t.Errorf("POST %s: %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  TotalFilterRequest
+		want    url.Values
+		wantErr bool
+	}{
+		{"empty", nil, url.Values{}, false},
+		{"scalars", TotalFilterRequest{"service_name": "Netflix", "price_min": float64(300), "open_ended": true},
+			url.Values{"service_name": {"Netflix"}, "price_min": {"300"}, "open_ended": {"true"}}, false},
+		{"array", TotalFilterRequest{"service_name": []any{"Netflix", "Kion"}}, url.Values{"service_name": {"Netflix", "Kion"}}, false},
+		{"null ignored", TotalFilterRequest{"user_id": nil}, url.Values{}, false},
+		{"unknown field", TotalFilterRequest{"plan": "premium"}, nil, true},
+		{"object value", TotalFilterRequest{"user_id": map[string]any{"id": "x"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterValues(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("filterValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
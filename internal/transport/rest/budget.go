@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+func (h *Handler) createBudget(c *gin.Context) {
+	var req CreateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	input := service.BudgetInput{ServiceName: req.ServiceName, MonthlyLimit: req.MonthlyLimit, Thresholds: req.Thresholds}
+	b, alerts, err := h.budgetService.Create(c.Request.Context(), userID, input, time.Now().UTC())
+	if writeBudgetError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create budget", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	resp := gin.H{"id": b.ID}
+	if len(alerts) > 0 {
+		resp["alerts"] = toBudgetAlertResponses(alerts)
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (h *Handler) listBudgets(c *gin.Context) {
+	userID, err := uuid.Parse(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	statuses, err := h.budgetService.List(c.Request.Context(), userID, time.Now().UTC())
+	if err != nil {
+		slog.Error("failed to list budgets", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	resp := make([]BudgetResponse, 0, len(statuses))
+	for _, st := range statuses {
+		resp = append(resp, toBudgetResponse(st))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) getBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	b, err := h.budgetService.GetByID(c.Request.Context(), id)
+	if writeBudgetError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get budget", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	st, err := h.budgetService.Status(c.Request.Context(), *b, time.Now().UTC())
+	if err != nil {
+		slog.Error("failed to calc budget status", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toBudgetResponse(st))
+}
+
+func (h *Handler) updateBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req UpdateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input := service.BudgetInput{ServiceName: req.ServiceName, MonthlyLimit: req.MonthlyLimit, Thresholds: req.Thresholds}
+	err = h.budgetService.Update(c.Request.Context(), id, input, time.Now().UTC())
+	if writeBudgetError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to update budget", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) deleteBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	err = h.budgetService.Delete(c.Request.Context(), id)
+	if writeBudgetError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to delete budget", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) budgetAlerts(c *gin.Context) {
+	var filter repository.BudgetAlertFilter
+	if s := c.Query("user_id"); s != "" {
+		userID, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		filter.UserID = &userID
+	}
+	if s := c.Query("budget_id"); s != "" {
+		budgetID, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid budget_id"})
+			return
+		}
+		filter.BudgetID = &budgetID
+	}
+	var err error
+	if filter.From, err = queryMonth(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = queryMonth(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alerts, err := h.budgetService.Alerts(c.Request.Context(), filter)
+	if err != nil {
+		slog.Error("failed to list budget alerts", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toBudgetAlertResponses(alerts))
+}
+
+// writeBudgetError отвечает 404/409/400 на ошибки бюджета, вызванные запросом. false - ошибка другая
+func writeBudgetError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrBudgetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, repository.ErrBudgetExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidBudgetLimit), errors.Is(err, service.ErrInvalidThresholds):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
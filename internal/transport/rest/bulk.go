@@ -0,0 +1,169 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+const (
+	bulkModeAtomic     = "atomic"
+	bulkModeBestEffort = "best_effort"
+)
+
+func (h *Handler) bulkSubscriptions(c *gin.Context) {
+	var req BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = bulkModeAtomic
+	}
+	if req.Mode != bulkModeAtomic && req.Mode != bulkModeBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode, expected atomic or best_effort"})
+		return
+	}
+	if len(req.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one operation is required"})
+		return
+	}
+	if len(req.Operations) > service.MaxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrBulkTooLarge.Error()})
+		return
+	}
+	policy, err := parseOverlapPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// невалидный пакет отклоняем целиком в любом режиме, до похода в БД
+	ops := make([]repository.BulkOp, 0, len(req.Operations))
+	for i, o := range req.Operations {
+		op, err := toBulkOp(o)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operation %d: %s", i, err), "index": i})
+			return
+		}
+		ops = append(ops, op)
+	}
+
+	if req.Mode == bulkModeAtomic {
+		items, err := h.service.BulkAtomic(c.Request.Context(), ops, policy)
+		var opErr *service.BulkOpError
+		var overlapErr *service.OverlapError
+		switch {
+		case errors.As(err, &opErr) && errors.As(err, &overlapErr):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":    fmt.Sprintf("operation %d: %s", opErr.Index, overlapErr),
+				"index":    opErr.Index,
+				"overlaps": overlapIDs(overlapErr.Overlaps),
+			})
+			return
+		case errors.As(err, &opErr) && errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("operation %d: not found", opErr.Index), "index": opErr.Index})
+			return
+		case errors.As(err, &opErr) && errors.Is(err, repository.ErrConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("operation %d: %s", opErr.Index, repository.ErrConflict), "index": opErr.Index})
+			return
+		case err != nil:
+			slog.Error("failed to execute bulk", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": toBulkResults(ops, items)})
+		return
+	}
+
+	items, err := h.service.BulkBestEffort(c.Request.Context(), ops, policy)
+	if err != nil {
+		slog.Error("failed to execute bulk", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": toBulkResults(ops, items)})
+}
+
+func toBulkOp(req BulkOperationRequest) (repository.BulkOp, error) {
+	op := repository.BulkOp{Kind: repository.BulkOpKind(req.Op)}
+
+	switch op.Kind {
+	case repository.BulkCreate:
+		if req.ID != "" { // id от клиента необязателен
+			id, err := uuid.Parse(req.ID)
+			if err != nil {
+				return op, errors.New("invalid id")
+			}
+			op.ID = id
+		}
+	case repository.BulkUpdate, repository.BulkDelete:
+		id, err := uuid.Parse(req.ID)
+		if err != nil {
+			return op, errors.New("invalid id")
+		}
+		op.ID = id
+	default:
+		return op, errors.New("invalid op, expected create, update or delete")
+	}
+
+	if op.Kind != repository.BulkDelete {
+		if req.Data == nil {
+			return op, errors.New("data is required")
+		}
+		// ShouldBindJSON не проверяет элементы слайса, поэтому правила binding для data применяем сами
+		if err := binding.Validator.ValidateStruct(req.Data); err != nil {
+			return op, err
+		}
+		sub, err := toSubscription(op.ID, *req.Data)
+		if err != nil {
+			return op, err
+		}
+		op.Subscription = sub
+	}
+	return op, nil
+}
+
+func toBulkResults(ops []repository.BulkOp, items []service.BulkItem) []BulkItemResult {
+	statuses := map[repository.BulkOpKind]string{
+		repository.BulkCreate: "created",
+		repository.BulkUpdate: "updated",
+		repository.BulkDelete: "deleted",
+	}
+
+	results := make([]BulkItemResult, 0, len(ops))
+	for i, op := range ops {
+		item := items[i]
+		r := BulkItemResult{Index: i, Op: string(op.Kind), ID: item.ID.String(), Status: statuses[op.Kind]}
+		var overlapErr *service.OverlapError
+		if item.Err != nil {
+			r.Status = "failed"
+			switch {
+			case errors.Is(item.Err, repository.ErrNotFound):
+				r.Error = "not found"
+			case errors.Is(item.Err, repository.ErrConflict):
+				r.Error = repository.ErrConflict.Error()
+			case errors.As(item.Err, &overlapErr):
+				r.Error = overlapErr.Error()
+				r.Overlaps = overlapIDs(overlapErr.Overlaps)
+			default:
+				slog.Error("bulk operation failed", "index", i, "error", item.Err)
+				r.Error = "internal server error"
+			}
+			if op.Kind == repository.BulkCreate {
+				r.ID = ""
+			}
+		} else if len(item.Overlaps) > 0 {
+			r.Overlaps = overlapIDs(item.Overlaps)
+		}
+		results = append(results, r)
+	}
+	return results
+}
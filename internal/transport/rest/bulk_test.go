@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestToBulkOpValidation(t *testing.T) {
+	data := func(price *int) *UpdateSubscriptionRequest {
+		return &UpdateSubscriptionRequest{
+			ServiceName: "Yandex Plus",
+			Price:       price,
+			UserID:      "60601fee-2bf1-4721-ae6f-7636e79a0cba",
+			StartDate:   "07-2025",
+		}
+	}
+	tests := []struct {
+		name    string
+		req     BulkOperationRequest
+		wantErr bool
+	}{
+		{"valid create", BulkOperationRequest{Op: "create", Data: data(intPtr(400))}, false},
+		{"free subscription", BulkOperationRequest{Op: "create", Data: data(intPtr(0))}, false},
+		{"missing price", BulkOperationRequest{Op: "create", Data: data(nil)}, true},
+		{"negative price", BulkOperationRequest{Op: "create", Data: data(intPtr(-1))}, true},
+		{"price above integer column", BulkOperationRequest{Op: "create", Data: data(intPtr(maxPrice + 1))}, true},
+		{"end before start", BulkOperationRequest{Op: "create", Data: &UpdateSubscriptionRequest{ServiceName: "Yandex Plus", Price: intPtr(400), UserID: "60601fee-2bf1-4721-ae6f-7636e79a0cba", StartDate: "07-2025", EndDate: strPtr("06-2025")}}, true},
+		{"missing service name", BulkOperationRequest{Op: "create", Data: &UpdateSubscriptionRequest{Price: intPtr(400), UserID: "60601fee-2bf1-4721-ae6f-7636e79a0cba", StartDate: "07-2025"}}, true},
+		{"create with client id", BulkOperationRequest{Op: "create", ID: "2d1f3c2e-7a4b-4f1e-9a53-0c5b3f6a9d10", Data: data(intPtr(400))}, false},
+		{"create with invalid id", BulkOperationRequest{Op: "create", ID: "42", Data: data(intPtr(400))}, true},
+		{"update without data", BulkOperationRequest{Op: "update", ID: "2d1f3c2e-7a4b-4f1e-9a53-0c5b3f6a9d10"}, true},
+		{"delete", BulkOperationRequest{Op: "delete", ID: "2d1f3c2e-7a4b-4f1e-9a53-0c5b3f6a9d10"}, false},
+		{"unknown op", BulkOperationRequest{Op: "upsert"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := toBulkOp(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("toBulkOp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int       { return &v }
+func strPtr(v string) *string { return &v }
+
+func TestSubscriptionsActionRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := (&Handler{}).InitRoutes()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/subscriptions:bulk", http.StatusBadRequest}, // пустой пакет
+		{"/api/v1/subscriptions:unknown", http.StatusNotFound},
+		{"/api/v1/unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"operations":[]}`)))
+		if w.Code != tt.want {
+			t.Errorf("POST %s: %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
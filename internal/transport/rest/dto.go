@@ -1,18 +1,23 @@
 package rest
 
 type CreateSubscriptionRequest struct {
-	ServiceName string `json:"service_name" binding:"required"`
-	Price       int    `json:"price" binding:"required"`
-	UserID      string `json:"user_id" binding:"required"`
-	StartDate   string `json:"start_date" binding:"required"`
+	ID          string  `json:"id,omitempty"` // необязательный id, присвоенный клиентом
+	ServiceName string  `json:"service_name" binding:"required"`
+	Price       *int    `json:"price" binding:"required"` // указатель, чтобы 0 не считался отсутствующим
+	UserID      string  `json:"user_id" binding:"required"`
+	StartDate   string  `json:"start_date" binding:"required"`
+	Plan        *string `json:"plan,omitempty"`
+	AutoRenew   *bool   `json:"auto_renew,omitempty"` // по умолчанию true, если нет end_date
 }
 
 type UpdateSubscriptionRequest struct {
 	ServiceName string  `json:"service_name" binding:"required"`
-	Price       int     `json:"price" binding:"required"`
+	Price       *int    `json:"price" binding:"required"` // указатель, чтобы 0 не считался отсутствующим
 	UserID      string  `json:"user_id" binding:"required"`
 	StartDate   string  `json:"start_date" binding:"required"`
 	EndDate     *string `json:"end_date,omitempty"`
+	Plan        *string `json:"plan,omitempty"`
+	AutoRenew   *bool   `json:"auto_renew,omitempty"` // по умолчанию true, если нет end_date
 }
 
 type SubscriptionResponse struct {
@@ -22,4 +27,351 @@ type SubscriptionResponse struct {
 	Price       int     `json:"price"`
 	StartDate   string  `json:"start_date"`
 	EndDate     *string `json:"end_date,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	Plan        *string `json:"plan,omitempty"`
+	PreviousID  *string `json:"previous_id,omitempty"` // подписка, которую эта продолжает после смены тарифа
+	AutoRenew   bool    `json:"auto_renew"`
+	CanceledAt  *string `json:"canceled_at,omitempty"`
+}
+
+type RetentionCohortResponse struct {
+	Cohort    string    `json:"cohort"`
+	Size      int       `json:"size"`
+	Retention []float64 `json:"retention"`
+}
+
+type RetentionResponse struct {
+	Cohorts []RetentionCohortResponse `json:"cohorts"`
+}
+
+type ServiceForecastResponse struct {
+	ServiceName string `json:"service_name"`
+	Committed   int    `json:"committed"`
+	Projected   int    `json:"projected"`
+	Total       int    `json:"total"`
+}
+
+type MonthForecastResponse struct {
+	Month     string                    `json:"month"`
+	Committed int                       `json:"committed"`
+	Projected int                       `json:"projected"`
+	Total     int                       `json:"total"`
+	Services  []ServiceForecastResponse `json:"services"`
+}
+
+type ForecastResponse struct {
+	Committed int                     `json:"committed"`
+	Projected int                     `json:"projected"`
+	Total     int                     `json:"total"`
+	Months    []MonthForecastResponse `json:"months"`
+}
+
+// TotalFilterRequest - фильтр в теле запроса: те же параметры, что в query (parseFilter).
+// Значение - строка, число, bool или массив для повторяемых user_id и service_name
+type TotalFilterRequest map[string]any
+
+type TotalQueryRequest struct {
+	Filter TotalFilterRequest `json:"filter"`
+	From   string             `json:"from" binding:"required"`
+	To     string             `json:"to" binding:"required"`
+}
+
+// TotalBatchResult - итог запроса пакета total:batch или ошибка только этого запроса
+type TotalBatchResult struct {
+	Index int    `json:"index"`
+	Total *int   `json:"total,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type CostLineResponse struct {
+	SubscriptionID string  `json:"subscription_id"`
+	UserID         string  `json:"user_id"`
+	ServiceName    string  `json:"service_name"`
+	Plan           *string `json:"plan,omitempty"`
+	PreviousID     *string `json:"previous_id,omitempty"`
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	Months         int     `json:"months"`
+	Price          int     `json:"price"`
+	Amount         int     `json:"amount"`
+}
+
+type TotalExplainResponse struct {
+	Total int                `json:"total"`
+	Items []CostLineResponse `json:"items"`
+}
+
+type TotalDeltaResponse struct {
+	Current       int      `json:"current"`
+	Baseline      int      `json:"baseline"`
+	Change        int      `json:"change"`
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+type ServiceDeltaResponse struct {
+	ServiceName string `json:"service_name"`
+	TotalDeltaResponse
+}
+
+type TotalComparisonResponse struct {
+	TotalDeltaResponse
+	Services []ServiceDeltaResponse `json:"services"`
+}
+
+type PageLinks struct {
+	Self  string  `json:"self"`
+	First string  `json:"first"`
+	Prev  *string `json:"prev,omitempty"`
+	Next  *string `json:"next,omitempty"`
+}
+
+type SubscriptionPageResponse struct {
+	Items      any       `json:"items"` // []SubscriptionResponse или урезанные объекты при fields/include
+	Total      *int      `json:"total,omitempty"`
+	Limit      int       `json:"limit"`
+	Offset     *int      `json:"offset,omitempty"`
+	NextCursor *string   `json:"next_cursor,omitempty"`
+	Links      PageLinks `json:"links"`
+}
+
+type BulkOperationRequest struct {
+	Op   string                     `json:"op"` // create | update | delete
+	ID   string                     `json:"id,omitempty"`
+	Data *UpdateSubscriptionRequest `json:"data,omitempty"`
+}
+
+type BulkRequest struct {
+	Mode       string                 `json:"mode"` // atomic (по умолчанию) | best_effort
+	Operations []BulkOperationRequest `json:"operations"`
+}
+
+type BulkItemResult struct {
+	Index    int      `json:"index"`
+	Op       string   `json:"op"`
+	ID       string   `json:"id,omitempty"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Overlaps []string `json:"overlaps,omitempty"` // пересекающиеся подписки (warn - сохранено, reject - отклонено)
+}
+
+type ImportRowResponse struct {
+	Line     int      `json:"line"`
+	Status   string   `json:"status"`
+	ID       string   `json:"id,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Overlaps []string `json:"overlaps,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun     bool                `json:"dry_run"`
+	Total      int                 `json:"total"`
+	Created    int                 `json:"created"`
+	Duplicates int                 `json:"duplicates"`
+	Invalid    int                 `json:"invalid"`
+	Rejected   int                 `json:"rejected"`
+	Rows       []ImportRowResponse `json:"rows"`
+}
+
+type DuplicateResponse struct {
+	Subscriptions []SubscriptionResponse `json:"subscriptions"`
+	OverlapFrom   string                 `json:"overlap_from"`
+	OverlapTo     *string                `json:"overlap_to"`     // null - обе подписки бессрочные
+	OverlapMonths *int                   `json:"overlap_months"` // null для бессрочного пересечения
+}
+
+type MergeRequest struct {
+	MergeIDs []string `json:"merge_ids" binding:"required"`
+	Price    *int     `json:"price,omitempty"` // цена итоговой подписки, по умолчанию - цена целевой
+}
+
+type SplitRequest struct {
+	Month string `json:"month" binding:"required"` // MM-YYYY, с него начинается вторая часть
+	Price *int   `json:"price,omitempty"`          // цена второй части, по умолчанию - прежняя
+}
+
+type SplitResponse struct {
+	First  SubscriptionResponse `json:"first"`
+	Second SubscriptionResponse `json:"second"`
+}
+
+type HistoryEntryResponse struct {
+	ID         int64                 `json:"id"`
+	Action     string                `json:"action"`
+	RelatedIDs []string              `json:"related_ids"`
+	Before     *SubscriptionResponse `json:"before"`
+	After      *SubscriptionResponse `json:"after"`
+	CreatedAt  string                `json:"created_at"`
+}
+
+type ChangePlanRequest struct {
+	Plan          string `json:"plan" binding:"required"`
+	Price         *int   `json:"price,omitempty"`                   // цена на новом тарифе, по умолчанию - прежняя
+	EffectiveFrom string `json:"effective_from" binding:"required"` // MM-YYYY, первый месяц на новом тарифе
+}
+
+type ChangePlanResponse struct {
+	Previous SubscriptionResponse `json:"previous"`
+	Current  SubscriptionResponse `json:"current"`
+}
+
+type MRRMonthResponse struct {
+	Month       string `json:"month"`
+	MRR         int    `json:"mrr"`
+	New         int    `json:"new"`
+	Expansion   int    `json:"expansion"`
+	Contraction int    `json:"contraction"`
+	Churn       int    `json:"churn"`
+	Net         int    `json:"net"`
+}
+
+type MRRResponse struct {
+	Months []MRRMonthResponse `json:"months"`
+}
+
+type CancelRequest struct {
+	At *string `json:"at,omitempty"` // MM-YYYY, последний оплаченный месяц; по умолчанию текущий
+}
+
+type UpcomingChargeResponse struct {
+	Date           string  `json:"date"` // YYYY-MM-DD, списание первого числа месяца
+	SubscriptionID string  `json:"subscription_id"`
+	ServiceName    string  `json:"service_name"`
+	Plan           *string `json:"plan,omitempty"`
+	Amount         int     `json:"amount"`
+	Renewal        bool    `json:"renewal"` // списание за счет автопродления после end_date
+}
+
+type UpcomingChargesResponse struct {
+	UserID  string                   `json:"user_id"`
+	From    string                   `json:"from"` // YYYY-MM-DD включительно
+	To      string                   `json:"to"`   // YYYY-MM-DD включительно
+	Total   int                      `json:"total"`
+	Charges []UpcomingChargeResponse `json:"charges"`
+}
+
+type ServiceSpendResponse struct {
+	ServiceName   string `json:"service_name"`
+	MonthlySpend  int    `json:"monthly_spend"`
+	Subscriptions int    `json:"subscriptions"`
+}
+
+type UserSummaryResponse struct {
+	UserID              string                 `json:"user_id"`
+	Month               string                 `json:"month"`
+	ActiveSubscriptions int                    `json:"active_subscriptions"`
+	MonthlySpend        int                    `json:"monthly_spend"`
+	YearSpend           int                    `json:"year_spend"`     // с января по текущий месяц включительно
+	LifetimeSpend       int                    `json:"lifetime_spend"` // по текущий месяц включительно
+	TopServices         []ServiceSpendResponse `json:"top_services"`
+	UpcomingEnds        []SubscriptionResponse `json:"upcoming_ends"`
+}
+
+type CreateBudgetRequest struct {
+	UserID       string  `json:"user_id" binding:"required"`
+	ServiceName  *string `json:"service_name"` // не задан - общий бюджет на все подписки
+	MonthlyLimit int     `json:"monthly_limit" binding:"required"`
+	Thresholds   []int   `json:"thresholds"` // проценты от лимита, по умолчанию 80 и 100
+}
+
+type UpdateBudgetRequest struct {
+	ServiceName  *string `json:"service_name"`
+	MonthlyLimit int     `json:"monthly_limit" binding:"required"`
+	Thresholds   []int   `json:"thresholds"`
+}
+
+type BudgetResponse struct {
+	ID           string  `json:"id"`
+	UserID       string  `json:"user_id"`
+	ServiceName  *string `json:"service_name,omitempty"`
+	MonthlyLimit int     `json:"monthly_limit"`
+	Thresholds   []int   `json:"thresholds"`
+	CreatedAt    string  `json:"created_at"`
+	// расходы за текущий месяц
+	Month   string `json:"month"`
+	Spend   int    `json:"spend"`
+	Percent int    `json:"percent"`
+	Reached []int  `json:"reached"`
+}
+
+type BudgetAlertResponse struct {
+	ID           int64   `json:"id"`
+	BudgetID     string  `json:"budget_id"`
+	UserID       string  `json:"user_id"`
+	ServiceName  *string `json:"service_name,omitempty"`
+	Month        string  `json:"month"`
+	Threshold    int     `json:"threshold"`
+	Spend        int     `json:"spend"`
+	MonthlyLimit int     `json:"monthly_limit"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+type AnomalyResponse struct {
+	ID        int64   `json:"id"`
+	UserID    string  `json:"user_id"`
+	Month     string  `json:"month"`
+	Rule      string  `json:"rule"`
+	Spend     int     `json:"spend"`
+	Baseline  float64 `json:"baseline"` // jump - расходы прошлого месяца, zscore - среднее за окно
+	Score     float64 `json:"score"`    // jump - рост в процентах, zscore - z-оценка
+	CreatedAt string  `json:"created_at"`
+}
+
+type SimulationChangeRequest struct {
+	Type           string  `json:"type" binding:"required"` // cancel | add | reprice
+	SubscriptionID string  `json:"subscription_id"`         // для cancel и reprice
+	EffectiveFrom  *string `json:"effective_from"`          // MM-YYYY, по умолчанию from
+	UserID         string  `json:"user_id"`                 // для add, по умолчанию из фильтра
+	ServiceName    string  `json:"service_name"`
+	Price          *int    `json:"price"` // для add и reprice
+	EndDate        *string `json:"end_date"`
+}
+
+type SimulateTotalRequest struct {
+	TotalQueryRequest
+	Changes []SimulationChangeRequest `json:"changes"`
+}
+
+type SimulationLineResponse struct {
+	SubscriptionID *string `json:"subscription_id"` // null - подписка добавлена симуляцией
+	ServiceName    string  `json:"service_name"`
+	Baseline       int     `json:"baseline"`
+	Simulated      int     `json:"simulated"`
+}
+
+type SimulationResponse struct {
+	Baseline  int                      `json:"baseline"`
+	Simulated int                      `json:"simulated"`
+	Change    int                      `json:"change"` // simulated - baseline, экономия - отрицательное число
+	Lines     []SimulationLineResponse `json:"lines"`
+}
+
+type WebhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	Secret     string   `json:"secret"`      // при создании пустой - сгенерировать, при изменении - оставить прежний
+	EventTypes []string `json:"event_types"` // пустой - все события
+	Active     *bool    `json:"active"`
+}
+
+type WebhookResponse struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"` // только в ответе на создание
+	EventTypes []string `json:"event_types"`
+	Active     bool     `json:"active"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             int64   `json:"id"`
+	WebhookID      string  `json:"webhook_id"`
+	EventID        string  `json:"event_id"`
+	EventType      string  `json:"event_type"`
+	SubscriptionID string  `json:"subscription_id"`
+	Status         string  `json:"status"`
+	Attempts       int     `json:"attempts"`
+	NextAttemptAt  *string `json:"next_attempt_at,omitempty"` // только для pending
+	LastStatusCode *int    `json:"last_status_code,omitempty"`
+	LastError      *string `json:"last_error,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	DeliveredAt    *string `json:"delivered_at,omitempty"`
 }
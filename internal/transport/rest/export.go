@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/export"
+)
+
+var exportSubscriptionColumns = []string{"id", "user_id", "service_name", "price", "start_date", "end_date", "created_at", "plan", "previous_id", "auto_renew", "canceled_at"}
+
+// exportSubscriptions выгружает подписки с теми же фильтрами и сортировкой, что и листинг.
+// Строки пишутся в ответ по мере чтения из БД
+func (h *Handler) exportSubscriptions(c *gin.Context) {
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.CSV)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sort, err := parseSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w, ok := startExport(c, format, "subscriptions")
+	if !ok {
+		return
+	}
+	if err := w.WriteHeader(exportSubscriptionColumns); err != nil {
+		abortExport(c, err)
+		return
+	}
+
+	err = h.service.Stream(c.Request.Context(), filter, sort, func(s domain.Subscription) error {
+		r := toSubscriptionResponse(&s)
+		return w.WriteRow([]any{r.ID, r.UserID, r.ServiceName, r.Price, r.StartDate, nullable(r.EndDate), r.CreatedAt, nullable(r.Plan), nullable(r.PreviousID), r.AutoRenew, nullable(r.CanceledAt)})
+	})
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		abortExport(c, err)
+	}
+}
+
+// exportMonthlySpend выгружает помесячные расходы по сервисам за период (разбивка TotalCost)
+func (h *Handler) exportMonthlySpend(c *gin.Context) {
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.CSV)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// разбивка считается в памяти, так что ошибку БД еще можно отдать нормальным ответом
+	rows, err := h.service.MonthlySpendBreakdown(c.Request.Context(), filter, from, to)
+	if err != nil {
+		slog.Error("failed to calc monthly spend", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	w, ok := startExport(c, format, "monthly-spend")
+	if !ok {
+		return
+	}
+	if err := w.WriteHeader([]string{"month", "service_name", "amount"}); err != nil {
+		abortExport(c, err)
+		return
+	}
+	for _, r := range rows {
+		if err := w.WriteRow([]any{toMonthYear(r.Month), r.ServiceName, r.Amount}); err != nil {
+			abortExport(c, err)
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		abortExport(c, err)
+	}
+}
+
+func startExport(c *gin.Context, format export.Format, name string) (export.Writer, bool) {
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(format, c.Writer)
+	if err != nil {
+		abortExport(c, err)
+		return nil, false
+	}
+	return w, true
+}
+
+// abortExport - заголовки уже отправлены, поменять статус нельзя. Рвем соединение,
+// чтобы клиент увидел незавершенный ответ, а не принял обрезанный файл за целый
+func abortExport(c *gin.Context, err error) {
+	slog.Error("export failed", "error", err)
+	c.Abort()
+	if conn, _, herr := c.Writer.Hijack(); herr == nil {
+		conn.Close()
+	}
+}
+
+// nullable - пустая ячейка для nil
+func nullable(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+// поля SubscriptionResponse, которые можно запросить через fields=
+var subscriptionFields = []string{"id", "user_id", "service_name", "price", "start_date", "end_date", "created_at", "plan", "previous_id", "auto_renew", "canceled_at"}
+
+// вычисляемые атрибуты, которые можно встроить через include=
+var subscriptionIncludes = []string{"monthly_cost", "months_active", "lifetime_cost", "remaining_months", "next_charge_date"}
+
+// responseShape - какие поля отдать и какие вычисляемые атрибуты добавить
+type responseShape struct {
+	fields  []string
+	include []string
+	now     time.Time
+}
+
+// parseResponseShape разбирает fields= и include=. nil - параметры не заданы, отдаем обычный ответ
+func parseResponseShape(c *gin.Context) (*responseShape, error) {
+	fieldsStr, includeStr := c.Query("fields"), c.Query("include")
+	if fieldsStr == "" && includeStr == "" {
+		return nil, nil
+	}
+
+	shape := &responseShape{fields: subscriptionFields, now: time.Now()}
+	var err error
+	if fieldsStr != "" {
+		if shape.fields, err = parseFieldList("fields", fieldsStr, subscriptionFields); err != nil {
+			return nil, err
+		}
+	}
+	if includeStr != "" {
+		if shape.include, err = parseFieldList("include", includeStr, subscriptionIncludes); err != nil {
+			return nil, err
+		}
+	}
+	return shape, nil
+}
+
+func parseFieldList(param, s string, allowed []string) ([]string, error) {
+	var result []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !slices.Contains(allowed, f) {
+			return nil, fmt.Errorf("invalid %s value %q, allowed: %s", param, f, strings.Join(allowed, ","))
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func (sh *responseShape) apply(sub *domain.Subscription) map[string]any {
+	full := toSubscriptionResponse(sub)
+	out := make(map[string]any, len(sh.fields)+len(sh.include))
+	for _, f := range sh.fields {
+		switch f {
+		case "id":
+			out[f] = full.ID
+		case "user_id":
+			out[f] = full.UserID
+		case "service_name":
+			out[f] = full.ServiceName
+		case "price":
+			out[f] = full.Price
+		case "start_date":
+			out[f] = full.StartDate
+		case "end_date":
+			out[f] = full.EndDate
+		case "created_at":
+			out[f] = full.CreatedAt
+		case "plan":
+			out[f] = full.Plan
+		case "previous_id":
+			out[f] = full.PreviousID
+		case "auto_renew":
+			out[f] = full.AutoRenew
+		case "canceled_at":
+			out[f] = full.CanceledAt
+		}
+	}
+
+	if len(sh.include) == 0 {
+		return out
+	}
+	m := service.ComputeMetrics(*sub, sh.now)
+	for _, inc := range sh.include {
+		switch inc {
+		case "monthly_cost":
+			out[inc] = m.MonthlyCost
+		case "months_active":
+			out[inc] = m.MonthsActive
+		case "lifetime_cost":
+			out[inc] = m.LifetimeCost
+		case "remaining_months":
+			out[inc] = m.RemainingMonths
+		case "next_charge_date":
+			out[inc] = toMonthYearPtr(m.NextChargeDate)
+		}
+	}
+	return out
+}
+
+// shapeSubscriptions возвращает обычные ответы или урезанные/расширенные, если задан shape
+func shapeSubscriptions(shape *responseShape, items []domain.Subscription) any {
+	if shape == nil {
+		return toSubscriptionResponses(items)
+	}
+	resp := make([]map[string]any, 0, len(items))
+	for i := range items {
+		resp = append(resp, shape.apply(&items[i]))
+	}
+	return resp
+}
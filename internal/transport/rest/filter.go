@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// parseFilter собирает фильтр из query-параметров. Используется листингом и всеми расчетами сумм.
+// user_id и service_name можно повторять (user_id еще и через запятую) - тогда подходит любой из них
+func parseFilter(c *gin.Context) (repository.SubscriptionFilter, error) {
+	return parseFilterValues(c.Request.URL.Query())
+}
+
+// parseFilterValues - parseFilter из готовых значений параметров (фильтр в теле total:batch)
+func parseFilterValues(q url.Values) (repository.SubscriptionFilter, error) {
+	var filter repository.SubscriptionFilter
+
+	var userIDs []uuid.UUID
+	for _, v := range q["user_id"] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			userID, err := uuid.Parse(part)
+			if err != nil {
+				return filter, errors.New("invalid user_id")
+			}
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if len(userIDs) == 1 {
+		filter.UserID = &userIDs[0]
+	} else if len(userIDs) > 1 {
+		filter.UserIDs = userIDs
+	}
+
+	var serviceNames []string
+	for _, sn := range q["service_name"] {
+		if sn != "" {
+			serviceNames = append(serviceNames, sn)
+		}
+	}
+	if len(serviceNames) == 1 {
+		filter.ServiceName = &serviceNames[0]
+	} else if len(serviceNames) > 1 {
+		filter.ServiceNames = serviceNames
+	}
+
+	if sc := q.Get("service_name_contains"); sc != "" {
+		filter.ServiceNameContains = &sc
+	}
+
+	var err error
+	if filter.PriceMin, err = optionalInt("price_min", q.Get("price_min")); err != nil {
+		return filter, err
+	}
+	if filter.PriceMax, err = optionalInt("price_max", q.Get("price_max")); err != nil {
+		return filter, err
+	}
+
+	months := []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"start_from", &filter.StartFrom},
+		{"start_to", &filter.StartTo},
+		{"end_from", &filter.EndFrom},
+		{"end_to", &filter.EndTo},
+		{"active_at", &filter.ActiveAt},
+		{"renews_from", &filter.RenewsFrom},
+		{"renews_to", &filter.RenewsTo},
+		{"ends_from", &filter.EndsFrom},
+		{"ends_to", &filter.EndsTo},
+	}
+	for _, m := range months {
+		if *m.dst, err = optionalMonth(m.name, q.Get(m.name)); err != nil {
+			return filter, err
+		}
+	}
+
+	if oe := q.Get("open_ended"); oe != "" {
+		v, err := strconv.ParseBool(oe)
+		if err != nil {
+			return filter, errors.New("invalid open_ended, expected true or false")
+		}
+		filter.OpenEnded = v
+	}
+
+	if ar := q.Get("auto_renew"); ar != "" {
+		v, err := strconv.ParseBool(ar)
+		if err != nil {
+			return filter, errors.New("invalid auto_renew, expected true or false")
+		}
+		filter.AutoRenew = &v
+	}
+
+	return filter, nil
+}
+
+// filterParams - параметры, которые разбирает parseFilter
+var filterParams = []string{
+	"user_id", "service_name", "service_name_contains", "price_min", "price_max",
+	"start_from", "start_to", "end_from", "end_to", "active_at",
+	"renews_from", "renews_to", "ends_from", "ends_to", "open_ended", "auto_renew",
+}
+
+// filterValues переводит фильтр из JSON в значения параметров для parseFilterValues
+func filterValues(f TotalFilterRequest) (url.Values, error) {
+	values := make(url.Values, len(f))
+	for name, v := range f {
+		if !slices.Contains(filterParams, name) {
+			return nil, fmt.Errorf("unknown filter field %s", name)
+		}
+		items, ok := v.([]any)
+		if !ok {
+			items = []any{v}
+		}
+		for _, item := range items {
+			switch item := item.(type) {
+			case string:
+				values.Add(name, item)
+			case float64:
+				values.Add(name, strconv.FormatFloat(item, 'f', -1, 64))
+			case bool:
+				values.Add(name, strconv.FormatBool(item))
+			case nil:
+			default:
+				return nil, fmt.Errorf("invalid filter field %s", name)
+			}
+		}
+	}
+	return values, nil
+}
+
+// queryInt - необязательный целочисленный query-параметр
+func queryInt(c *gin.Context, name string) (*int, error) {
+	return optionalInt(name, c.Query(name))
+}
+
+func optionalInt(name, s string) (*int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, errors.New("invalid " + name + ", expected integer")
+	}
+	return &v, nil
+}
+
+// queryMonth - необязательный query-параметр в формате MM-YYYY
+func queryMonth(c *gin.Context, name string) (*time.Time, error) {
+	return optionalMonth(name, c.Query(name))
+}
+
+func optionalMonth(name, s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(MonthYearLayout, s)
+	if err != nil {
+		return nil, errors.New("invalid " + name + " format, expected MM-YYYY")
+	}
+	return &t, nil
+}
@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestParseFilterValues(t *testing.T) {
+	userID, otherID := uuid.New(), uuid.New()
+	month := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	name, contains := "Netflix", "plus"
+	low, high, yes := 100, 500, true
+
+	tests := []struct {
+		name    string
+		query   string
+		want    repository.SubscriptionFilter
+		wantErr string
+	}{
+		{name: "empty", query: ""},
+		{
+			name:  "single user and service",
+			query: "user_id=" + userID.String() + "&service_name=Netflix",
+			want:  repository.SubscriptionFilter{UserID: &userID, ServiceName: &name},
+		},
+		{
+			name:  "users repeated and comma-separated",
+			query: "user_id=" + userID.String() + ",+" + otherID.String() + "&service_name=Netflix&service_name=Kion",
+			want:  repository.SubscriptionFilter{UserIDs: []uuid.UUID{userID, otherID}, ServiceNames: []string{"Netflix", "Kion"}},
+		},
+		{
+			name:  "price, substring and months",
+			query: "price_min=100&price_max=500&service_name_contains=plus&start_from=07-2025&active_at=07-2025&ends_to=07-2025",
+			want: repository.SubscriptionFilter{PriceMin: &low, PriceMax: &high, ServiceNameContains: &contains,
+				StartFrom: &month, ActiveAt: &month, EndsTo: &month},
+		},
+		{
+			name:  "flags",
+			query: "open_ended=true&auto_renew=true",
+			want:  repository.SubscriptionFilter{OpenEnded: true, AutoRenew: &yes},
+		},
+		{name: "invalid user", query: "user_id=42", wantErr: "invalid user_id"},
+		{name: "invalid price", query: "price_min=cheap", wantErr: "invalid price_min, expected integer"},
+		{name: "invalid month", query: "end_from=2025-07", wantErr: "invalid end_from format, expected MM-YYYY"},
+		{name: "invalid flag", query: "open_ended=maybe", wantErr: "invalid open_ended, expected true or false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseFilterValues(q)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("parseFilterValues() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFilterValues() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFilterValues() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
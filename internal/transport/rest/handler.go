@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"encoding/json"
+	"errors"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"log/slog"
@@ -17,12 +19,30 @@ import (
 
 const MonthYearLayout = "01-2006" // это шаблон для парсинга даты из строки
 
+const maxForecastMonths = 60
+
 type Handler struct {
-	service *service.SubscriptionService
+	service            *service.SubscriptionService
+	idempotencyService *service.IdempotencyService
+	budgetService      *service.BudgetService
+	anomalyService     *service.AnomalyService
+	webhookService     *service.WebhookService
 }
 
-func NewHandler(service *service.SubscriptionService) *Handler {
-	return &Handler{service: service}
+func NewHandler(
+	service *service.SubscriptionService,
+	idempotencyService *service.IdempotencyService,
+	budgetService *service.BudgetService,
+	anomalyService *service.AnomalyService,
+	webhookService *service.WebhookService,
+) *Handler {
+	return &Handler{
+		service:            service,
+		idempotencyService: idempotencyService,
+		budgetService:      budgetService,
+		anomalyService:     anomalyService,
+		webhookService:     webhookService,
+	}
 }
 
 func (h *Handler) InitRoutes() *gin.Engine {
@@ -39,13 +59,54 @@ func (h *Handler) InitRoutes() *gin.Engine {
 
 	api := router.Group("/api/v1")
 	{
-		api.POST("/subscriptions", h.createSubscription)
+		api.POST("/subscriptions", h.idempotency, h.createSubscription)
+		api.POST("/subscriptions:action", h.subscriptionsAction) // /subscriptions:bulk
+		api.POST("/subscriptions/total:action", h.totalAction)   // /subscriptions/total:batch
 		api.GET("/subscriptions/:id", h.getSubscription)
 		api.PUT("/subscriptions/:id", h.updateSubscription)
 		api.DELETE("/subscriptions/:id", h.deleteSubscription)
 		api.GET("/subscriptions", h.listSubscriptions)
 
 		api.GET("/subscriptions/total", h.totalCost)
+		api.GET("/subscriptions/total/compare", h.compareTotals)
+		api.GET("/subscriptions/total/export", h.exportMonthlySpend)
+		api.GET("/subscriptions/export", h.exportSubscriptions)
+		api.GET("/subscriptions/duplicates", h.duplicates)
+		api.POST("/subscriptions/total/simulate", h.simulateTotal)
+		api.POST("/subscriptions/:id/merge", h.mergeSubscriptions)
+		api.POST("/subscriptions/:id/split", h.splitSubscription)
+		api.POST("/subscriptions/:id/change-plan", h.changePlan)
+		api.POST("/subscriptions/:id/cancel", h.cancelSubscription)
+		api.GET("/subscriptions/:id/history", h.subscriptionHistory)
+		api.POST("/subscriptions/import", h.importSubscriptions)
+		api.GET("/subscriptions/retention", h.retention)
+		api.GET("/subscriptions/forecast", h.forecast)
+		api.GET("/subscriptions/mrr", h.mrrMovements)
+
+		api.GET("/users/:user_id/upcoming-charges", h.upcomingCharges)
+		api.GET("/users/:user_id/summary", h.userSummary)
+
+		api.POST("/budgets", h.createBudget)
+		api.GET("/budgets", h.listBudgets)
+		api.GET("/budgets/alerts", h.budgetAlerts)
+		api.GET("/budgets/:id", h.getBudget)
+		api.PUT("/budgets/:id", h.updateBudget)
+		api.DELETE("/budgets/:id", h.deleteBudget)
+
+		api.GET("/anomalies", h.listAnomalies)
+
+		api.POST("/webhooks", h.createWebhook)
+		api.GET("/webhooks", h.listWebhooks)
+		api.GET("/webhooks/deliveries", h.webhookDeliveries)
+		api.POST("/webhooks/deliveries/:id/redeliver", h.redeliverWebhook)
+		api.GET("/webhooks/:id", h.getWebhook)
+		api.PUT("/webhooks/:id", h.updateWebhook)
+		api.DELETE("/webhooks/:id", h.deleteWebhook)
+	}
+
+	v2 := router.Group("/api/v2")
+	{
+		v2.GET("/subscriptions", h.listSubscriptionsPage)
 	}
 
 	return router
@@ -70,21 +131,55 @@ func (h *Handler) createSubscription(c *gin.Context) {
 		return
 	}
 
+	if err := validateSubscription(&domain.Subscription{Price: *req.Price, StartDate: parsedDate}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := parseOverlapPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	input := service.CreateSubscriptionInput{
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		UserID:      userUUID,
-		StartDate:   parsedDate,
+		ServiceName:   req.ServiceName,
+		Price:         *req.Price,
+		UserID:        userUUID,
+		StartDate:     parsedDate,
+		Plan:          req.Plan,
+		AutoRenew:     req.AutoRenew,
+		OverlapPolicy: policy,
+	}
+	if req.ID != "" {
+		id, err := uuid.Parse(req.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		input.ID = &id
 	}
 
-	id, err := h.service.Create(c.Request.Context(), input)
+	id, overlaps, err := h.service.Create(c.Request.Context(), input)
+	if errors.Is(err, repository.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if writeOverlapError(c, err) {
+		return
+	}
 	if err != nil {
 		slog.Error("failed to create subscription", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"id": id})
+	setOverlapHeader(c, overlaps)
+	resp := gin.H{"id": id}
+	if len(overlaps) > 0 {
+		resp["overlaps"] = overlapIDs(overlaps)
+	}
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (h *Handler) getSubscription(c *gin.Context) {
@@ -95,6 +190,12 @@ func (h *Handler) getSubscription(c *gin.Context) {
 		return
 	}
 
+	shape, err := parseResponseShape(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	sub, err := h.service.GetByID(c.Request.Context(), id)
 	if err != nil {
 		slog.Error("failed to get subscription", "error", err)
@@ -102,6 +203,10 @@ func (h *Handler) getSubscription(c *gin.Context) {
 		return
 	}
 
+	if shape != nil {
+		c.JSON(http.StatusOK, shape.apply(sub))
+		return
+	}
 	c.JSON(http.StatusOK, toSubscriptionResponse(sub)) // для правильного отображения в API
 }
 
@@ -119,43 +224,49 @@ func (h *Handler) updateSubscription(c *gin.Context) {
 		return
 	}
 
-	startDate, err := time.Parse(MonthYearLayout, req.StartDate)
+	sub, err := toSubscription(id, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_date format, expected MM-YYYY"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := parseOverlapPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var endDate *time.Time
-	if req.EndDate != nil {
-		ed, err := time.Parse(MonthYearLayout, *req.EndDate)
+	// upsert=true - создать подписку с этим id, если ее нет (для синхронизации с внешними системами)
+	if c.Query("upsert") == "true" {
+		created, overlaps, err := h.service.Upsert(c.Request.Context(), sub, policy)
+		if writeOverlapError(c, err) {
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date format, expected MM-YYYY"})
+			slog.Error("failed to upsert subscription", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 			return
 		}
-		endDate = &ed
-	}
-
-	userUUID, err := uuid.Parse(req.UserID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		setOverlapHeader(c, overlaps)
+		if created {
+			c.JSON(http.StatusCreated, gin.H{"id": sub.ID})
+			return
+		}
+		c.Status(http.StatusNoContent)
 		return
 	}
 
-	sub := &domain.Subscription{
-		ID:          id,
-		UserID:      userUUID,
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		StartDate:   startDate,
-		EndDate:     endDate,
+	overlaps, err := h.service.Update(c.Request.Context(), sub, policy)
+	if writeOverlapError(c, err) {
+		return
 	}
-
-	if err := h.service.Update(c.Request.Context(), sub); err != nil {
+	if err != nil {
 		slog.Error("failed to update subscription", "error", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
 
+	setOverlapHeader(c, overlaps)
 	c.Status(http.StatusNoContent)
 }
 
@@ -177,87 +288,324 @@ func (h *Handler) deleteSubscription(c *gin.Context) {
 }
 
 func (h *Handler) listSubscriptions(c *gin.Context) {
-	var filter repository.SubscriptionFilter
+	filter, page, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shape, err := parseResponseShape(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if userIDStr := c.Query("user_id"); userIDStr != "" {
-		if userID, err := uuid.Parse(userIDStr); err == nil {
-			filter.UserID = &userID
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
-			return
-		}
+	items, next, err := h.service.List(c.Request.Context(), filter, page)
+	if err != nil {
+		slog.Error("failed to list subscriptions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
 	}
-	if sn := c.Query("service_name"); sn != "" {
-		filter.ServiceName = &sn
+
+	// тело ответа - по-прежнему массив, курсор следующей страницы отдаем в заголовке
+	if next != nil {
+		c.Header("X-Next-Cursor", encodeCursor(page.Sort, next))
 	}
 
-	limit := 50
-	offset := 0
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.Atoi(l); err == nil && v > 0 {
-			limit = v
-		}
+	c.JSON(http.StatusOK, shapeSubscriptions(shape, items))
+}
+
+// listSubscriptionsPage - v2 листинга: ответ в конверте с total, курсором и ссылками
+func (h *Handler) listSubscriptionsPage(c *gin.Context) {
+	filter, page, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if o := c.Query("offset"); o != "" {
-		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
-			offset = v
-		}
+	shape, err := parseResponseShape(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	items, err := h.service.List(c.Request.Context(), filter, limit, offset)
+	items, next, err := h.service.List(c.Request.Context(), filter, page)
 	if err != nil {
 		slog.Error("failed to list subscriptions", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	resp := make([]SubscriptionResponse, 0, len(items))
-	for i := range items {
-		s := items[i]
-		resp = append(resp, toSubscriptionResponse(&s))
+	resp := SubscriptionPageResponse{
+		Items: shapeSubscriptions(shape, items),
+		Limit: page.Limit,
+		Links: pageLinks(c, page, next),
+	}
+	if page.After == nil {
+		offset := page.Offset
+		resp.Offset = &offset
+	}
+	if next != nil {
+		cur := encodeCursor(page.Sort, next)
+		resp.NextCursor = &cur
+	}
+
+	// count(*) по большой таблице недешевый, поэтому только по запросу
+	if c.Query("with_total") == "true" {
+		total, err := h.service.Count(c.Request.Context(), filter)
+		if err != nil {
+			slog.Error("failed to count subscriptions", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		resp.Total = &total
 	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
 func (h *Handler) totalCost(c *gin.Context) {
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	fromStr := c.Query("from")
-	toStr := c.Query("to")
-	if fromStr == "" || toStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required (MM-YYYY)"})
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	from, err := time.Parse(MonthYearLayout, fromStr)
+	if c.Query("explain") == "true" {
+		total, lines, err := h.service.TotalCostExplain(c.Request.Context(), filter, from, to)
+		if err != nil {
+			slog.Error("failed to calc total", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, toTotalExplainResponse(total, lines))
+		return
+	}
+
+	total, err := h.service.TotalCost(c.Request.Context(), filter, from, to)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from format, expected MM-YYYY"})
+		slog.Error("failed to calc total", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
-	to, err := time.Parse(MonthYearLayout, toStr)
+
+	c.JSON(http.StatusOK, gin.H{"total": total})
+}
+
+func (h *Handler) compareTotals(c *gin.Context) {
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	baselineFromStr := c.Query("baseline_from")
+	baselineToStr := c.Query("baseline_to")
+	if baselineFromStr == "" || baselineToStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "baseline_from and baseline_to are required (MM-YYYY)"})
+		return
+	}
+	baselineFrom, err := time.Parse(MonthYearLayout, baselineFromStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid baseline_from format, expected MM-YYYY"})
+		return
+	}
+	baselineTo, err := time.Parse(MonthYearLayout, baselineToStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid baseline_to format, expected MM-YYYY"})
+		return
+	}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cmp, err := h.service.CompareTotals(c.Request.Context(), filter, from, to, baselineFrom, baselineTo)
+	if err != nil {
+		slog.Error("failed to compare totals", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toTotalComparisonResponse(cmp))
+}
+
+// subscriptionsAction - кастомные методы коллекции; параметр action включает двоеточие
+func (h *Handler) subscriptionsAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":bulk":
+		h.bulkSubscriptions(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	}
+}
+
+// totalAction - кастомные методы итоговой суммы, как subscriptionsAction
+func (h *Handler) totalAction(c *gin.Context) {
+	switch c.Param("action") {
+	case ":batch":
+		h.totalCostBatch(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	}
+}
+
+func (h *Handler) totalCostBatch(c *gin.Context) {
+	// без ShouldBindJSON: binding:"required" в элементах отклонил бы весь пакет,
+	// а ошибка одного запроса возвращается только в его результате
+	var req []TotalQueryRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one query is required"})
+		return
+	}
+	if len(req) > service.MaxTotalBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrBatchTooLarge.Error()})
+		return
+	}
+
+	results := make([]TotalBatchResult, len(req))
+	queries := make([]service.TotalQuery, 0, len(req))
+	indexes := make([]int, 0, len(req)) // номер запроса пакета для каждого из queries
+	for i, q := range req {
+		results[i].Index = i
+		query, err := toTotalQuery(q)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		queries = append(queries, query)
+		indexes = append(indexes, i)
+	}
+
+	totals, err := h.service.TotalCostBatch(c.Request.Context(), queries)
+	if err != nil {
+		slog.Error("failed to calc batch totals", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	for j, t := range totals {
+		r := &results[indexes[j]]
+		if t.Err != nil {
+			slog.Error("failed to calc batch total", "index", r.Index, "error", t.Err)
+			r.Error = "internal server error"
+			continue
+		}
+		r.Total = &t.Total
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func (h *Handler) retention(c *gin.Context) {
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cohorts, err := h.service.Retention(c.Request.Context(), filter, from, to)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to format, expected MM-YYYY"})
+		slog.Error("failed to calc retention", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	var filter repository.SubscriptionFilter
-	if userIDStr := c.Query("user_id"); userIDStr != "" {
-		if userID, err := uuid.Parse(userIDStr); err == nil {
-			filter.UserID = &userID
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+	c.JSON(http.StatusOK, toRetentionResponse(cohorts))
+}
+
+func (h *Handler) forecast(c *gin.Context) {
+	months := 12
+	if m := c.Query("months"); m != "" {
+		v, err := strconv.Atoi(m)
+		if err != nil || v < 1 || v > maxForecastMonths {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid months, expected 1.." + strconv.Itoa(maxForecastMonths)})
 			return
 		}
+		months = v
 	}
-	if sn := c.Query("service_name"); sn != "" {
-		filter.ServiceName = &sn
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	total, err := h.service.TotalCost(c.Request.Context(), filter, from, to)
+	forecast, err := h.service.Forecast(c.Request.Context(), filter, months)
 	if err != nil {
-		slog.Error("failed to calc total", "error", err)
+		slog.Error("failed to calc forecast", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"total": total})
+	c.JSON(http.StatusOK, toForecastResponse(forecast))
+}
+
+// parseListParams разбирает фильтр и параметры страницы листинга (limit, offset, cursor)
+func parseListParams(c *gin.Context) (repository.SubscriptionFilter, repository.Page, error) {
+	page := repository.Page{Limit: 50}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		return filter, page, err
+	}
+
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			page.Limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			page.Offset = v
+		}
+	}
+	sort, err := parseSort(c.Query("sort"))
+	if err != nil {
+		return filter, page, err
+	}
+	page.Sort = sort
+
+	// cursor имеет приоритет над offset, offset оставлен для совместимости
+	if cur := c.Query("cursor"); cur != "" {
+		after, err := decodeCursor(cur, page.Sort)
+		if err != nil {
+			return filter, page, err
+		}
+		page.After = after
+	}
+	return filter, page, nil
+}
+
+// parsePeriod разбирает обязательные query-параметры from и to в формате MM-YYYY
+func parsePeriod(c *gin.Context) (time.Time, time.Time, error) {
+	fromStr := c.Query("from")
+	toStr := c.Query("to")
+	if fromStr == "" || toStr == "" {
+		return time.Time{}, time.Time{}, errors.New("from and to are required (MM-YYYY)")
+	}
+
+	from, err := time.Parse(MonthYearLayout, fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid from format, expected MM-YYYY")
+	}
+	to, err := time.Parse(MonthYearLayout, toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid to format, expected MM-YYYY")
+	}
+	return from, to, nil
 }
@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// тело запроса с ключом читается в память целиком, чтобы посчитать отпечаток, поэтому
+	// middleware подключается только к POST с небольшим JSON, но не к потоковому импорту
+	maxIdempotentBodySize = 1 << 20
+)
+
+// bodyRecorder дублирует тело ответа в буфер, чтобы сохранить его под ключом идемпотентности
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotency обрабатывает заголовок Idempotency-Key у POST-запросов тех маршрутов, к которым подключен.
+// Повтор с тем же ключом и тем же запросом получает сохраненный ответ,
+// тот же ключ с другим запросом - 422, ключ, запрос по которому еще выполняется, - 409.
+// Ключ действует в пределах метода и пути: тот же ключ для другого эндпоинта - другой ключ
+func (h *Handler) idempotency(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if c.Request.Method != http.MethodPost || key == "" || h.idempotencyService == nil {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body with Idempotency-Key must not exceed %d bytes", maxIdempotentBodySize)})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	key = scopedIdempotencyKey(c.Request, key)
+
+	stored, err := h.idempotencyService.Begin(c.Request.Context(), key, requestHash(c.Request, body))
+	switch {
+	case errors.Is(err, service.ErrIdempotencyKeyMismatch):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrIdempotencyKeyInProgress):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		slog.Error("failed to check idempotency key", "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if stored != nil {
+		c.Header(idempotentReplayedHeader, "true")
+		c.Data(stored.StatusCode, stored.ContentType, stored.Body)
+		c.Abort()
+		return
+	}
+
+	// контекст запроса к этому моменту может быть отменен, а ключ нужно сохранить или освободить в любом случае
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	// паника обработчика перехватывается Recovery снаружи этого middleware и до Finish не доходит:
+	// освобождаем ключ, иначе он до конца TTL будет отвечать 409
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := h.idempotencyService.Release(ctx, key); err != nil {
+			slog.Error("failed to release idempotency key", "error", err)
+		}
+	}()
+
+	rec := &bodyRecorder{ResponseWriter: c.Writer}
+	c.Writer = rec
+	c.Next()
+	completed = true
+
+	resp := service.IdempotentResponse{
+		StatusCode:  rec.Status(),
+		ContentType: rec.Header().Get("Content-Type"),
+		Body:        rec.body.Bytes(),
+	}
+	if err := h.idempotencyService.Finish(ctx, key, resp); err != nil {
+		slog.Error("failed to save idempotent response", "error", err)
+	}
+}
+
+// scopedIdempotencyKey - ключ в хранилище: метод, путь и ключ клиента. Клиентов сервис не различает
+// (аутентификации нет), поэтому ключи разных клиентов одного эндпоинта по-прежнему общие
+func scopedIdempotencyKey(r *http.Request, key string) string {
+	return r.Method + " " + r.URL.Path + " " + key
+}
+
+// requestHash - отпечаток запроса: метод, путь с параметрами и тело
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
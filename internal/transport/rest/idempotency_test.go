@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+type fakeIdempotencyKeys struct {
+	mu   sync.Mutex
+	keys map[string]*repository.IdempotencyRecord
+}
+
+func (f *fakeIdempotencyKeys) Reserve(_ context.Context, key, requestHash string, _ time.Time) (*repository.IdempotencyRecord, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rec, ok := f.keys[key]; ok {
+		return rec, false, nil
+	}
+	f.keys[key] = &repository.IdempotencyRecord{Key: key, RequestHash: requestHash}
+	return nil, true, nil
+}
+
+func (f *fakeIdempotencyKeys) Complete(_ context.Context, key string, statusCode int, contentType string, body []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rec := f.keys[key]
+	rec.StatusCode, rec.ContentType, rec.Body = statusCode, contentType, body
+	return nil
+}
+
+func (f *fakeIdempotencyKeys) Release(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.keys, key)
+	return nil
+}
+
+func (f *fakeIdempotencyKeys) DeleteExpired(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func newIdempotencyRouter(handler gin.HandlerFunc) (*gin.Engine, *fakeIdempotencyKeys) {
+	gin.SetMode(gin.TestMode)
+	keys := &fakeIdempotencyKeys{keys: make(map[string]*repository.IdempotencyRecord)}
+	h := &Handler{idempotencyService: service.NewIdempotencyService(keys, time.Hour)}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/", h.idempotency, handler)
+	return router, keys
+}
+
+func postWithKey(router http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	calls := 0
+	router, _ := newIdempotencyRouter(func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"calls": calls})
+	})
+
+	first := postWithKey(router, `{"a":1}`)
+	second := postWithKey(router, `{"a":1}`)
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() || second.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+
+	if w := postWithKey(router, `{"a":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key with another body: %d, want 422", w.Code)
+	}
+}
+
+// после паники обработчика ключ освобождается, и запрос можно повторить
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	panics := true
+	router, keys := newIdempotencyRouter(func(c *gin.Context) {
+		if panics {
+			panic("boom")
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	if w := postWithKey(router, "{}"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking handler: %d, want 500", w.Code)
+	}
+	if len(keys.keys) != 0 {
+		t.Fatalf("key is still reserved after panic")
+	}
+
+	panics = false
+	if w := postWithKey(router, "{}"); w.Code != http.StatusNoContent {
+		t.Errorf("retry: %d, want 204", w.Code)
+	}
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	called := false
+	router, keys := newIdempotencyRouter(func(c *gin.Context) {
+		called = true
+	})
+
+	w := postWithKey(router, string(bytes.Repeat([]byte("a"), maxIdempotentBodySize+1)))
+	if w.Code != http.StatusRequestEntityTooLarge || called || len(keys.keys) != 0 {
+		t.Errorf("oversized body: %d, handler called %v, %d keys reserved", w.Code, called, len(keys.keys))
+	}
+}
+
+// ключ действует в пределах метода и пути
+func TestIdempotencyKeyScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := &fakeIdempotencyKeys{keys: make(map[string]*repository.IdempotencyRecord)}
+	h := &Handler{idempotencyService: service.NewIdempotencyService(keys, time.Hour)}
+	calls := 0
+	handler := func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusCreated)
+	}
+	router := gin.New()
+	router.POST("/a", h.idempotency, handler)
+	router.POST("/b", h.idempotency, handler)
+
+	for _, path := range []string{"/a", "/b", "/a"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"a":1}`))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Errorf("POST %s: %d, want 201", path, w.Code)
+		}
+	}
+	if calls != 2 || len(keys.keys) != 2 {
+		t.Errorf("handler called %d times, %d keys stored, want 2, 2", calls, len(keys.keys))
+	}
+}
+
+// middleware подключено только к созданию подписки: большой импорт с ключом не буферизуется и не получает 413
+func TestIdempotencyRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := &fakeIdempotencyKeys{keys: make(map[string]*repository.IdempotencyRecord)}
+	router := (&Handler{idempotencyService: service.NewIdempotencyService(keys, time.Hour)}).InitRoutes()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/subscriptions", http.StatusRequestEntityTooLarge},
+		{"/api/v1/subscriptions/import", http.StatusBadRequest}, // первая строка - не заголовок с нужными колонками
+	}
+	body := bytes.Repeat([]byte("a"), maxIdempotentBodySize+1)
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("POST %s: %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package rest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+const (
+	importChunkSize = 500
+	maxImportRows   = 10000
+)
+
+// поля подписки, которые читаются из CSV; по умолчанию колонка называется так же, как поле
+var importColumns = []string{"service_name", "price", "user_id", "start_date", "end_date"}
+
+// importSubscriptions импортирует подписки из CSV (тело запроса или multipart-поле file).
+// Файл читается потоково и проверяется порциями по importChunkSize строк; подписки записываются
+// одной транзакцией только после того, как прочитан и проверен весь файл
+func (h *Handler) importSubscriptions(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	var defaultUserID *uuid.UUID
+	if u := c.Query("user_id"); u != "" {
+		id, err := uuid.Parse(u)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		defaultUserID = &id
+	}
+
+	policy, err := parseOverlapPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, closeBody, err := importBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer closeBody()
+
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	if d := c.Query("delimiter"); d != "" {
+		delim, size := utf8.DecodeRuneInString(d)
+		if size != len(d) || delim == '"' || delim == '\r' || delim == '\n' {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delimiter"})
+			return
+		}
+		r.Comma = delim
+	}
+
+	header, err := r.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read csv header"})
+		return
+	}
+	columns, err := resolveImportColumns(header, c.QueryMap("columns"), defaultUserID != nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	im := h.service.NewImporter(dryRun, policy)
+	chunk := make([]service.ImportRow, 0, importChunkSize)
+	flush := func() bool {
+		if len(chunk) == 0 {
+			return true
+		}
+		if err := im.Add(c.Request.Context(), chunk); err != nil {
+			slog.Error("failed to check imported subscriptions", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return false
+		}
+		chunk = chunk[:0]
+		return true
+	}
+
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if line-1 > maxImportRows {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("too many rows, max %d", maxImportRows)})
+			return
+		}
+
+		row := service.ImportRow{Line: line}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read csv"})
+				return
+			}
+			row.Err = parseErr.Err
+		} else {
+			row.Subscription, row.Err = parseImportRecord(record, columns, defaultUserID)
+		}
+
+		chunk = append(chunk, row)
+		if len(chunk) == importChunkSize && !flush() {
+			return
+		}
+	}
+	if !flush() {
+		return
+	}
+	err = im.Commit(c.Request.Context())
+	if errors.Is(err, service.ErrImportRejected) {
+		c.JSON(http.StatusConflict, toImportResponse(im.Report))
+		return
+	}
+	var lineErr *service.ImportLineError
+	if errors.As(err, &lineErr) {
+		slog.Error("failed to import subscriptions", "line", lineErr.Line, "error", lineErr.Err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error", "line": lineErr.Line})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to import subscriptions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	status := http.StatusOK
+	if !dryRun && im.Report.Created > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, toImportResponse(im.Report))
+}
+
+// importBody возвращает CSV из multipart-поля file или из тела запроса
+func importBody(c *gin.Context) (io.Reader, func(), error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, nil, errors.New("file is required")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, nil, errors.New("failed to open file")
+		}
+		return f, func() { f.Close() }, nil
+	}
+	return c.Request.Body, func() {}, nil
+}
+
+// resolveImportColumns находит индексы колонок. mapping: поле -> имя колонки в файле (columns[price]=Amount)
+func resolveImportColumns(header []string, mapping map[string]string, hasDefaultUser bool) (map[string]int, error) {
+	for field := range mapping {
+		if !slices.Contains(importColumns, field) {
+			return nil, fmt.Errorf("unknown field in columns mapping: %s", field)
+		}
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i // BOM от Excel
+	}
+
+	columns := make(map[string]int)
+	for _, field := range importColumns {
+		name := field
+		if m, ok := mapping[field]; ok {
+			name = m
+		}
+		if i, ok := index[name]; ok {
+			columns[field] = i
+			continue
+		}
+		optional := field == "end_date" || (field == "user_id" && hasDefaultUser)
+		if !optional {
+			return nil, fmt.Errorf("column %q for %s not found in header", name, field)
+		}
+	}
+	return columns, nil
+}
+
+func parseImportRecord(record []string, columns map[string]int, defaultUserID *uuid.UUID) (*domain.Subscription, error) {
+	get := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	sub := &domain.Subscription{ServiceName: get("service_name")}
+	if sub.ServiceName == "" {
+		return nil, errors.New("service_name is required")
+	}
+
+	price, err := parseImportPrice(get("price"))
+	if err != nil {
+		return nil, err
+	}
+	sub.Price = price
+
+	if u := get("user_id"); u != "" {
+		id, err := uuid.Parse(u)
+		if err != nil {
+			return nil, errors.New("invalid user_id")
+		}
+		sub.UserID = id
+	} else if defaultUserID != nil {
+		sub.UserID = *defaultUserID
+	} else {
+		return nil, errors.New("user_id is required")
+	}
+
+	start, ok := service.ParseImportDate(get("start_date"))
+	if !ok {
+		return nil, errors.New("invalid start_date, expected MM-YYYY or YYYY-MM-DD")
+	}
+	sub.StartDate = start
+
+	if e := get("end_date"); e != "" {
+		end, ok := service.ParseImportDate(e)
+		if !ok {
+			return nil, errors.New("invalid end_date, expected MM-YYYY or YYYY-MM-DD")
+		}
+		sub.EndDate = &end
+	}
+	sub.AutoRenew = autoRenewOrDefault(nil, sub.EndDate)
+	if err := validateSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// parseImportPrice принимает целое число или сумму с копейками (399.00, 399,00) и округляет до рублей
+func parseImportPrice(s string) (int, error) {
+	if v, err := strconv.Atoi(s); err == nil && v >= 0 {
+		return v, nil
+	}
+	f, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	// границы проверяются до перевода в int: у 1e30 результат преобразования не определен
+	if err != nil || math.IsNaN(f) || f < 0 || math.Round(f) > maxPrice {
+		return 0, errors.New("invalid price")
+	}
+	return int(math.Round(f)), nil
+}
@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseImportPrice(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"399", 399, false},
+		{"0", 0, false},
+		{"399.00", 399, false},
+		{"399,50", 400, false},
+		{"2147483647", maxPrice, false},
+		{"2147483647.4", maxPrice, false},
+		{"2147483647.5", 0, true},
+		{"1e30", 0, true},
+		{"-1", 0, true},
+		{"-0.5", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseImportPrice(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportPrice(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseImportPrice(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveImportColumns(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      []string
+		mapping     map[string]string
+		defaultUser bool
+		want        map[string]int
+		wantErr     bool
+	}{
+		{
+			name:   "all columns",
+			header: []string{"user_id", "service_name", "price", "start_date", "end_date"},
+			want:   map[string]int{"user_id": 0, "service_name": 1, "price": 2, "start_date": 3, "end_date": 4},
+		},
+		{
+			name:   "bom and spaces, no end_date",
+			header: []string{"\ufeffservice_name", " price ", "user_id", "start_date"},
+			want:   map[string]int{"service_name": 0, "price": 1, "user_id": 2, "start_date": 3},
+		},
+		{
+			name:    "mapping",
+			header:  []string{"Service", "Amount", "User", "From"},
+			mapping: map[string]string{"service_name": "Service", "price": "Amount", "user_id": "User", "start_date": "From"},
+			want:    map[string]int{"service_name": 0, "price": 1, "user_id": 2, "start_date": 3},
+		},
+		{
+			name:        "user_id optional with default user",
+			header:      []string{"service_name", "price", "start_date"},
+			defaultUser: true,
+			want:        map[string]int{"service_name": 0, "price": 1, "start_date": 2},
+		},
+		{
+			name:    "missing user_id",
+			header:  []string{"service_name", "price", "start_date"},
+			wantErr: true,
+		},
+		{
+			name:    "mapped column not in header",
+			header:  []string{"service_name", "price", "user_id", "start_date"},
+			mapping: map[string]string{"price": "Amount"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field in mapping",
+			header:  []string{"service_name", "price", "user_id", "start_date"},
+			mapping: map[string]string{"cost": "price"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveImportColumns(tt.header, tt.mapping, tt.defaultUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveImportColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("resolveImportColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportRecord(t *testing.T) {
+	columns := map[string]int{"service_name": 0, "price": 1, "user_id": 2, "start_date": 3, "end_date": 4}
+	user := uuid.New()
+	defaultUser := uuid.New()
+	jul := time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC)
+	dec := time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		record        []string
+		defaultUser   *uuid.UUID
+		wantUser      uuid.UUID
+		wantPrice     int
+		wantEnd       *time.Time
+		wantAutoRenew bool
+		wantErr       bool
+	}{
+		{"open-ended", []string{"Netflix", "399", user.String(), "07-2025", ""}, nil, user, 399, nil, true, false},
+		{"with end_date", []string{" Netflix ", "399,50", user.String(), "2025-07-15", "2025-12"}, nil, user, 400, &dec, false, false},
+		{"short record", []string{"Netflix", "399", user.String(), "07-2025"}, nil, user, 399, nil, true, false},
+		{"default user", []string{"Netflix", "399", "", "07-2025", ""}, &defaultUser, defaultUser, 399, nil, true, false},
+		{"user_id wins over default", []string{"Netflix", "399", user.String(), "07-2025", ""}, &defaultUser, user, 399, nil, true, false},
+		{"no user", []string{"Netflix", "399", "", "07-2025", ""}, nil, uuid.Nil, 0, nil, false, true},
+		{"invalid user", []string{"Netflix", "399", "abc", "07-2025", ""}, nil, uuid.Nil, 0, nil, false, true},
+		{"no service", []string{"", "399", user.String(), "07-2025", ""}, nil, uuid.Nil, 0, nil, false, true},
+		{"invalid price", []string{"Netflix", "-1", user.String(), "07-2025", ""}, nil, uuid.Nil, 0, nil, false, true},
+		{"invalid start", []string{"Netflix", "399", user.String(), "2025/07", ""}, nil, uuid.Nil, 0, nil, false, true},
+		{"invalid end", []string{"Netflix", "399", user.String(), "07-2025", "soon"}, nil, uuid.Nil, 0, nil, false, true},
+		{"end before start", []string{"Netflix", "399", user.String(), "07-2025", "06-2025"}, nil, uuid.Nil, 0, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImportRecord(tt.record, columns, tt.defaultUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.ServiceName != "Netflix" || got.UserID != tt.wantUser || got.Price != tt.wantPrice || !got.StartDate.Equal(jul) {
+				t.Errorf("parseImportRecord() = %+v", got)
+			}
+			if (got.EndDate == nil) != (tt.wantEnd == nil) || (got.EndDate != nil && !got.EndDate.Equal(*tt.wantEnd)) {
+				t.Errorf("end_date = %v, want %v", got.EndDate, tt.wantEnd)
+			}
+			if got.AutoRenew != tt.wantAutoRenew {
+				t.Errorf("auto_renew = %v, want %v", got.AutoRenew, tt.wantAutoRenew)
+			}
+		})
+	}
+}
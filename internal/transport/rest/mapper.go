@@ -1,9 +1,15 @@
 package rest
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
 )
 
 func toMonthYear(t time.Time) string {
@@ -26,5 +32,482 @@ func toSubscriptionResponse(s *domain.Subscription) SubscriptionResponse {
 		Price:       s.Price,
 		StartDate:   toMonthYear(s.StartDate),
 		EndDate:     toMonthYearPtr(s.EndDate),
+		CreatedAt:   s.CreatedAt.Format(time.RFC3339),
+		Plan:        s.Plan,
+		PreviousID:  toUUIDStringPtr(s.PreviousID),
+		AutoRenew:   s.AutoRenew,
+		CanceledAt:  toRFC3339Ptr(s.CanceledAt),
 	}
 }
+
+func toRFC3339Ptr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+func toUUIDStringPtr(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
+
+func toSubscriptionResponses(items []domain.Subscription) []SubscriptionResponse {
+	resp := make([]SubscriptionResponse, 0, len(items))
+	for i := range items {
+		resp = append(resp, toSubscriptionResponse(&items[i]))
+	}
+	return resp
+}
+
+// toSubscription проверяет и переводит тело запроса изменения подписки в доменную модель
+func toSubscription(id uuid.UUID, req UpdateSubscriptionRequest) (*domain.Subscription, error) {
+	if req.ServiceName == "" {
+		return nil, errors.New("service_name is required")
+	}
+
+	startDate, err := time.Parse(MonthYearLayout, req.StartDate)
+	if err != nil {
+		return nil, errors.New("invalid start_date format, expected MM-YYYY")
+	}
+
+	var endDate *time.Time
+	if req.EndDate != nil {
+		ed, err := time.Parse(MonthYearLayout, *req.EndDate)
+		if err != nil {
+			return nil, errors.New("invalid end_date format, expected MM-YYYY")
+		}
+		endDate = &ed
+	}
+
+	userUUID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, errors.New("invalid user_id")
+	}
+
+	if req.Price == nil {
+		return nil, errors.New("price is required")
+	}
+
+	sub := &domain.Subscription{
+		ID:          id,
+		UserID:      userUUID,
+		ServiceName: req.ServiceName,
+		Price:       *req.Price,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Plan:        req.Plan,
+		AutoRenew:   autoRenewOrDefault(req.AutoRenew, endDate),
+	}
+	if err := validateSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// maxPrice - price хранится в колонке INTEGER
+const maxPrice = math.MaxInt32
+
+// validatePrice - допустимая цена подписки: бесплатные (0) разрешены, отрицательные нет
+func validatePrice(price int) error {
+	if price < 0 || price > maxPrice {
+		return fmt.Errorf("price must be between 0 and %d", maxPrice)
+	}
+	return nil
+}
+
+// validateSubscription - общие правила для подписки из одиночного запроса, bulk и импорта
+func validateSubscription(sub *domain.Subscription) error {
+	if err := validatePrice(sub.Price); err != nil {
+		return err
+	}
+	if sub.EndDate != nil && sub.EndDate.Before(sub.StartDate) {
+		return errors.New("end_date is before start_date")
+	}
+	return nil
+}
+
+// autoRenewOrDefault - по умолчанию продлевается только бессрочная подписка
+func autoRenewOrDefault(autoRenew *bool, endDate *time.Time) bool {
+	if autoRenew != nil {
+		return *autoRenew
+	}
+	return endDate == nil
+}
+
+func toRetentionResponse(cohorts []service.RetentionCohort) RetentionResponse {
+	resp := RetentionResponse{Cohorts: make([]RetentionCohortResponse, 0, len(cohorts))}
+	for _, c := range cohorts {
+		resp.Cohorts = append(resp.Cohorts, RetentionCohortResponse{
+			Cohort:    toMonthYear(c.Month),
+			Size:      c.Size,
+			Retention: c.Retention,
+		})
+	}
+	return resp
+}
+
+func toForecastResponse(months []service.MonthForecast) ForecastResponse {
+	resp := ForecastResponse{Months: make([]MonthForecastResponse, 0, len(months))}
+	for _, m := range months {
+		mr := MonthForecastResponse{
+			Month:     toMonthYear(m.Month),
+			Committed: m.Committed,
+			Projected: m.Projected,
+			Total:     m.Committed + m.Projected,
+			Services:  make([]ServiceForecastResponse, 0, len(m.Services)),
+		}
+		for _, sf := range m.Services {
+			mr.Services = append(mr.Services, ServiceForecastResponse{
+				ServiceName: sf.ServiceName,
+				Committed:   sf.Committed,
+				Projected:   sf.Projected,
+				Total:       sf.Committed + sf.Projected,
+			})
+		}
+		resp.Committed += m.Committed
+		resp.Projected += m.Projected
+		resp.Months = append(resp.Months, mr)
+	}
+	resp.Total = resp.Committed + resp.Projected
+	return resp
+}
+
+func toTotalQuery(req TotalQueryRequest) (service.TotalQuery, error) {
+	var q service.TotalQuery
+	from, err := time.Parse(MonthYearLayout, req.From)
+	if err != nil {
+		return q, errors.New("invalid from format, expected MM-YYYY")
+	}
+	to, err := time.Parse(MonthYearLayout, req.To)
+	if err != nil {
+		return q, errors.New("invalid to format, expected MM-YYYY")
+	}
+
+	values, err := filterValues(req.Filter)
+	if err != nil {
+		return q, err
+	}
+	filter, err := parseFilterValues(values)
+	if err != nil {
+		return q, err
+	}
+
+	return service.TotalQuery{Filter: filter, From: from, To: to}, nil
+}
+
+func toTotalExplainResponse(total int, lines []service.CostLine) TotalExplainResponse {
+	resp := TotalExplainResponse{Total: total, Items: make([]CostLineResponse, 0, len(lines))}
+	for _, l := range lines {
+		resp.Items = append(resp.Items, CostLineResponse{
+			SubscriptionID: l.Subscription.ID.String(),
+			UserID:         l.Subscription.UserID.String(),
+			ServiceName:    l.Subscription.ServiceName,
+			Plan:           l.Subscription.Plan,
+			PreviousID:     toUUIDStringPtr(l.Subscription.PreviousID),
+			From:           toMonthYear(l.Left),
+			To:             toMonthYear(l.Right),
+			Months:         l.Months,
+			Price:          l.Subscription.Price,
+			Amount:         l.Amount,
+		})
+	}
+	return resp
+}
+
+func toTotalDeltaResponse(d service.TotalDelta) TotalDeltaResponse {
+	return TotalDeltaResponse{
+		Current:       d.Current,
+		Baseline:      d.Baseline,
+		Change:        d.Change,
+		ChangePercent: d.ChangePercent,
+	}
+}
+
+func toTotalComparisonResponse(cmp *service.TotalComparison) TotalComparisonResponse {
+	resp := TotalComparisonResponse{
+		TotalDeltaResponse: toTotalDeltaResponse(cmp.TotalDelta),
+		Services:           make([]ServiceDeltaResponse, 0, len(cmp.Services)),
+	}
+	for _, sd := range cmp.Services {
+		resp.Services = append(resp.Services, ServiceDeltaResponse{
+			ServiceName:        sd.ServiceName,
+			TotalDeltaResponse: toTotalDeltaResponse(sd.TotalDelta),
+		})
+	}
+	return resp
+}
+
+func toImportResponse(r service.ImportReport) ImportResponse {
+	resp := ImportResponse{
+		DryRun:     r.DryRun,
+		Total:      r.Total,
+		Created:    r.Created,
+		Duplicates: r.Duplicates,
+		Invalid:    r.Invalid,
+		Rejected:   r.Rejected,
+		Rows:       make([]ImportRowResponse, 0, len(r.Rows)),
+	}
+	for _, row := range r.Rows {
+		rr := ImportRowResponse{Line: row.Line, Status: string(row.Status), Error: row.Error}
+		if row.ID != uuid.Nil {
+			rr.ID = row.ID.String()
+		}
+		for _, id := range row.Overlaps {
+			rr.Overlaps = append(rr.Overlaps, id.String())
+		}
+		resp.Rows = append(resp.Rows, rr)
+	}
+	return resp
+}
+
+func toDuplicateResponses(dups []service.Duplicate) []DuplicateResponse {
+	resp := make([]DuplicateResponse, 0, len(dups))
+	for _, d := range dups {
+		resp = append(resp, DuplicateResponse{
+			Subscriptions: []SubscriptionResponse{toSubscriptionResponse(&d.First), toSubscriptionResponse(&d.Second)},
+			OverlapFrom:   toMonthYear(d.OverlapFrom),
+			OverlapTo:     toMonthYearPtr(d.OverlapTo),
+			OverlapMonths: d.OverlapMonths,
+		})
+	}
+	return resp
+}
+
+func toHistoryResponses(entries []repository.HistoryEntry) []HistoryEntryResponse {
+	resp := make([]HistoryEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		r := HistoryEntryResponse{
+			ID:         e.ID,
+			Action:     string(e.Action),
+			RelatedIDs: make([]string, 0, len(e.RelatedIDs)),
+			CreatedAt:  e.CreatedAt.Format(time.RFC3339),
+		}
+		for _, id := range e.RelatedIDs {
+			r.RelatedIDs = append(r.RelatedIDs, id.String())
+		}
+		if e.Before != nil {
+			before := toSubscriptionResponse(e.Before)
+			r.Before = &before
+		}
+		if e.After != nil {
+			after := toSubscriptionResponse(e.After)
+			r.After = &after
+		}
+		resp = append(resp, r)
+	}
+	return resp
+}
+
+func toMRRResponse(movements []service.MRRMovement) MRRResponse {
+	resp := MRRResponse{Months: make([]MRRMonthResponse, 0, len(movements))}
+	for _, m := range movements {
+		resp.Months = append(resp.Months, MRRMonthResponse{
+			Month:       toMonthYear(m.Month),
+			MRR:         m.MRR,
+			New:         m.New,
+			Expansion:   m.Expansion,
+			Contraction: m.Contraction,
+			Churn:       m.Churn,
+			Net:         m.Net,
+		})
+	}
+	return resp
+}
+
+func toUpcomingChargesResponse(userID uuid.UUID, now time.Time, days int, charges []service.UpcomingCharge) UpcomingChargesResponse {
+	resp := UpcomingChargesResponse{
+		UserID:  userID.String(),
+		From:    now.Format(time.DateOnly),
+		To:      now.AddDate(0, 0, days-1).Format(time.DateOnly),
+		Charges: make([]UpcomingChargeResponse, 0, len(charges)),
+	}
+	for _, ch := range charges {
+		resp.Total += ch.Amount
+		resp.Charges = append(resp.Charges, UpcomingChargeResponse{
+			Date:           ch.Date.Format(time.DateOnly),
+			SubscriptionID: ch.Subscription.ID.String(),
+			ServiceName:    ch.Subscription.ServiceName,
+			Plan:           ch.Subscription.Plan,
+			Amount:         ch.Amount,
+			Renewal:        ch.Renewal,
+		})
+	}
+	return resp
+}
+
+func toUserSummaryResponse(userID uuid.UUID, s *service.UserSummary) UserSummaryResponse {
+	resp := UserSummaryResponse{
+		UserID:              userID.String(),
+		Month:               toMonthYear(s.Month),
+		ActiveSubscriptions: s.ActiveCount,
+		MonthlySpend:        s.MonthlySpend,
+		YearSpend:           s.YearSpend,
+		LifetimeSpend:       s.LifetimeSpend,
+		TopServices:         make([]ServiceSpendResponse, 0, len(s.TopServices)),
+		UpcomingEnds:        toSubscriptionResponses(s.UpcomingEnds),
+	}
+	for _, ts := range s.TopServices {
+		resp.TopServices = append(resp.TopServices, ServiceSpendResponse{
+			ServiceName:   ts.ServiceName,
+			MonthlySpend:  ts.MonthlySpend,
+			Subscriptions: ts.Subscriptions,
+		})
+	}
+	return resp
+}
+
+func toBudgetResponse(st service.BudgetStatus) BudgetResponse {
+	b := st.Budget
+	reached := st.Reached
+	if reached == nil {
+		reached = []int{}
+	}
+	return BudgetResponse{
+		ID:           b.ID.String(),
+		UserID:       b.UserID.String(),
+		ServiceName:  b.ServiceName,
+		MonthlyLimit: b.MonthlyLimit,
+		Thresholds:   b.Thresholds,
+		CreatedAt:    b.CreatedAt.Format(time.RFC3339),
+		Month:        toMonthYear(st.Month),
+		Spend:        st.Spend,
+		Percent:      st.Percent,
+		Reached:      reached,
+	}
+}
+
+func toBudgetAlertResponses(alerts []domain.BudgetAlert) []BudgetAlertResponse {
+	resp := make([]BudgetAlertResponse, 0, len(alerts))
+	for _, a := range alerts {
+		resp = append(resp, BudgetAlertResponse{
+			ID:           a.ID,
+			BudgetID:     a.BudgetID.String(),
+			UserID:       a.UserID.String(),
+			ServiceName:  a.ServiceName,
+			Month:        toMonthYear(a.Month),
+			Threshold:    a.Threshold,
+			Spend:        a.Spend,
+			MonthlyLimit: a.MonthlyLimit,
+			CreatedAt:    a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return resp
+}
+
+func toAnomalyResponses(anomalies []domain.Anomaly) []AnomalyResponse {
+	resp := make([]AnomalyResponse, 0, len(anomalies))
+	for _, a := range anomalies {
+		resp = append(resp, AnomalyResponse{
+			ID:        a.ID,
+			UserID:    a.UserID.String(),
+			Month:     toMonthYear(a.Month),
+			Rule:      a.Rule,
+			Spend:     a.Spend,
+			Baseline:  math.Round(a.Baseline*100) / 100,
+			Score:     math.Round(a.Score*100) / 100,
+			CreatedAt: a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return resp
+}
+
+func toSimulationChange(req SimulationChangeRequest) (service.SimulationChange, error) {
+	ch := service.SimulationChange{Type: service.SimulationChangeType(req.Type), ServiceName: req.ServiceName}
+
+	switch ch.Type {
+	case service.SimulateCancel, service.SimulateReprice:
+		id, err := uuid.Parse(req.SubscriptionID)
+		if err != nil {
+			return ch, errors.New("invalid subscription_id")
+		}
+		ch.SubscriptionID = id
+	case service.SimulateAdd:
+		if req.UserID != "" {
+			userID, err := uuid.Parse(req.UserID)
+			if err != nil {
+				return ch, errors.New("invalid user_id")
+			}
+			ch.UserID = userID
+		}
+	default:
+		return ch, errors.New("invalid type, expected cancel, add or reprice")
+	}
+
+	if ch.Type != service.SimulateCancel {
+		if req.Price == nil {
+			return ch, errors.New("price is required")
+		}
+		if err := validatePrice(*req.Price); err != nil {
+			return ch, err
+		}
+		ch.Price = *req.Price
+	}
+	if req.EffectiveFrom != nil {
+		t, err := time.Parse(MonthYearLayout, *req.EffectiveFrom)
+		if err != nil {
+			return ch, errors.New("invalid effective_from format, expected MM-YYYY")
+		}
+		ch.EffectiveFrom = &t
+	}
+	if req.EndDate != nil {
+		t, err := time.Parse(MonthYearLayout, *req.EndDate)
+		if err != nil {
+			return ch, errors.New("invalid end_date format, expected MM-YYYY")
+		}
+		ch.EndDate = &t
+	}
+	return ch, nil
+}
+
+func toSimulationResponse(sim *service.Simulation) SimulationResponse {
+	resp := SimulationResponse{
+		Baseline:  sim.Baseline,
+		Simulated: sim.Simulated,
+		Change:    sim.Simulated - sim.Baseline,
+		Lines:     make([]SimulationLineResponse, 0, len(sim.Lines)),
+	}
+	for _, l := range sim.Lines {
+		resp.Lines = append(resp.Lines, SimulationLineResponse{
+			SubscriptionID: toUUIDStringPtr(l.SubscriptionID),
+			ServiceName:    l.ServiceName,
+			Baseline:       l.Baseline,
+			Simulated:      l.Simulated,
+		})
+	}
+	return resp
+}
+
+func toWebhookResponse(w *domain.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:         w.ID.String(),
+		URL:        w.URL,
+		EventTypes: w.EventTypes,
+		Active:     w.Active,
+		CreatedAt:  w.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toWebhookDeliveryResponse(d *domain.WebhookDelivery) WebhookDeliveryResponse {
+	resp := WebhookDeliveryResponse{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID.String(),
+		EventID:        d.EventID.String(),
+		EventType:      d.EventType,
+		SubscriptionID: d.SubscriptionID.String(),
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt.Format(time.RFC3339),
+		DeliveredAt:    toRFC3339Ptr(d.DeliveredAt),
+	}
+	if d.Status == repository.DeliveryPending {
+		resp.NextAttemptAt = toRFC3339Ptr(&d.NextAttemptAt)
+	}
+	return resp
+}
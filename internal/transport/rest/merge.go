@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+func (h *Handler) mergeSubscriptions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req MergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input := service.MergeInput{Price: req.Price}
+	for _, s := range req.MergeIDs {
+		sourceID, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid merge_ids"})
+			return
+		}
+		input.SourceIDs = append(input.SourceIDs, sourceID)
+	}
+	if req.Price != nil {
+		if err := validatePrice(*req.Price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	merged, err := h.service.Merge(c.Request.Context(), id, input)
+	switch {
+	case errors.Is(err, service.ErrMergeIDs):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMergeMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case err != nil:
+		slog.Error("failed to merge subscriptions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSubscriptionResponse(merged))
+}
+
+func (h *Handler) splitSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req SplitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	month, err := time.Parse(MonthYearLayout, req.Month)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid month format, expected MM-YYYY"})
+		return
+	}
+	if req.Price != nil {
+		if err := validatePrice(*req.Price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	first, second, err := h.service.Split(c.Request.Context(), id, service.SplitInput{Month: month, Price: req.Price})
+	switch {
+	case errors.Is(err, service.ErrInvalidSplit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case err != nil:
+		slog.Error("failed to split subscription", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SplitResponse{
+		First:  toSubscriptionResponse(first),
+		Second: toSubscriptionResponse(second),
+	})
+}
+
+func (h *Handler) subscriptionHistory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	entries, err := h.service.History(c.Request.Context(), id)
+	if err != nil {
+		slog.Error("failed to get subscription history", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toHistoryResponses(entries))
+}
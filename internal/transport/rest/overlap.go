@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+// в заголовке перечисляются id подписок, с которыми пересекается сохраненная (политика warn)
+const overlapsHeader = "X-Subscription-Overlaps"
+
+// parseOverlapPolicy читает ?overlap=reject|warn|allow. Пустая политика - политика сервиса по умолчанию
+func parseOverlapPolicy(c *gin.Context) (service.OverlapPolicy, error) {
+	s := c.Query("overlap")
+	if s == "" {
+		return "", nil
+	}
+	policy, ok := service.ParseOverlapPolicy(s)
+	if !ok {
+		return "", errors.New("invalid overlap, expected reject, warn or allow")
+	}
+	return policy, nil
+}
+
+// writeOverlapError отвечает 409, если подписка отклонена политикой reject
+func writeOverlapError(c *gin.Context, err error) bool {
+	var overlapErr *service.OverlapError
+	if !errors.As(err, &overlapErr) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": overlapErr.Error(), "overlaps": overlapIDs(overlapErr.Overlaps)})
+	return true
+}
+
+func setOverlapHeader(c *gin.Context, overlaps []domain.Subscription) {
+	if len(overlaps) > 0 {
+		c.Header(overlapsHeader, strings.Join(overlapIDs(overlaps), ","))
+	}
+}
+
+func overlapIDs(overlaps []domain.Subscription) []string {
+	ids := make([]string, 0, len(overlaps))
+	for _, o := range overlaps {
+		ids = append(ids, o.ID.String())
+	}
+	return ids
+}
+
+func (h *Handler) duplicates(c *gin.Context) {
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dups, err := h.service.FindDuplicates(c.Request.Context(), filter)
+	if err != nil {
+		slog.Error("failed to find duplicate subscriptions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toDuplicateResponses(dups))
+}
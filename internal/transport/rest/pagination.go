@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+// cursorPayload - содержимое курсора. Для клиента курсор непрозрачен (base64 от json).
+// Sort хранится, чтобы курсор нельзя было применить к листингу с другой сортировкой
+type cursorPayload struct {
+	Sort   string    `json:"k"`
+	Values []string  `json:"v"`
+	ID     uuid.UUID `json:"i"`
+}
+
+var (
+	errInvalidCursor      = errors.New("invalid cursor")
+	errCursorSortMismatch = errors.New("cursor was issued for a different sort")
+)
+
+func encodeCursor(sort []repository.SortKey, c *repository.Cursor) string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(cursorPayload{
+		Sort:   formatSort(sort),
+		Values: c.Values,
+		ID:     c.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string, sort []repository.SortKey) (*repository.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var p cursorPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, errInvalidCursor
+	}
+	if p.Sort != formatSort(sort) || len(p.Values) != len(sort) {
+		return nil, errCursorSortMismatch
+	}
+	return &repository.Cursor{Values: p.Values, ID: p.ID}, nil
+}
+
+// parseSort разбирает sort=-start_date,service_name: поля из белого списка, "-" - по убыванию.
+// Пустая строка - порядок по умолчанию
+func parseSort(s string) ([]repository.SortKey, error) {
+	if s == "" {
+		return repository.DefaultSort, nil
+	}
+	var keys []repository.SortKey
+	seen := make(map[repository.SortField]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		desc := false
+		if strings.HasPrefix(part, "-") {
+			desc = true
+			part = part[1:]
+		} else {
+			part = strings.TrimPrefix(part, "+")
+		}
+		field, ok := repository.ParseSortField(part)
+		if !ok {
+			return nil, fmt.Errorf("invalid sort field %q", part)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("duplicate sort field %q", part)
+		}
+		seen[field] = true
+		keys = append(keys, repository.SortKey{Field: field, Desc: desc})
+	}
+	return keys, nil
+}
+
+func formatSort(keys []repository.SortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = string(k.Field)
+		if k.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// pageLinks строит навигационные ссылки на основе текущего запроса (фильтры сохраняются).
+// next всегда ведет по курсору, prev есть только в режиме offset
+func pageLinks(c *gin.Context, page repository.Page, next *repository.Cursor) PageLinks {
+	link := func(set map[string]string, drop ...string) string {
+		q := c.Request.URL.Query()
+		for _, k := range drop {
+			q.Del(k)
+		}
+		for k, v := range set {
+			q.Set(k, v)
+		}
+		u := url.URL{Path: c.Request.URL.Path, RawQuery: q.Encode()}
+		return u.String()
+	}
+
+	links := PageLinks{
+		Self:  link(nil),
+		First: link(nil, "cursor", "offset"),
+	}
+	if next != nil {
+		n := link(map[string]string{"cursor": encodeCursor(page.Sort, next)}, "offset")
+		links.Next = &n
+	}
+	if page.After == nil && page.Offset > 0 {
+		prevOffset := max(page.Offset-page.Limit, 0)
+		p := link(map[string]string{"offset": strconv.Itoa(prevOffset)})
+		links.Prev = &p
+	}
+	return links
+}
@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	byPrice := []repository.SortKey{{Field: repository.SortPrice, Desc: true}}
+	tests := []struct {
+		name   string
+		sort   []repository.SortKey
+		cursor *repository.Cursor
+	}{
+		{"default sort", repository.DefaultSort, &repository.Cursor{Values: []string{"2025-07-01", "Netflix"}, ID: uuid.New()}},
+		{"single key", byPrice, &repository.Cursor{Values: []string{"400"}, ID: uuid.New()}},
+		{"special characters", byPrice, &repository.Cursor{Values: []string{`"Яндекс, Плюс"/+=`}, ID: uuid.New()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(encodeCursor(tt.sort, tt.cursor), tt.sort)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.cursor) {
+				t.Errorf("decodeCursor() = %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	cursor := &repository.Cursor{Values: []string{"2025-07-01", "Netflix"}, ID: uuid.New()}
+	valid := encodeCursor(repository.DefaultSort, cursor)
+
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    []repository.SortKey
+		wantErr error
+	}{
+		{"not base64", "!!!", repository.DefaultSort, errInvalidCursor},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("not json")), repository.DefaultSort, errInvalidCursor},
+		{"other sort", valid, []repository.SortKey{{Field: repository.SortStartDate}, {Field: repository.SortServiceName}}, errCursorSortMismatch},
+		{"values do not match sort", base64.RawURLEncoding.EncodeToString([]byte(`{"k":"-start_date,service_name","v":["2025-07-01"]}`)), repository.DefaultSort, errCursorSortMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor, tt.sort); !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeCursor() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncodeNilCursor(t *testing.T) {
+	if got := encodeCursor(repository.DefaultSort, nil); got != "" {
+		t.Errorf("encodeCursor(nil) = %q, want empty", got)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []repository.SortKey
+		wantErr bool
+	}{
+		{"", repository.DefaultSort, false},
+		{"price", []repository.SortKey{{Field: repository.SortPrice}}, false},
+		{"-start_date, +service_name", []repository.SortKey{{Field: repository.SortStartDate, Desc: true}, {Field: repository.SortServiceName}}, false},
+		{"user_id", nil, true},
+		{"price,-price", nil, true},
+		{"price,", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSort(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSort() = %+v, want %+v", got, tt.want)
+			}
+			if !tt.wantErr && tt.in != "" && formatSort(got) != strings.ReplaceAll(strings.ReplaceAll(tt.in, " ", ""), "+", "") {
+				t.Errorf("formatSort() = %q, want it to round-trip %q", formatSort(got), tt.in)
+			}
+		})
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	next := &repository.Cursor{Values: []string{"2025-07-01", "Netflix"}, ID: uuid.New()}
+	cursor := encodeCursor(repository.DefaultSort, next)
+
+	tests := []struct {
+		name     string
+		query    string
+		page     repository.Page
+		next     *repository.Cursor
+		wantPrev string
+		wantNext string
+	}{
+		{"last page", "service_name=Netflix&limit=10", repository.Page{Limit: 10, Sort: repository.DefaultSort}, nil, "", ""},
+		{"next by cursor keeps filters", "service_name=Netflix&limit=10", repository.Page{Limit: 10, Sort: repository.DefaultSort}, next, "",
+			"/api/v2/subscriptions?cursor=" + cursor + "&limit=10&service_name=Netflix"},
+		{"offset mode has prev", "limit=10&offset=15", repository.Page{Limit: 10, Offset: 15, Sort: repository.DefaultSort}, next,
+			"/api/v2/subscriptions?limit=10&offset=5", "/api/v2/subscriptions?cursor=" + cursor + "&limit=10"},
+		{"cursor mode has no prev", "limit=10&cursor=abc", repository.Page{Limit: 10, Offset: 15, Sort: repository.DefaultSort, After: next}, nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v2/subscriptions?"+tt.query, nil)
+
+			links := pageLinks(c, tt.page, tt.next)
+			if links.First == "" || strings.Contains(links.First, "cursor=") || strings.Contains(links.First, "offset=") {
+				t.Errorf("first = %q, want it without cursor and offset", links.First)
+			}
+			if got := deref(links.Prev); got != tt.wantPrev {
+				t.Errorf("prev = %q, want %q", got, tt.wantPrev)
+			}
+			if got := deref(links.Next); got != tt.wantNext {
+				t.Errorf("next = %q, want %q", got, tt.wantNext)
+			}
+		})
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
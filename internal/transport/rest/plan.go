@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+func (h *Handler) changePlan(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Price != nil {
+		if err := validatePrice(*req.Price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	effectiveFrom, err := time.Parse(MonthYearLayout, req.EffectiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid effective_from format, expected MM-YYYY"})
+		return
+	}
+
+	prev, next, err := h.service.ChangePlan(c.Request.Context(), id, service.ChangePlanInput{
+		Plan:          req.Plan,
+		Price:         req.Price,
+		EffectiveFrom: effectiveFrom,
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidPlanChange):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case err != nil:
+		slog.Error("failed to change plan", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ChangePlanResponse{
+		Previous: toSubscriptionResponse(prev),
+		Current:  toSubscriptionResponse(next),
+	})
+}
+
+func (h *Handler) mrrMovements(c *gin.Context) {
+	from, to, err := parsePeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	movements, err := h.service.MRRMovements(c.Request.Context(), filter, from, to)
+	if err != nil {
+		slog.Error("failed to calc mrr movements", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toMRRResponse(movements))
+}
+
+func (h *Handler) cancelSubscription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	// тело необязательно: без него подписка отменяется с конца текущего месяца
+	var req CancelRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var at *time.Time
+	if req.At != nil {
+		t, err := time.Parse(MonthYearLayout, *req.At)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at format, expected MM-YYYY"})
+			return
+		}
+		at = &t
+	}
+
+	sub, err := h.service.Cancel(c.Request.Context(), id, at)
+	switch {
+	case errors.Is(err, service.ErrCancelInPast), errors.Is(err, service.ErrCancelAfterEnd):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case err != nil:
+		slog.Error("failed to cancel subscription", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSubscriptionResponse(sub))
+}
@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+// simulateTotal считает итоговую сумму до и после гипотетических изменений, ничего не сохраняя
+func (h *Handler) simulateTotal(c *gin.Context) {
+	var req SimulateTotalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Changes) > service.MaxSimulationChanges {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrTooManyChanges.Error()})
+		return
+	}
+
+	query, err := toTotalQuery(req.TotalQueryRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	changes := make([]service.SimulationChange, 0, len(req.Changes))
+	for i, ch := range req.Changes {
+		change, err := toSimulationChange(ch)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("change %d: %s", i, err)})
+			return
+		}
+		changes = append(changes, change)
+	}
+
+	sim, err := h.service.SimulateTotal(c.Request.Context(), query, changes)
+	if errors.Is(err, service.ErrInvalidChange) || errors.Is(err, service.ErrSimulationSubNotFound) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to simulate total", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSimulationResponse(sim))
+}
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/domain"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+// fakeStore хранит подписки по id: Create не перезаписывает существующую, Update не создает новую
+type fakeStore struct {
+	repository.Subscriptions
+	subs map[uuid.UUID]domain.Subscription
+}
+
+func (f *fakeStore) Create(_ context.Context, sub *domain.Subscription, _ repository.OverlapCheck) error {
+	if _, ok := f.subs[sub.ID]; ok {
+		return repository.ErrConflict
+	}
+	f.subs[sub.ID] = *sub
+	return nil
+}
+
+func (f *fakeStore) Upsert(_ context.Context, sub *domain.Subscription, _ repository.OverlapCheck) (bool, error) {
+	_, exists := f.subs[sub.ID]
+	f.subs[sub.ID] = *sub
+	return !exists, nil
+}
+
+func (f *fakeStore) Update(_ context.Context, sub *domain.Subscription, _ repository.OverlapCheck) error {
+	if _, ok := f.subs[sub.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	f.subs[sub.ID] = *sub
+	return nil
+}
+
+func newStoreRouter(existing uuid.UUID) (*gin.Engine, *fakeStore) {
+	gin.SetMode(gin.TestMode)
+	repo := &fakeStore{subs: map[uuid.UUID]domain.Subscription{
+		existing: {ID: existing, ServiceName: "Netflix", Price: 399},
+	}}
+	return (&Handler{service: service.NewSubscriptionService(repo, service.OverlapAllow)}).InitRoutes(), repo
+}
+
+func TestCreateClientID(t *testing.T) {
+	existing := uuid.New()
+	clientID := uuid.New()
+	body := func(id string) string {
+		return `{"id":"` + id + `","service_name":"Kion","price":199,"user_id":"60601fee-2bf1-4721-ae6f-7636e79a0cba","start_date":"07-2025"}`
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		want   int
+		wantID uuid.UUID // uuid.Nil - id генерирует сервер
+	}{
+		{"generated id", "", http.StatusCreated, uuid.Nil},
+		{"client id", clientID.String(), http.StatusCreated, clientID},
+		{"taken id", existing.String(), http.StatusConflict, uuid.Nil},
+		{"invalid id", "42", http.StatusBadRequest, uuid.Nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, repo := newStoreRouter(existing)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body(tt.id))))
+			if w.Code != tt.want {
+				t.Fatalf("POST: %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if w.Code != http.StatusCreated {
+				if len(repo.subs) != 1 || repo.subs[existing].ServiceName != "Netflix" {
+					t.Errorf("store changed: %+v", repo.subs)
+				}
+				return
+			}
+
+			var resp struct{ ID uuid.UUID }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if tt.wantID != uuid.Nil && resp.ID != tt.wantID || resp.ID == uuid.Nil || resp.ID == existing {
+				t.Errorf("id = %s, want %s", resp.ID, tt.wantID)
+			}
+			if repo.subs[resp.ID].ServiceName != "Kion" {
+				t.Errorf("subscription %s not saved", resp.ID)
+			}
+		})
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	existing := uuid.New()
+	missing := uuid.New()
+	body := `{"service_name":"Kion","price":199,"user_id":"60601fee-2bf1-4721-ae6f-7636e79a0cba","start_date":"07-2025"}`
+
+	tests := []struct {
+		name      string
+		path      string
+		id        uuid.UUID
+		want      int
+		wantSaved bool
+	}{
+		{"create missing", "/api/v1/subscriptions/" + missing.String() + "?upsert=true", missing, http.StatusCreated, true},
+		{"replace existing", "/api/v1/subscriptions/" + existing.String() + "?upsert=true", existing, http.StatusNoContent, true},
+		{"update existing", "/api/v1/subscriptions/" + existing.String(), existing, http.StatusNoContent, true},
+		{"update missing without upsert", "/api/v1/subscriptions/" + missing.String(), missing, http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, repo := newStoreRouter(existing)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(body)))
+			if w.Code != tt.want {
+				t.Fatalf("PUT %s: %d, want %d: %s", tt.path, w.Code, tt.want, w.Body)
+			}
+			sub, ok := repo.subs[tt.id]
+			if saved := ok && sub.ServiceName == "Kion"; saved != tt.wantSaved {
+				t.Errorf("saved = %v, want %v", saved, tt.wantSaved)
+			}
+			if tt.want == http.StatusCreated && !strings.Contains(w.Body.String(), tt.id.String()) {
+				t.Errorf("body %s without id %s", w.Body, tt.id)
+			}
+		})
+	}
+}
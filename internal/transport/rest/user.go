@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+const defaultUpcomingChargeDays = 30
+
+func (h *Handler) upcomingCharges(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	days := defaultUpcomingChargeDays
+	if d := c.Query("days"); d != "" {
+		v, err := strconv.Atoi(d)
+		if err != nil || v < 1 || v > service.MaxUpcomingChargeDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days, expected 1.." + strconv.Itoa(service.MaxUpcomingChargeDays)})
+			return
+		}
+		days = v
+	}
+
+	now := time.Now().UTC()
+	charges, err := h.service.UpcomingCharges(c.Request.Context(), userID, now, days)
+	if err != nil {
+		slog.Error("failed to calc upcoming charges", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUpcomingChargesResponse(userID, now, days, charges))
+}
+
+func (h *Handler) userSummary(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	summary, err := h.service.UserSummary(c.Request.Context(), userID, time.Now().UTC())
+	if err != nil {
+		slog.Error("failed to build user summary", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUserSummaryResponse(userID, summary))
+}
@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wsppppp/data-aggregation/internal/repository"
+	"github.com/wsppppp/data-aggregation/internal/service"
+)
+
+func (h *Handler) createWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w, err := h.webhookService.Create(c.Request.Context(), toWebhookInput(req))
+	if writeWebhookError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	// секрет отдается один раз - при создании
+	resp := toWebhookResponse(w)
+	resp.Secret = w.Secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (h *Handler) listWebhooks(c *gin.Context) {
+	webhooks, err := h.webhookService.List(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list webhooks", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	resp := make([]WebhookResponse, 0, len(webhooks))
+	for i := range webhooks {
+		resp = append(resp, toWebhookResponse(&webhooks[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) getWebhook(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	w, err := h.webhookService.GetByID(c.Request.Context(), id)
+	if writeWebhookError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toWebhookResponse(w))
+}
+
+func (h *Handler) updateWebhook(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.webhookService.Update(c.Request.Context(), id, toWebhookInput(req))
+	if writeWebhookError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to update webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) deleteWebhook(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	err = h.webhookService.Delete(c.Request.Context(), id)
+	if writeWebhookError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to delete webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// webhookDeliveries - журнал доставок; status=dead - dead letters
+func (h *Handler) webhookDeliveries(c *gin.Context) {
+	var filter repository.DeliveryFilter
+	if s := c.Query("webhook_id"); s != "" {
+		webhookID, err := uuid.Parse(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook_id"})
+			return
+		}
+		filter.WebhookID = &webhookID
+	}
+	if status := c.Query("status"); status != "" {
+		switch status {
+		case repository.DeliveryPending, repository.DeliveryDelivered, repository.DeliveryDead:
+			filter.Status = &status
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status, expected pending, delivered or dead"})
+			return
+		}
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limit != nil {
+		filter.Limit = *limit
+	}
+
+	deliveries, err := h.webhookService.Deliveries(c.Request.Context(), filter)
+	if err != nil {
+		slog.Error("failed to list webhook deliveries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	resp := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		resp = append(resp, toWebhookDeliveryResponse(&deliveries[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) redeliverWebhook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	d, err := h.webhookService.Redeliver(c.Request.Context(), id)
+	if writeWebhookError(c, err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to redeliver webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, toWebhookDeliveryResponse(d))
+}
+
+func toWebhookInput(req WebhookRequest) service.WebhookInput {
+	return service.WebhookInput{URL: req.URL, Secret: req.Secret, EventTypes: req.EventTypes, Active: req.Active}
+}
+
+// writeWebhookError отвечает 404/409/400 на ошибки webhook, вызванные запросом. false - ошибка другая
+func writeWebhookError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound), errors.Is(err, repository.ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, repository.ErrDeliveryNotDead):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidWebhookURL), errors.Is(err, service.ErrPrivateWebhookURL),
+		errors.Is(err, service.ErrInvalidEventType), errors.Is(err, service.ErrWebhookSecret):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
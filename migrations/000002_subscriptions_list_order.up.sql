@@ -0,0 +1,2 @@
+-- индекс под сортировку листинга и keyset-пагинацию
+CREATE INDEX IF NOT EXISTS idx_subscriptions_list_order ON subscriptions(start_date DESC, service_name ASC, id ASC);
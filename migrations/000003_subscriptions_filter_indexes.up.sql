@@ -0,0 +1,2 @@
+-- индекс под фильтры листинга по цене
+CREATE INDEX IF NOT EXISTS idx_subscriptions_price ON subscriptions(price);
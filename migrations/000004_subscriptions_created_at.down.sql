@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subscriptions_created_at;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS created_at;
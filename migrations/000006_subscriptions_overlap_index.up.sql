@@ -0,0 +1,2 @@
+-- поиск пересекающихся подписок: тот же пользователь и сервис без учета регистра
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_service_lower ON subscriptions(user_id, lower(service_name), start_date);
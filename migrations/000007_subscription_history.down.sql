@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subscription_history_subscription;
+
+DROP TABLE IF EXISTS subscription_history;
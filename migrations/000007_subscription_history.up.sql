@@ -0,0 +1,12 @@
+-- история операций над подписками; без внешнего ключа, чтобы пережить удаление подписки
+CREATE TABLE IF NOT EXISTS subscription_history(
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    related_ids UUID[] NOT NULL DEFAULT '{}',
+    before JSONB, -- состояние подписки до операции
+    after JSONB,  -- и после, null - подписка удалена
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_history_subscription ON subscription_history(subscription_id, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_subscriptions_previous_id;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS previous_id;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS plan;
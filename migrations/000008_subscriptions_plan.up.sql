@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS plan TEXT;
+-- смена тарифа заканчивает подписку и начинает новую, previous_id связывает их
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS previous_id UUID REFERENCES subscriptions(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_previous_id ON subscriptions(previous_id);
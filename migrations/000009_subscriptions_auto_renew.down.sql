@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_subscriptions_end_date_auto_renew;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS canceled_at;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS auto_renew;
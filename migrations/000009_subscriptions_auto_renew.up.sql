@@ -0,0 +1,8 @@
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS auto_renew BOOLEAN NOT NULL DEFAULT TRUE;
+-- момент, когда пользователь отменил подписку; сама отмена вступает в силу после end_date
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS canceled_at TIMESTAMPTZ;
+
+-- подписки с известной датой окончания до этой миграции считаем не продлевающимися
+UPDATE subscriptions SET auto_renew = FALSE WHERE end_date IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_end_date_auto_renew ON subscriptions(end_date, auto_renew) WHERE end_date IS NOT NULL;
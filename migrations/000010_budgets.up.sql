@@ -0,0 +1,24 @@
+-- месячный бюджет пользователя: общий (service_name = NULL) или на один сервис
+CREATE TABLE IF NOT EXISTS budgets(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    service_name VARCHAR(255),
+    monthly_limit INT NOT NULL CHECK (monthly_limit > 0),
+    thresholds INT[] NOT NULL DEFAULT '{80,100}', -- пороги в процентах от лимита
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- не больше одного общего бюджета и одного бюджета на сервис у пользователя
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_user_service ON budgets(user_id, COALESCE(service_name, ''));
+
+-- пересечение порога бюджета в месяце; повторно за тот же месяц не создается
+CREATE TABLE IF NOT EXISTS budget_alerts(
+    id BIGSERIAL PRIMARY KEY,
+    budget_id UUID NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+    month DATE NOT NULL,
+    threshold INT NOT NULL,
+    spend INT NOT NULL,
+    monthly_limit INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (budget_id, month, threshold)
+);
@@ -0,0 +1,14 @@
+-- необычный рост месячных расходов пользователя; правило срабатывает не больше раза за месяц
+CREATE TABLE IF NOT EXISTS anomalies(
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    month DATE NOT NULL,
+    rule TEXT NOT NULL,
+    spend INT NOT NULL,
+    baseline DOUBLE PRECISION NOT NULL, -- с чем сравнивали: прошлый месяц или среднее за окно
+    score DOUBLE PRECISION NOT NULL,    -- рост в процентах или z-оценка
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, month, rule)
+);
+
+CREATE INDEX IF NOT EXISTS idx_anomalies_month ON anomalies(month);
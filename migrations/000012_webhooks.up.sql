@@ -0,0 +1,35 @@
+-- подписки на события жизненного цикла подписок (webhooks)
+CREATE TABLE IF NOT EXISTS webhooks(
+    id UUID PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL, -- ключ HMAC-SHA256 подписи запросов
+    event_types TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- событие сохраняется, только если на него подписан хотя бы один webhook
+CREATE TABLE IF NOT EXISTS webhook_events(
+    id UUID PRIMARY KEY,
+    type TEXT NOT NULL,
+    subscription_id UUID NOT NULL,
+    payload JSONB NOT NULL, -- тело запроса, одинаковое для всех получателей и повторов
+    dedup_key TEXT UNIQUE,  -- для событий, которые не должны повторяться (окончание подписки)
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL REFERENCES webhook_events(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending | delivered | dead
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_status_code INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status, webhook_id, id);
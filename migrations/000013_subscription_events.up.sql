@@ -0,0 +1,19 @@
+-- outbox событий подписок: событие пишется в одной транзакции с изменением подписки,
+-- фоновая задача ставит его в доставку webhook и удаляет
+CREATE TABLE IF NOT EXISTS subscription_events(
+    seq BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- снимок подписки после изменения (у удаленной - перед удалением), колонки как в subscriptions
+    id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    service_name VARCHAR(255) NOT NULL,
+    price INTEGER NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE,
+    created_at TIMESTAMPTZ NOT NULL,
+    plan TEXT,
+    previous_id UUID,
+    auto_renew BOOLEAN NOT NULL,
+    canceled_at TIMESTAMPTZ
+);
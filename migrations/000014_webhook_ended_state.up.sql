@@ -0,0 +1,6 @@
+-- последний месяц, за который опубликованы subscription.ended (одна строка):
+-- после простоя публикация продолжается со следующего за ним месяца
+CREATE TABLE IF NOT EXISTS webhook_ended_state(
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_month DATE NOT NULL
+);